@@ -2,106 +2,213 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	nethttp "net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	// The timezones of the branches are validated against the embedded database, as the
+	// runtime image has none.
+	_ "time/tzdata"
 
 	"github.com/degarzonm/brand_leal_service/internal/application"
 	"github.com/degarzonm/brand_leal_service/internal/config"
 	"github.com/degarzonm/brand_leal_service/internal/infrastructure/db"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/db/migrations"
 	"github.com/degarzonm/brand_leal_service/internal/infrastructure/http"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/logging"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/metrics"
 	"github.com/degarzonm/brand_leal_service/internal/infrastructure/msgBroker"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
+	"github.com/degarzonm/leal_contracts/migrate"
 	_ "github.com/lib/pq"
 )
 
+// serviceName identifies the service in the traces.
+const serviceName = "brand_leal_service"
+
 func main() {
 	// Load initial configuration
 	_, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Error cargando configuración: %v", err)
+		fatal("Error cargando configuración", err)
 	}
 	cfg := config.GetConfig()
 
+	// Structured logging, with passwords, tokens, emails and phones masked
+	if err := logging.Init(cfg.LogLevel); err != nil {
+		fatal("Error initializing logging", err)
+	}
+
+	// Tracing of requests, events and queries
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
+	if err != nil {
+		fatal("Error initializing tracing", err)
+	}
+
 	// Database connection
-	dbConn, err := sql.Open("postgres", fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.DBHost,
-		cfg.DBPort,
-		cfg.DBUser,
-		cfg.DBPassword,
-		cfg.DBName,
-	))
+	dbConn, err := tracing.OpenDB(cfg.DBDSN())
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		fatal("Error connecting to database", err)
 	}
 	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	dbConn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	dbConn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
 
 	if err := dbConn.Ping(); err != nil {
-		log.Fatalf("Error  pinging database: %v", err)
+		fatal("Error pinging database", err)
+	}
+	slog.Info("Conection to database established")
+	metrics.RegisterDB(dbConn, cfg.DBName)
+
+	// Database migrations: the migrate subcommand runs them and exits. Otherwise the
+	// pending ones are applied on start, if enabled, and the service refuses to start
+	// on a dirty, newer or outdated schema.
+	migrator, err := migrations.New(dbConn)
+	if err != nil {
+		fatal("Error loading migrations", err)
+	}
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			fatal("Unknown command", fmt.Errorf("%q, expected migrate", os.Args[1]))
+		}
+		if err := migrate.Command(context.Background(), migrator, os.Args[2:]); err != nil {
+			fatal("Error running migrations", err)
+		}
+		return
+	}
+	if cfg.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			fatal("Error applying migrations", err)
+		}
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		fatal("Database schema is not usable", err)
 	}
-	log.Println("Conection to database established")
 
 	// Create repositories
 	brandRepo := db.NewPostgresBrandRepo(dbConn)
 	branchRepo := db.NewPostgresBranchRepo(dbConn)
 	campaignRepo := db.NewPostgresCampaignRepo(dbConn)
 	rewardRepo := db.NewPostgresRewardRepo(dbConn)
+	settlementRepo := db.NewPostgresSettlementRepo(dbConn)
+	idempotencyRepo := db.NewPostgresIdempotencyRepo(dbConn)
+	userRepo := db.NewPostgresBrandUserRepo(dbConn)
+	unitOfWork := db.NewPostgresUnitOfWork(dbConn)
 
-	// Create services
-	brandService := application.NewBrandService(brandRepo, campaignRepo)
-	branchService := application.NewBranchService(branchRepo)
-	campaignService := application.NewCampaignService(campaignRepo)
-
-	// Initialize Kafka producer
-	eventProducer, err := msgBroker.NewKafkaProducer()
+	// Initialize message broker (kafka, memory or postgres)
+	broker, err := msgBroker.NewBroker()
 	if err != nil {
-		log.Fatalf("Error  initializing Kafka producer: %v", err)
+		fatal("Error initializing message broker", err, "broker", cfg.MsgBrokerType)
 	}
-	defer eventProducer.(*msgBroker.KafkaProducer).Producer.Close()
+	defer broker.Close()
+	eventProducer := broker.Producer()
 
 	// Create app service
-	appService := application.NewAppService(campaignRepo, brandRepo, eventProducer)
+	appService := application.NewAppService(unitOfWork, eventProducer, metrics.NewPrometheusBusinessMetrics())
 
-	// Initialize Kafka listener
-	kafkaListener, err := msgBroker.NewKafkaListener(appService)
+	// Relay of the events stored in the outbox to the broker
+	outboxRelay := msgBroker.NewOutboxRelay(unitOfWork, eventProducer, cfg.OutboxPollInterval)
+
+	// Create services
+	brandService := application.NewBrandService(brandRepo, unitOfWork, appService)
+	branchService := application.NewBranchService(branchRepo, unitOfWork)
+	campaignService := application.NewCampaignService(campaignRepo, unitOfWork)
+	settlementService := application.NewSettlementService(settlementRepo)
+	userService := application.NewBrandUserService(userRepo, brandRepo, branchRepo, unitOfWork)
+
+	// Initialize event listener
+	eventListener, err := broker.Listener(appService, []string{cfg.MsgPurchaseTopic, cfg.MsgExchange})
 	if err != nil {
-		log.Fatalf("Error initializing Kafka listener: %v", err)
+		fatal("Error initializing event listener", err)
 	}
 
-	// Context for graceful shutdown
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Context cancelled by SIGINT or SIGTERM, for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Execute Kafka listener
+	// Execute event listener
+	listenerDone := make(chan struct{})
 	go func() {
-		log.Println("Initializing Kafka listener...")
-		if err := kafkaListener.Listen(); err != nil {
-			log.Fatalf("Error en el listener de Kafka: %v", err)
+		defer close(listenerDone)
+		slog.Info("Initializing event listener", "broker", cfg.MsgBrokerType)
+		if err := eventListener.Listen(ctx); err != nil {
+			fatal("Error en el listener de eventos", err)
 		}
 	}()
 
-	// Configure graceful shutdown
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-
+	// Execute outbox relay
+	relayDone := make(chan struct{})
 	go func() {
-		<-sig
-		log.Println("Signal received, shutting down...")
-		cancel()
+		defer close(relayDone)
+		slog.Info("Initializing outbox relay", "broker", cfg.MsgBrokerType)
+		outboxRelay.Run(ctx)
 	}()
 
 	// Create HTTP handlers
-	handler := http.NewHandler(brandService, branchService, campaignService, rewardRepo)
+	handler := http.NewHandler(brandService, branchService, campaignService, rewardRepo, settlementService, userService)
+
+	// Create health checks of the database and the message broker
+	health := http.NewHealthHandler(cfg.HealthCheckTimeout,
+		http.HealthCheck{Name: "database", Check: func(ctx context.Context) (map[string]any, error) {
+			return nil, dbConn.PingContext(ctx)
+		}},
+		http.HealthCheck{Name: "producer", Check: broker.Health},
+		http.HealthCheck{Name: "consumer", Check: eventListener.Health},
+	)
+
+	// Create the validation of the requests against the OpenAPI document
+	validation, err := http.ValidationMiddleware()
+	if err != nil {
+		fatal("Error loading OpenAPI document", err)
+	}
+
+	// Create the authentication of brands and other services
+	auth := http.AuthMiddleware(brandService, userService, cfg.ServiceTokens)
 
 	// Create HTTP router
-	router := http.NewRouter(handler)
+	router := http.NewRouter(handler, health, auth, http.IdempotencyMiddleware(idempotencyRepo, cfg.IdempotencyKeyTTL), metrics.HTTPMiddleware(), tracing.HTTPMiddleware(serviceName), logging.HTTPMiddleware(), validation)
 
 	// Initialize HTTP server
-	log.Printf("Initializing HTTP server on port %s", cfg.HTTPServerPort)
-	if err := router.Run(":" + cfg.HTTPServerPort); err != nil {
-		log.Fatalf("Error initializing HTTP server: %v", err)
+	server := &nethttp.Server{Addr: ":" + cfg.HTTPServerPort, Handler: router}
+	go func() {
+		slog.Info("Initializing HTTP server", "port", cfg.HTTPServerPort)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			fatal("Error initializing HTTP server", err)
+		}
+	}()
+
+	// Graceful shutdown: stop accepting requests, drain the in-flight ones, let the
+	// listener finish the events it is handling and commit its offsets, and let the relay
+	// finish the batch it is sending.
+	<-ctx.Done()
+	slog.Info("Signal received, shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down HTTP server", "error", err)
+	}
+	select {
+	case <-listenerDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Timed out waiting for the event listener")
 	}
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Timed out waiting for the outbox relay")
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Error flushing spans", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs err, along with the key-value pairs of args, and exits.
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"error", err}, args...)...)
+	os.Exit(1)
 }
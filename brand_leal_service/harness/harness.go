@@ -0,0 +1,133 @@
+// Package harness runs the brand service in process, for end-to-end tests with the
+// customer service: its application services, PostgreSQL repositories, event listener and
+// outbox relay work as in production, on a database the test provides and on a memory
+// broker of a bus the customer service shares. Like the service, it reads its
+// configuration from the environment, so the topics must be set before the harness is
+// created.
+package harness
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/application"
+	"github.com/degarzonm/brand_leal_service/internal/config"
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/db"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/db/migrations"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/msgBroker"
+	"github.com/degarzonm/leal_contracts/bus"
+)
+
+// Brand is the brand service running on a test database.
+type Brand struct {
+	uow        domain.UnitOfWork
+	brands     domain.BrandService
+	branches   domain.BranchService
+	settlement domain.SettlementService
+	listener   msgBroker.Listener
+	relay      *msgBroker.OutboxRelay
+}
+
+// NewBrand creates the brand service on conn, which it migrates to the latest version,
+// sending and consuming its events on b. It returns an error if the configuration cannot
+// be loaded or the database cannot be migrated.
+func NewBrand(conn *sql.DB, b *bus.Bus) (*Brand, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := migrations.New(conn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return nil, err
+	}
+
+	unitOfWork := db.NewPostgresUnitOfWork(conn)
+	broker := msgBroker.NewMemoryBrokerOn(b)
+	appService := application.NewAppService(unitOfWork, broker, noMetrics{})
+	return &Brand{
+		uow:        unitOfWork,
+		brands:     application.NewBrandService(db.NewPostgresBrandRepo(conn), unitOfWork, appService),
+		branches:   application.NewBranchService(db.NewPostgresBranchRepo(conn), unitOfWork),
+		settlement: application.NewSettlementService(db.NewPostgresSettlementRepo(conn)),
+		listener:   msgBroker.NewMemoryListener(broker, appService, []string{cfg.MsgPurchaseTopic, cfg.MsgExchange}),
+		relay:      msgBroker.NewOutboxRelay(unitOfWork, broker, cfg.OutboxPollInterval),
+	}, nil
+}
+
+// Run consumes the events of the service and relays its outbox until ctx is cancelled.
+func (b *Brand) Run(ctx context.Context) error {
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		b.relay.Run(ctx)
+	}()
+	err := b.listener.Listen(ctx)
+	<-relayDone
+	return err
+}
+
+// AddBrand creates a brand whose base campaign rewards every unit of a purchase amount
+// with the given points and coins, and returns its ID.
+func (b *Brand) AddBrand(ctx context.Context, pointFactor, coinFactor float64) (int, error) {
+	brand, err := b.brands.CreateBrand(ctx, fmt.Sprintf("brand-%d", time.Now().UnixNano()), "secret")
+	if err != nil {
+		return 0, err
+	}
+	err = b.uow.Do(ctx, func(repos domain.Repositories) error {
+		base, err := repos.Campaigns.GetBaseCampaignForBrand(ctx, brand.ID)
+		if err != nil {
+			return err
+		}
+		base.PointFactor, base.CoinFactor = pointFactor, coinFactor
+		return repos.Campaigns.UpdateCampaign(ctx, base, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return brand.ID, nil
+}
+
+// AddBranch creates an open or closed branch of the brand and returns its ID.
+func (b *Brand) AddBranch(ctx context.Context, brandID int, active bool) (int, error) {
+	branch, err := b.branches.CreateBranch(ctx, &domain.Branch{BrandID: brandID, Name: "branch", Address: "address"})
+	if err != nil {
+		return 0, err
+	}
+	if !active {
+		if err := b.branches.DeactivateBranch(ctx, brandID, branch.ID); err != nil {
+			return 0, err
+		}
+	}
+	return branch.ID, nil
+}
+
+// UpdateSettings sets the exchange rates and daily exchange limit of the brand, and
+// publishes them to the customer service.
+func (b *Brand) UpdateSettings(ctx context.Context, brandID int, coinsToPointsRate, pointsToCoinsRate float64, exchangeDailyLimit int) error {
+	_, err := b.brands.UpdateSettings(ctx, &domain.BrandSettings{
+		BrandID: brandID, AllowPointsTransfer: true,
+		CoinsToPointsRate: coinsToPointsRate, PointsToCoinsRate: pointsToCoinsRate, ExchangeDailyLimit: exchangeDailyLimit,
+	})
+	return err
+}
+
+// Settlement returns the coins the brand issued and the coins consumed at it this month.
+func (b *Brand) Settlement(ctx context.Context, brandID int) (issued int, consumed int, err error) {
+	statement, err := b.settlement.GetStatement(ctx, brandID, "")
+	if err != nil {
+		return 0, 0, err
+	}
+	return statement.Position.Issued, statement.Position.Consumed, nil
+}
+
+type noMetrics struct{}
+
+func (noMetrics) PurchaseProcessed(int)                   {}
+func (noMetrics) PurchaseRejected(int, string)            {}
+func (noMetrics) RewardIssued(int, int, float64, float64) {}
@@ -1,44 +1,129 @@
 package application
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/degarzonm/brand_leal_service/internal/config"
 	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/util"
 )
 
 type AppService struct {
-	campaignRepo  domain.CampaignRepository
-	brandRepo     domain.BrandsRepository
+	uow           domain.UnitOfWork
 	eventProducer domain.EventProducer
+	metrics       domain.BusinessMetrics
 }
 
 // NewAppService creates a new application service
-func NewAppService(campaignRepo domain.CampaignRepository, brandRepo domain.BrandsRepository, producer domain.EventProducer) *AppService {
+func NewAppService(uow domain.UnitOfWork, producer domain.EventProducer, metrics domain.BusinessMetrics) *AppService {
 	return &AppService{
-		campaignRepo:  campaignRepo,
-		brandRepo:     brandRepo,
+		uow:           uow,
 		eventProducer: producer,
+		metrics:       metrics,
 	}
 }
 
-// ProcessPurchase processes a purchase transaction by calculating and applying points
-// and coins based on base and active campaigns. It retrieves the base campaign for
-// the brand and active campaigns for the branch, applying factors to the purchase
-// amount to compute total points and coins. If the purchase meets campaign criteria,
-// additional campaign bonuses are applied. The computed points and coins are then
-// logged and sent as a message to a Kafka topic. Returns an error if any operation
-// within the process fails.
-
-func (s *AppService) ProcessPurchase(purchase domain.Purchase) error {
-	// Get the base campaign
-	baseCampaign, err := s.campaignRepo.GetBaseCampaignForBrand(purchase.BrandID)
+// ProcessPurchase rewards a purchase with the points and coins of the brand campaigns.
+//
+// Purchases at a branch that does not exist, is closed or belongs to another brand, or of
+// a brand without a base campaign, are rejected: a rejection event is sent back with the
+// correlation ID of the purchase event, so the customer service refunds the coins used,
+// and nothing is issued or recorded.
+//
+// Otherwise the base campaign of the brand sets the base points and coins for the purchase
+// amount, and every active campaign of the branch whose dates and value range match the
+// purchase adds its factors on top of them.
+//
+// The campaign counters, the settlement entries (the coins issued by the brand and the
+// coins the customer used there) and the apply points event, with the ID of the purchase,
+// what each campaign issued and the correlation ID of the purchase event, are written in
+// a single transaction. The event goes to the outbox and the relay sends it once the
+// transaction commits. A campaign counts each purchase once, so a redelivered purchase
+// event changes no counter, settles nothing again and its second apply points event is
+// ignored by the customer service.
+//
+// If the transaction fails, the purchase is rejected instead, so its coins are refunded
+// rather than left pending, and the error is returned. Finally the rewards are recorded in
+// the business metrics.
+func (s *AppService) ProcessPurchase(ctx context.Context, purchase domain.Purchase, correlationID string) error {
+	var (
+		reason       string
+		baseCampaign *domain.Campaign
+		pointsInfo   domain.LealPointsApply
+	)
+	err := s.uow.Do(ctx, func(repos domain.Repositories) error {
+		var err error
+		reason, baseCampaign, err = purchaseRejection(ctx, repos, purchase)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return queuePurchaseRejectedEvent(ctx, repos, purchase, reason, correlationID)
+		}
+		if pointsInfo, err = rewardPurchase(ctx, repos, purchase, *baseCampaign); err != nil {
+			return err
+		}
+		return queueApplyPointsEvent(ctx, repos, pointsInfo, correlationID)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to process purchase, rejecting it", "purchase_id", purchase.ID, "error", err)
+		if rejectErr := s.rejectPurchase(ctx, purchase, domain.RejectProcessingFailed, correlationID); rejectErr != nil {
+			return errors.Join(err, rejectErr)
+		}
+		return fmt.Errorf("purchase rejected after processing failed: %w", err)
+	}
+	if reason != "" {
+		slog.WarnContext(ctx, "Rejected purchase", "purchase_id", purchase.ID, "customer_id", purchase.CustomerID, "brand_id", purchase.BrandID, "branch_id", purchase.BranchID, "reason", reason)
+		s.metrics.PurchaseRejected(purchase.BrandID, reason)
+		return nil
+	}
+
+	s.metrics.PurchaseProcessed(purchase.BrandID)
+	for _, reward := range pointsInfo.Breakdown {
+		s.metrics.RewardIssued(purchase.BrandID, reward.CampaignID, reward.Points, reward.Coins)
+	}
+	slog.InfoContext(ctx, "Processed purchase", "customer_id", purchase.CustomerID, "brand_id", purchase.BrandID, "points", pointsInfo.Points, "coins", pointsInfo.Coins)
+	return nil
+}
+
+// purchaseRejection returns the reason the purchase must be rejected, or an empty string
+// and the base campaign of its brand if its branch is an open branch of its brand and the
+// brand has a base campaign.
+func purchaseRejection(ctx context.Context, repos domain.Repositories, purchase domain.Purchase) (string, *domain.Campaign, error) {
+	branch, err := repos.Branches.GetBranchByID(ctx, purchase.BranchID)
 	if err != nil {
-		return errors.New("failed to retrieve base campaign")
+		return "", nil, err
+	}
+	switch {
+	case branch == nil:
+		return domain.RejectBranchNotFound, nil, nil
+	case branch.BrandID != purchase.BrandID:
+		return domain.RejectBranchOfOtherBrand, nil, nil
+	case !branch.Active:
+		return domain.RejectBranchClosed, nil, nil
+	}
+	baseCampaign, err := repos.Campaigns.GetBaseCampaignForBrand(ctx, purchase.BrandID)
+	if err != nil {
+		return "", nil, err
 	}
 	if baseCampaign == nil {
-		return errors.New("no base campaign found for the brand")
+		return domain.RejectNoBaseCampaign, nil, nil
+	}
+	return "", baseCampaign, nil
+}
+
+// rewardPurchase computes the points and coins of the purchase with the base campaign and
+// the matching campaigns of its branch, counts the purchase in those campaigns, records its
+// settlement entries and returns the points to apply. Every branch is linked to the base
+// campaign, which is applied once, before the others.
+func rewardPurchase(ctx context.Context, repos domain.Repositories, purchase domain.Purchase, baseCampaign domain.Campaign) (domain.LealPointsApply, error) {
+	if err := repos.Campaigns.UpdateCustomerCountCampaign(ctx, &baseCampaign, purchase.ID); err != nil {
+		return domain.LealPointsApply{}, err
 	}
 
 	// Calculate base points and coins
@@ -47,15 +132,19 @@ func (s *AppService) ProcessPurchase(purchase domain.Purchase) error {
 
 	totalPoints := basePoints
 	totalCoins := baseCoins
+	breakdown := []domain.RewardBreakdown{{CampaignID: baseCampaign.ID, CampaignName: baseCampaign.CampaignName, Points: basePoints, Coins: baseCoins}}
 
 	// Fetch active campaigns for the branch
-	campaigns, err := s.campaignRepo.GetCampaignsForBranch(purchase.BranchID)
+	campaigns, err := repos.Campaigns.GetCampaignsForBranch(ctx, purchase.BranchID)
 	if err != nil {
-		return errors.New("failed to retrieve campaigns for branch")
+		return domain.LealPointsApply{}, err
 	}
 
 	// Apply additional campaigns
 	for _, campaign := range campaigns {
+		if campaign.ID == baseCampaign.ID {
+			continue
+		}
 		if campaign.Status != "active" || purchase.Amount < campaign.MinValue || purchase.Amount > campaign.MaxValue {
 			continue
 		}
@@ -63,36 +152,157 @@ func (s *AppService) ProcessPurchase(purchase domain.Purchase) error {
 			continue
 		}
 		//update counter on campaign
-		err = s.campaignRepo.UpdateCustomerCountCampaign(&campaign)
-		if err != nil {
-			return err
+		if err := repos.Campaigns.UpdateCustomerCountCampaign(ctx, &campaign, purchase.ID); err != nil {
+			return domain.LealPointsApply{}, err
 		}
 		//add points and coins
 		totalPoints += basePoints * campaign.PointFactor
 		totalCoins += baseCoins * campaign.CoinFactor
+		breakdown = append(breakdown, domain.RewardBreakdown{
+			CampaignID:   campaign.ID,
+			CampaignName: campaign.CampaignName,
+			Points:       basePoints * campaign.PointFactor,
+			Coins:        baseCoins * campaign.CoinFactor,
+		})
+	}
+	slog.DebugContext(ctx, "Calculated purchase rewards", "customer_id", purchase.CustomerID, "points", totalPoints, "coins", totalCoins, "campaigns", len(breakdown)-1)
+	if err := recordSettlement(ctx, repos.Settlement, purchase, int(totalCoins)); err != nil {
+		return domain.LealPointsApply{}, err
 	}
-	log.Printf("Processed purchase for CustomerID=%d, Points=%f, Coins=%f\n", purchase.CustomerID, totalPoints, totalCoins)
-	// Send calculated pointsInfo to Kafka
-	pointsInfo := domain.LealPointsApply{
+	return domain.LealPointsApply{
+		PurchaseID: purchase.ID,
 		CustomerID: purchase.CustomerID,
 		BrandID:    purchase.BrandID,
 		Points:     int(totalPoints),
 		Coins:      int(totalCoins),
 		Reason:     "purchase",
+		Breakdown:  breakdown,
+	}, nil
+}
+
+// rejectPurchase stores the rejection of a purchase in the outbox, in a transaction of its
+// own, and records it in the business metrics.
+func (s *AppService) rejectPurchase(ctx context.Context, purchase domain.Purchase, reason string, correlationID string) error {
+	slog.WarnContext(ctx, "Rejecting purchase", "purchase_id", purchase.ID, "customer_id", purchase.CustomerID, "brand_id", purchase.BrandID, "branch_id", purchase.BranchID, "reason", reason)
+	err := s.uow.Do(ctx, func(repos domain.Repositories) error {
+		return queuePurchaseRejectedEvent(ctx, repos, purchase, reason, correlationID)
+	})
+	if err != nil {
+		return err
+	}
+	s.metrics.PurchaseRejected(purchase.BrandID, reason)
+	return nil
+}
+
+// ProcessExchange records the coins a customer exchanged with a brand for settlement:
+// coins exchanged for points of the brand are consumed at it, like coins used to pay a
+// purchase there, and coins given for points of the brand are issued by it. Reprocessing
+// the same exchange event records nothing.
+func (s *AppService) ProcessExchange(ctx context.Context, exchange domain.Exchange) error {
+	slog.InfoContext(ctx, "Processing exchange", "exchange_id", exchange.ID, "customer_id", exchange.CustomerID, "brand_id", exchange.BrandID, "direction", exchange.Direction, "coins", exchange.Coins)
+	entry := domain.SettlementEntry{
+		BrandID:    exchange.BrandID,
+		Coins:      exchange.Coins,
+		ExchangeID: exchange.ID,
+		CustomerID: exchange.CustomerID,
+		EntryDate:  exchange.Date,
 	}
-	log.Println("message to sent to pointsInfo: ", pointsInfo)
-	if err := s.SendApplyPointsEvent(pointsInfo); err != nil {
-		return errors.New("failed to send apply points event")
+	switch exchange.Direction {
+	case domain.ExchangeCoinsToPoints:
+		entry.EntryType = domain.SettlementConsumed
+	case domain.ExchangePointsToCoins:
+		entry.EntryType = domain.SettlementIssued
+	default:
+		return fmt.Errorf("unknown exchange direction %q", exchange.Direction)
 	}
+	if entry.Coins <= 0 {
+		return nil
+	}
+	if entry.EntryDate.IsZero() {
+		entry.EntryDate = time.Now()
+	}
+	return s.uow.Do(ctx, func(repos domain.Repositories) error {
+		return repos.Settlement.RecordEntry(ctx, &entry)
+	})
+}
 
-	log.Printf("Processed purchase for CustomerID=%d successfully", purchase.CustomerID)
+// recordSettlement records the coins issued by the purchase brand and the coins the customer
+// spent there, so coin flows between brands can be settled. Zero amounts are not recorded.
+func recordSettlement(ctx context.Context, settlementRepo domain.SettlementRepository, purchase domain.Purchase, issuedCoins int) error {
+	date := purchase.PurchaseDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	entries := []domain.SettlementEntry{
+		{BrandID: purchase.BrandID, EntryType: domain.SettlementIssued, Coins: issuedCoins},
+		{BrandID: purchase.BrandID, EntryType: domain.SettlementConsumed, Coins: purchase.CoinsUsed},
+	}
+	for _, entry := range entries {
+		if entry.Coins <= 0 {
+			continue
+		}
+		entry.PurchaseID = purchase.ID
+		entry.CustomerID = purchase.CustomerID
+		entry.EntryDate = date
+		if err := settlementRepo.RecordEntry(ctx, &entry); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// SendApplyPointsEvent sends a message to the apply-points topic with the given points info.
-// The message is sent to the configured topic name from the global configuration.
+// queueApplyPointsEvent stores the apply points event in the outbox of the transaction that
+// rewards the purchase, to be sent to the apply-points topic once it commits. The event is
+// keyed by the customer so the points of a customer are applied in order.
+func queueApplyPointsEvent(ctx context.Context, repos domain.Repositories, points domain.LealPointsApply, correlationID string) error {
+	cfg := config.GetConfig()
+	return repos.Outbox.AddEvent(ctx, cfg.MsgApplyPointsTopic, domain.Event{
+		Type:          domain.EventPointsApply,
+		CorrelationID: correlationID,
+		Keys: map[string]string{
+			domain.KeyCustomerID: strconv.Itoa(points.CustomerID),
+			domain.KeyBrandID:    strconv.Itoa(points.BrandID),
+		},
+		Payload: points,
+	})
+}
+
+// queuePurchaseRejectedEvent stores the rejection of a purchase in the outbox, to be sent to
+// the purchase-rejected topic once the transaction commits, keyed by the customer like the
+// purchase.
+func queuePurchaseRejectedEvent(ctx context.Context, repos domain.Repositories, purchase domain.Purchase, reason string, correlationID string) error {
+	cfg := config.GetConfig()
+	return repos.Outbox.AddEvent(ctx, cfg.MsgPurchaseRejected, domain.Event{
+		Type:          domain.EventPurchaseRejected,
+		CorrelationID: correlationID,
+		Keys: map[string]string{
+			domain.KeyCustomerID: strconv.Itoa(purchase.CustomerID),
+			domain.KeyBrandID:    strconv.Itoa(purchase.BrandID),
+		},
+		Payload: domain.PurchaseRejection{
+			PurchaseID: purchase.ID,
+			CustomerID: purchase.CustomerID,
+			BrandID:    purchase.BrandID,
+			BranchID:   purchase.BranchID,
+			CoinsUsed:  purchase.CoinsUsed,
+			Reason:     reason,
+		},
+	})
+}
+
+// SendBrandSettingsEvent sends the brand settings to the brand-settings topic, so the
+// customer service can enforce them. The topic name is read from the global configuration.
 // The method returns an error if the message could not be sent.
-func (s *AppService) SendApplyPointsEvent(points domain.LealPointsApply) error {
+func (s *AppService) SendBrandSettingsEvent(ctx context.Context, settings domain.BrandSettings) error {
 	cfg := config.GetConfig()
-	return s.eventProducer.SendMessage(cfg.MsgApplyPointsTopic, points)
+	correlationID, err := util.GenerateToken()
+	if err != nil {
+		return err
+	}
+	return s.eventProducer.SendEvent(ctx, cfg.MsgBrandSettings, domain.Event{
+		Type:          domain.EventBrandSettingsUpdated,
+		CorrelationID: correlationID,
+		Keys:          map[string]string{domain.KeyBrandID: strconv.Itoa(settings.BrandID)},
+		Payload:       settings,
+	})
 }
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/config"
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+)
+
+// TestMain loads the configuration the application services read, with the topics the
+// events are queued to.
+func TestMain(m *testing.M) {
+	for key, value := range map[string]string{
+		"DB_HOST": "localhost", "DB_PORT": "5432", "DB_USER": "test", "DB_NAME": "test",
+		"HTTP_SERVER_PORT": "0", "MSG_BROKER_TYPE": "memory",
+		"MSG_PURCHASE": "purchase-topic", "MSG_APPLY_POINTS": "apply-points-topic",
+		"MSG_BRAND_SETTINGS": "brand-settings-topic",
+	} {
+		os.Setenv(key, value)
+	}
+	if _, err := config.LoadConfig(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newBrand adds brand 1 to the store, with a base campaign of 1 point and 0.1 coins per
+// unit, an open branch 1 and a closed branch 2, both linked to the base campaign like the
+// branches the service creates, and a campaign of branch 1 that adds half the base points.
+func newBrand(s *store) {
+	s.st.branches[1] = domain.Branch{ID: 1, BrandID: 1, Name: "open", Active: true}
+	s.st.branches[2] = domain.Branch{ID: 2, BrandID: 1, Name: "closed"}
+	s.st.campaigns[1] = domain.Campaign{
+		ID: 1, CampaignName: "base", BrandID: 1, Status: "active", PointFactor: 1, CoinFactor: 0.1,
+		MaxValue: 1e9, EndDate: time.Now().AddDate(1, 0, 0), Branches: []int{1, 2},
+	}
+	s.st.campaigns[2] = domain.Campaign{
+		ID: 2, CampaignName: "double", BrandID: 1, Status: "active", PointFactor: 0.5,
+		MaxValue: 1e9, EndDate: time.Now().AddDate(1, 0, 0), Branches: []int{1},
+	}
+}
+
+func TestProcessPurchaseRewardsEachCampaignOnce(t *testing.T) {
+	s := newStore()
+	newBrand(s)
+	app := NewAppService(s, nil, noMetrics{})
+	purchase := domain.Purchase{ID: 7, CustomerID: 3, BrandID: 1, BranchID: 1, Amount: 200, CoinsUsed: 20, PurchaseDate: time.Now()}
+
+	for range 2 {
+		if err := app.ProcessPurchase(context.Background(), purchase, "correlation"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(s.st.outbox) == 0 || s.st.outbox[0].Event.Type != domain.EventPointsApply {
+		t.Fatalf("outbox = %+v, want the apply points event", s.st.outbox)
+	}
+	points := s.st.outbox[0].Event.Payload.(domain.LealPointsApply)
+	if points.PurchaseID != 7 || points.Points != 300 || points.Coins != 20 || len(points.Breakdown) != 2 {
+		t.Errorf("apply points %+v, want 200 base and 100 campaign points and 20 coins for purchase 7", points)
+	}
+	if s.st.outbox[0].Event.CorrelationID != "correlation" {
+		t.Errorf("correlation ID %q, want the one of the purchase event", s.st.outbox[0].Event.CorrelationID)
+	}
+	for _, id := range []int{1, 2} {
+		if count := s.st.campaigns[id].CustomerCount; count != 1 {
+			t.Errorf("campaign %d counted %d purchases, want 1", id, count)
+		}
+	}
+	if len(s.st.settlement) != 2 {
+		t.Errorf("%d settlement entries, want the coins issued and consumed once", len(s.st.settlement))
+	}
+}
+
+func TestProcessPurchaseRejectsWhatCannotBeRewarded(t *testing.T) {
+	tests := map[string]struct {
+		purchase domain.Purchase
+		noBase   bool
+		reason   string
+	}{
+		"unknown branch":        {purchase: domain.Purchase{BrandID: 1, BranchID: 9}, reason: domain.RejectBranchNotFound},
+		"branch of other brand": {purchase: domain.Purchase{BrandID: 2, BranchID: 1}, reason: domain.RejectBranchOfOtherBrand},
+		"closed branch":         {purchase: domain.Purchase{BrandID: 1, BranchID: 2}, reason: domain.RejectBranchClosed},
+		"no base campaign":      {purchase: domain.Purchase{BrandID: 1, BranchID: 1}, noBase: true, reason: domain.RejectNoBaseCampaign},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newStore()
+			newBrand(s)
+			if tt.noBase {
+				delete(s.st.campaigns, 1)
+			}
+			app := NewAppService(s, nil, noMetrics{})
+			purchase := tt.purchase
+			purchase.ID, purchase.CustomerID, purchase.Amount, purchase.CoinsUsed = 7, 3, 200, 20
+
+			if err := app.ProcessPurchase(context.Background(), purchase, "correlation"); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.st.outbox) != 1 || s.st.outbox[0].Event.Type != domain.EventPurchaseRejected {
+				t.Fatalf("outbox = %+v, want the purchase rejected event", s.st.outbox)
+			}
+			rejection := s.st.outbox[0].Event.Payload.(domain.PurchaseRejection)
+			if rejection.PurchaseID != 7 || rejection.CoinsUsed != 20 || rejection.Reason != tt.reason {
+				t.Errorf("rejection %+v, want purchase 7 with 20 coins rejected with %s", rejection, tt.reason)
+			}
+			if len(s.st.settlement) != 0 {
+				t.Errorf("%d settlement entries, want none", len(s.st.settlement))
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package application
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
+)
+
+// state is the data of the service that the database keeps in production: the branches,
+// campaigns, settlement entries and the event outbox.
+type state struct {
+	branches   map[int]domain.Branch
+	campaigns  map[int]domain.Campaign
+	settlement []domain.SettlementEntry
+	counted    map[[2]int]bool // campaign and purchase IDs
+	outbox     []domain.OutboxEvent
+
+	lastEntryID  int
+	lastOutboxID int64
+}
+
+func (st *state) clone() *state {
+	c := *st
+	c.branches = maps.Clone(st.branches)
+	c.campaigns = maps.Clone(st.campaigns)
+	c.settlement = slices.Clone(st.settlement)
+	c.counted = maps.Clone(st.counted)
+	c.outbox = slices.Clone(st.outbox)
+	return &c
+}
+
+// store is the in-memory database of the tests. It is also its unit of work: Do runs
+// one unit at a time on a copy of the state, which replaces the state once fn succeeds.
+type store struct {
+	mu sync.Mutex
+	st *state
+}
+
+func newStore() *store {
+	return &store{st: &state{
+		branches:  map[int]domain.Branch{},
+		campaigns: map[int]domain.Campaign{},
+		counted:   map[[2]int]bool{},
+	}}
+}
+
+func (s *store) Do(ctx context.Context, fn func(repos domain.Repositories) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tx := s.st.clone()
+	if err := fn(tx.repositories()); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.st = tx
+	return nil
+}
+
+// repositories returns the repositories of the state. Those the tests never use are
+// left nil, and the methods of the others that they never call panic.
+func (st *state) repositories() domain.Repositories {
+	return domain.Repositories{
+		Branches:   branchesRepo{st: st},
+		Campaigns:  campaignsRepo{st: st},
+		Settlement: settlementRepo{st: st},
+		Outbox:     outboxRepo{st: st},
+	}
+}
+
+type branchesRepo struct {
+	domain.BranchesRepository
+	st *state
+}
+
+func (r branchesRepo) GetBranchByID(_ context.Context, id int) (*domain.Branch, error) {
+	branch, ok := r.st.branches[id]
+	if !ok {
+		return nil, nil
+	}
+	return &branch, nil
+}
+
+type campaignsRepo struct {
+	domain.CampaignRepository
+	st *state
+}
+
+func (r campaignsRepo) GetBaseCampaignForBrand(_ context.Context, brandID int) (*domain.Campaign, error) {
+	for _, campaign := range r.st.campaigns {
+		if campaign.BrandID == brandID && campaign.CampaignName == "base" {
+			return &campaign, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetCampaignsForBranch returns the active campaigns linked to the branch, if it is open.
+func (r campaignsRepo) GetCampaignsForBranch(_ context.Context, branchID int) ([]domain.Campaign, error) {
+	if branch, ok := r.st.branches[branchID]; !ok || !branch.Active {
+		return nil, nil
+	}
+	var campaigns []domain.Campaign
+	for _, campaign := range r.st.campaigns {
+		if campaign.Status == "active" && slices.Contains(campaign.Branches, branchID) {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	return campaigns, nil
+}
+
+// UpdateCustomerCountCampaign counts each purchase once, like the database repository.
+func (r campaignsRepo) UpdateCustomerCountCampaign(_ context.Context, c *domain.Campaign, purchaseID int) error {
+	if r.st.counted[[2]int{c.ID, purchaseID}] {
+		return nil
+	}
+	r.st.counted[[2]int{c.ID, purchaseID}] = true
+	if campaign, ok := r.st.campaigns[c.ID]; ok {
+		campaign.CustomerCount++
+		r.st.campaigns[c.ID] = campaign
+	}
+	return nil
+}
+
+type settlementRepo struct {
+	domain.SettlementRepository
+	st *state
+}
+
+// RecordEntry ignores a second entry of the same type for a purchase or an exchange, like
+// the unique constraints of the database.
+func (r settlementRepo) RecordEntry(_ context.Context, entry *domain.SettlementEntry) error {
+	for _, e := range r.st.settlement {
+		if e.EntryType != entry.EntryType {
+			continue
+		}
+		if (entry.PurchaseID != 0 && e.PurchaseID == entry.PurchaseID) || (entry.ExchangeID != 0 && e.ExchangeID == entry.ExchangeID) {
+			return nil
+		}
+	}
+	r.st.lastEntryID++
+	entry.ID = r.st.lastEntryID
+	r.st.settlement = append(r.st.settlement, *entry)
+	return nil
+}
+
+type outboxRepo struct{ st *state }
+
+func (r outboxRepo) AddEvent(ctx context.Context, topic string, event domain.Event) error {
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+	r.st.lastOutboxID++
+	r.st.outbox = append(r.st.outbox, domain.OutboxEvent{ID: r.st.lastOutboxID, Topic: topic, Event: event, TraceHeaders: headers})
+	return nil
+}
+
+func (r outboxRepo) GetPendingEvents(_ context.Context, limit int) ([]domain.OutboxEvent, error) {
+	return slices.Clone(r.st.outbox[:min(limit, len(r.st.outbox))]), nil
+}
+
+func (r outboxRepo) RecordFailure(context.Context, int64, string) error {
+	return nil
+}
+
+func (r outboxRepo) DeleteEvent(_ context.Context, id int64) error {
+	r.st.outbox = slices.DeleteFunc(r.st.outbox, func(e domain.OutboxEvent) bool { return e.ID == id })
+	return nil
+}
+
+type noMetrics struct{}
+
+func (noMetrics) PurchaseProcessed(int)                   {}
+func (noMetrics) PurchaseRejected(int, string)            {}
+func (noMetrics) RewardIssued(int, int, float64, float64) {}
@@ -1,8 +1,9 @@
 package application
 
 import (
+	"context"
 	"errors"
-	"log"
+	"slices"
 	"time"
 
 	"github.com/degarzonm/brand_leal_service/internal/domain"
@@ -10,48 +11,66 @@ import (
 )
 
 type brandService struct {
-	brandRepo    domain.BrandsRepository
-	campaignRepo domain.CampaignRepository
+	brandRepo  domain.BrandsRepository
+	uow        domain.UnitOfWork
+	appService *AppService
 }
 
+const (
+	// defaultNearestBranches and maxNearestBranches bound the results of the branch locator.
+	defaultNearestBranches = 10
+	maxNearestBranches     = 50
+)
+
 type branchService struct {
 	branchRepo domain.BranchesRepository
+	uow        domain.UnitOfWork
 }
 
 type campaignService struct {
 	campaignRepo domain.CampaignRepository
+	uow          domain.UnitOfWork
 }
 
 type rewardService struct {
 	rewardRepo domain.RewardRepository
 }
 
-func NewBrandService(br domain.BrandsRepository, cr domain.CampaignRepository) domain.BrandService {
-	return &brandService{brandRepo: br, campaignRepo: cr}
+type settlementService struct {
+	settlementRepo domain.SettlementRepository
+}
+
+func NewBrandService(br domain.BrandsRepository, uow domain.UnitOfWork, app *AppService) domain.BrandService {
+	return &brandService{brandRepo: br, uow: uow, appService: app}
 }
 
-func NewBranchService(br domain.BranchesRepository) domain.BranchService {
-	return &branchService{branchRepo: br}
+func NewBranchService(br domain.BranchesRepository, uow domain.UnitOfWork) domain.BranchService {
+	return &branchService{branchRepo: br, uow: uow}
 }
 
-func NewCampaignService(cr domain.CampaignRepository) domain.CampaignService {
-	return &campaignService{campaignRepo: cr}
+func NewCampaignService(cr domain.CampaignRepository, uow domain.UnitOfWork) domain.CampaignService {
+	return &campaignService{campaignRepo: cr, uow: uow}
 }
 
 func NewRewardService(r domain.RewardRepository) domain.RewardService {
 	return &rewardService{rewardRepo: r}
 }
 
+func NewSettlementService(r domain.SettlementRepository) domain.SettlementService {
+	return &settlementService{settlementRepo: r}
+}
+
 // CreateBrand creates a new brand in the database. It requires a name and password, and returns
 // a new brand object and an error. If the name or password are empty, or if there is an error
 // generating the token or creating the brand, the function returns an error. The function also
 // creates a base campaign for the brand, with a name of "base", a start date of January 1, 2000,
 // and an end date of January 1, 2100. The campaign is created with a point factor and coin factor
-// of 0.001, and a customer count of 0. The campaign status is set to "active".
-func (s *brandService) CreateBrand(name, pass string) (*domain.Brand, error) {
+// of 0.001, and a customer count of 0. The campaign status is set to "active". The brand and
+// its base campaign are created in a single transaction, so a brand is never left without one.
+func (s *brandService) CreateBrand(ctx context.Context, name, pass string) (*domain.Brand, error) {
 
 	if name == "" || pass == "" {
-		return nil, errors.New("name or password are empty")
+		return nil, domain.ErrMissingCredentials
 	}
 
 	passHash := util.HashPassword(pass)
@@ -60,51 +79,48 @@ func (s *brandService) CreateBrand(name, pass string) (*domain.Brand, error) {
 	if err != nil {
 		return nil, errors.New("error generating token")
 	}
-	newBrand, err := s.brandRepo.CreateBrand(name, passHash, token)
-	if err != nil {
-		return nil, err
-	}
-	//generate base campaign
-	baseCampaign := &domain.Campaign{
-		CampaignName:  "base",
-		BrandID:       newBrand.ID,
-		MinValue:      0.0,
-		MaxValue:      1000000000.0,
-		StartDate:     time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
-		EndDate:       time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
-		PointFactor:   0.001,
-		CoinFactor:    0.001,
-		CustomerCount: 0,
-		Status:        "active",
-	}
-
-	_, err = s.campaignRepo.CreateCampaign(baseCampaign, []int{})
+	var newBrand *domain.Brand
+	err = s.uow.Do(ctx, func(repos domain.Repositories) error {
+		newBrand, err = repos.Brands.CreateBrand(ctx, name, passHash, token)
+		if err != nil {
+			return err
+		}
+		//generate base campaign
+		baseCampaign := &domain.Campaign{
+			CampaignName:  "base",
+			BrandID:       newBrand.ID,
+			MinValue:      0.0,
+			MaxValue:      1000000000.0,
+			StartDate:     time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:       time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+			PointFactor:   0.001,
+			CoinFactor:    0.001,
+			CustomerCount: 0,
+			Status:        "active",
+		}
+		_, err = repos.Campaigns.CreateCampaign(ctx, baseCampaign, []int{})
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return newBrand, err
+	return newBrand, nil
 }
 
 // LoginBrand validates a brand's credentials and returns the brand object and a token for authentication, or an error. If the name or password are empty, or if there is an error retrieving the brand or generating the token, the function returns an error. The function also updates the brand's token in the database. If the brand does not exist, or if the password is invalid, the function returns an error.
-func (s *brandService) LoginBrand(name, pass string) (*domain.Brand, error) {
+func (s *brandService) LoginBrand(ctx context.Context, name, pass string) (*domain.Brand, error) {
 
 	if name == "" || pass == "" {
-		return nil, errors.New("name or password are empty")
+		return nil, domain.ErrMissingCredentials
 	}
 
-	b, err := s.brandRepo.GetBrandByName(name)
+	b, err := s.brandRepo.GetBrandByName(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	if b == nil {
-		return nil, errors.New("brand not found")
-	}
-
-	log.Println("brand found:", b)
-
-	if !util.CheckPassHash(pass, b.PassHash) {
-		return nil, errors.New("invalid password")
+	if b == nil || !util.CheckPassHash(pass, b.PassHash) {
+		return nil, domain.ErrInvalidCredentials
 	}
 	// update token
 	newToken, err := util.GenerateToken()
@@ -112,7 +128,7 @@ func (s *brandService) LoginBrand(name, pass string) (*domain.Brand, error) {
 		return nil, errors.New("failed generating token")
 	}
 
-	err = s.brandRepo.UpdateBrandToken(b.ID, newToken)
+	err = s.brandRepo.UpdateBrandToken(ctx, b.ID, newToken)
 	if err != nil {
 		return nil, err
 	}
@@ -120,76 +136,264 @@ func (s *brandService) LoginBrand(name, pass string) (*domain.Brand, error) {
 	return b, nil
 }
 
+// GetBrandByID retrieves a brand by ID.
+// It returns the brand if found, or an error if the brand is not found.
+func (s *brandService) GetBrandByID(ctx context.Context, brandID int) (*domain.Brand, error) {
+	b, err := s.brandRepo.GetBrandByID(ctx, brandID)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, domain.ErrBrandNotFound
+	}
+	return b, nil
+}
+
 // ValidateToken checks if the provided token matches the stored token for the brand with the given brandID.
 // It returns an error if the brand is not found or if the token is invalid.
 
-func (s *brandService) ValidateToken(brandID int, token string) error {
-	b, err := s.brandRepo.GetBrandByID(brandID)
+func (s *brandService) ValidateToken(ctx context.Context, brandID int, token string) error {
+	b, err := s.brandRepo.GetBrandByID(ctx, brandID)
 	if err != nil {
 		return err
 	}
-	if b == nil {
-		return errors.New("brand not found")
-	}
-	if b.Token != token {
-		return errors.New("invalid token")
+	if b == nil || b.Token != token {
+		return domain.ErrInvalidToken
 	}
 	return nil
 }
 
-// CreateBranch adds a new branch for the specified brand. It takes the brand ID and the branch name as inputs,
-// and returns the newly created branch object or an error. If the branch creation in the repository fails,
-// or if linking the branch to the base campaign fails, it returns an error.
+// GetSettings retrieves the loyalty program settings of the given brand.
+// It returns an error if the brand is not found.
+func (s *brandService) GetSettings(ctx context.Context, brandID int) (*domain.BrandSettings, error) {
+	settings, err := s.brandRepo.GetBrandSettings(ctx, brandID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		return nil, domain.ErrBrandNotFound
+	}
+	return settings, nil
+}
 
-func (s *branchService) CreateBranch(brandID int, branchName string) (*domain.Branch, error) {
+// UpdateSettings stores the loyalty program settings of a brand and publishes them to the
+// brand-settings topic so the customer service applies them. Exchange rates and the daily
+// exchange limit cannot be negative. The settings are saved even if publishing fails, in
+// which case an error is returned so the brand can retry.
+func (s *brandService) UpdateSettings(ctx context.Context, settings *domain.BrandSettings) (*domain.BrandSettings, error) {
+	if settings.CoinsToPointsRate < 0 || settings.PointsToCoinsRate < 0 {
+		return nil, domain.ErrInvalidExchangeRate
+	}
+	if settings.ExchangeDailyLimit < 0 {
+		return nil, domain.ErrInvalidExchangeLimit
+	}
+	if err := s.brandRepo.UpdateBrandSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+	if err := s.appService.SendBrandSettingsEvent(ctx, *settings); err != nil {
+		return nil, errors.New("failed to send brand settings event")
+	}
+	return settings, nil
+}
 
-	newBranch, err := s.branchRepo.CreateBranch(brandID, branchName)
+// CreateBranch adds a new branch for the brand of the given branch, with its name, address,
+// location, timezone and opening hours, and returns the newly created branch object or an
+// error. The timezone defaults to UTC. If the branch creation in the repository fails, or
+// if linking the branch to the base campaign fails, it returns an error and the branch is
+// not created.
+func (s *branchService) CreateBranch(ctx context.Context, branch *domain.Branch) (*domain.Branch, error) {
+	if err := validateBranch(branch); err != nil {
+		return nil, err
+	}
+	var newBranch *domain.Branch
+	err := s.uow.Do(ctx, func(repos domain.Repositories) error {
+		var err error
+		newBranch, err = repos.Branches.CreateBranch(ctx, branch)
+		if err != nil {
+			return err
+		}
+
+		// Step 2: Link the branch to the campaign
+		return repos.Branches.LinkBranchToBaseCampaign(ctx, newBranch)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Step 2: Link the branch to the campaign
-	err = s.branchRepo.LinkBranchToBaseCampaign(newBranch)
+	return newBranch, nil
+}
+
+func (s *branchService) GetBranches(ctx context.Context, brandID int) ([]domain.Branch, error) {
+	return s.branchRepo.GetBranchesByBrandID(ctx, brandID)
+}
+
+// UpdateBranch replaces the name, address, location, timezone and opening hours of a branch
+// of a brand, and returns the updated branch. If the branch is not found, or belongs to
+// another brand, it returns ErrBranchNotFound, and ErrBranchClosed if it is closed.
+func (s *branchService) UpdateBranch(ctx context.Context, branch *domain.Branch) (*domain.Branch, error) {
+	existing, err := s.getBranch(ctx, branch.BrandID, branch.ID)
 	if err != nil {
 		return nil, err
 	}
+	if !existing.Active {
+		return nil, domain.ErrBranchClosed
+	}
+	if err := validateBranch(branch); err != nil {
+		return nil, err
+	}
+	if err := s.branchRepo.UpdateBranch(ctx, branch); err != nil {
+		return nil, err
+	}
+	updated := *branch
+	updated.Active = existing.Active
+	updated.RegistrationDate = existing.RegistrationDate
+	return &updated, nil
+}
 
-	return newBranch, nil
+// DeactivateBranch closes a branch of a brand. Closed branches keep their history, but
+// campaigns cannot be linked to them and their purchases are rejected. Closing a closed
+// branch does nothing. If the branch is not found, or belongs to another brand, it
+// returns ErrBranchNotFound.
+func (s *branchService) DeactivateBranch(ctx context.Context, brandID int, branchID int) error {
+	existing, err := s.getBranch(ctx, brandID, branchID)
+	if err != nil {
+		return err
+	}
+	if !existing.Active {
+		return nil
+	}
+	return s.branchRepo.DeactivateBranch(ctx, branchID)
 }
 
-func (s *branchService) GetBranches(brandID int) ([]domain.Branch, error) {
-	return s.branchRepo.GetBranchesByBrandID(brandID)
+// FindNearestBranches returns the open branches nearest to the point at lat and lng, of
+// every brand or only of brandID if it is not zero. limit defaults to
+// defaultNearestBranches and is capped at maxNearestBranches.
+func (s *branchService) FindNearestBranches(ctx context.Context, lat, lng float64, brandID int, limit int) ([]domain.NearbyBranch, error) {
+	if !validCoordinates(lat, lng) {
+		return nil, domain.ErrInvalidLocation
+	}
+	if limit <= 0 {
+		limit = defaultNearestBranches
+	}
+	limit = min(limit, maxNearestBranches)
+	return s.branchRepo.GetNearestBranches(ctx, lat, lng, brandID, limit)
+}
+
+// getBranch returns a branch of a brand, or ErrBranchNotFound.
+func (s *branchService) getBranch(ctx context.Context, brandID int, branchID int) (*domain.Branch, error) {
+	branch, err := s.branchRepo.GetBranchByID(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+	if branch == nil || branch.BrandID != brandID {
+		return nil, domain.ErrBranchNotFound
+	}
+	return branch, nil
+}
+
+// validateBranch checks the location, timezone and opening hours of a branch, setting the
+// timezone to UTC if it is empty.
+func validateBranch(branch *domain.Branch) error {
+	if (branch.Latitude == nil) != (branch.Longitude == nil) {
+		return domain.ErrInvalidLocation
+	}
+	if branch.Latitude != nil && !validCoordinates(*branch.Latitude, *branch.Longitude) {
+		return domain.ErrInvalidLocation
+	}
+	if branch.Timezone == "" {
+		branch.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(branch.Timezone); err != nil {
+		return domain.ErrInvalidTimezone
+	}
+	for _, h := range branch.OpeningHours {
+		if h.Day < time.Sunday || h.Day > time.Saturday {
+			return domain.ErrInvalidOpeningHours
+		}
+		opens, err := time.Parse("15:04", h.Open)
+		if err != nil {
+			return domain.ErrInvalidOpeningHours
+		}
+		closes, err := time.Parse("15:04", h.Close)
+		if err != nil || !opens.Before(closes) {
+			return domain.ErrInvalidOpeningHours
+		}
+	}
+	return nil
+}
+
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// checkBranches returns ErrInvalidBranch if some of the branches are not of the brand, and
+// ErrBranchClosed if some are closed, so campaigns and staff are only linked to the open
+// branches of their brand.
+func checkBranches(ctx context.Context, branchRepo domain.BranchesRepository, brandID int, branchIDs []int) error {
+	branches, err := branchRepo.GetBranchesByBrandID(ctx, brandID)
+	if err != nil {
+		return err
+	}
+	for _, id := range branchIDs {
+		i := slices.IndexFunc(branches, func(b domain.Branch) bool { return b.ID == id })
+		if i < 0 {
+			return domain.ErrInvalidBranch
+		}
+		if !branches[i].Active {
+			return domain.ErrBranchClosed
+		}
+	}
+	return nil
 }
 
 // CreateCampaign creates a new campaign in the database. It takes a campaign object and a list of
 // branch IDs as inputs, and returns the newly created campaign object or an error. If the campaign
 // start date is after its end date, it returns an error. The function also creates a new campaign
-// branch for each of the provided branch IDs.
-func (s *campaignService) CreateCampaign(campaign *domain.Campaign, branches []int) (*domain.Campaign, error) {
+// branch for each of the provided branch IDs, in the same transaction as the campaign. The
+// branches must be open branches of the brand.
+func (s *campaignService) CreateCampaign(ctx context.Context, campaign *domain.Campaign, branches []int) (*domain.Campaign, error) {
 
 	if campaign.StartDate.After(campaign.EndDate) {
-		return nil, errors.New("start_date cannot be after end_date")
+		return nil, domain.ErrInvalidDateRange
 	}
-	return s.campaignRepo.CreateCampaign(campaign, branches)
+	var created *domain.Campaign
+	err := s.uow.Do(ctx, func(repos domain.Repositories) error {
+		if err := checkBranches(ctx, repos.Branches, campaign.BrandID, branches); err != nil {
+			return err
+		}
+		var err error
+		created, err = repos.Campaigns.CreateCampaign(ctx, campaign, branches)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
 // UpdateCampaign updates a campaign in the database. It takes a campaign object and a list of
 // branch IDs as inputs, and returns the updated campaign object or an error. If the campaign
 // start date is after its end date, it returns an error. The function also updates the campaign
-// branches by deleting the existing ones and inserting the new ones provided. If the campaign
-// is not found, it returns an error.
-func (s *campaignService) UpdateCampaign(campaign *domain.Campaign, branches []int) (*domain.Campaign, error) {
-	existing, err := s.campaignRepo.GetCampaignByID(campaign.ID)
+// branches by deleting the existing ones and inserting the new ones provided, in a single
+// transaction. If the campaign is not found, or belongs to another brand, it returns
+// ErrCampaignNotFound.
+func (s *campaignService) UpdateCampaign(ctx context.Context, campaign *domain.Campaign, branches []int) (*domain.Campaign, error) {
+	existing, err := s.campaignRepo.GetCampaignByID(ctx, campaign.ID)
 	if err != nil {
 		return nil, err
 	}
-	if existing == nil {
-		return nil, errors.New("campaign not found")
+	if existing == nil || existing.BrandID != campaign.BrandID {
+		return nil, domain.ErrCampaignNotFound
 	}
 	if campaign.StartDate.After(campaign.EndDate) {
-		return nil, errors.New("start_date cannot be after end_date")
+		return nil, domain.ErrInvalidDateRange
 	}
-	err = s.campaignRepo.UpdateCampaign(campaign, branches)
+	err = s.uow.Do(ctx, func(repos domain.Repositories) error {
+		if err := checkBranches(ctx, repos.Branches, campaign.BrandID, branches); err != nil {
+			return err
+		}
+		return repos.Campaigns.UpdateCampaign(ctx, campaign, branches)
+	})
 	return campaign, err
 }
 
@@ -198,15 +402,35 @@ func (s *campaignService) UpdateCampaign(campaign *domain.Campaign, branches []i
 // The function returns a slice of Campaign objects, or an error if there is a problem
 // communicating with the database. The campaigns are sorted in descending order of their start
 // dates.
-func (s *campaignService) GetCampaigns(brandID int) ([]domain.Campaign, error) {
-	return s.campaignRepo.GetCampaignsByBrandID(brandID)
+func (s *campaignService) GetCampaigns(ctx context.Context, brandID int) ([]domain.Campaign, error) {
+	return s.campaignRepo.GetCampaignsByBrandID(ctx, brandID)
+}
+
+// GetCampaign retrieves a campaign of a brand with the IDs of its branches. If the campaign
+// is not found, or belongs to another brand, it returns ErrCampaignNotFound.
+func (s *campaignService) GetCampaign(ctx context.Context, brandID int, campaignID int) (*domain.Campaign, error) {
+	campaign, err := s.campaignRepo.GetCampaignByID(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if campaign == nil || campaign.BrandID != brandID {
+		return nil, domain.ErrCampaignNotFound
+	}
+	branches, err := s.campaignRepo.GetBranchesForCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		campaign.Branches = append(campaign.Branches, b.ID)
+	}
+	return campaign, nil
 }
 
 // CreateReward creates a new reward in the database. It takes a reward object as input, and returns
 // the newly created reward object or an error. The function also sets the reward ID of the provided
 // reward object to the newly created reward ID.
-func (r *rewardService) CreateReward(reward *domain.Reward) (*domain.Reward, error) {
-	return r.rewardRepo.CreateReward(reward)
+func (r *rewardService) CreateReward(ctx context.Context, reward *domain.Reward) (*domain.Reward, error) {
+	return r.rewardRepo.CreateReward(ctx, reward)
 }
 
 // GetRewardsByBrand retrieves all rewards for a given brand ID from the database.
@@ -214,6 +438,80 @@ func (r *rewardService) CreateReward(reward *domain.Reward) (*domain.Reward, err
 // The function returns a slice of Reward objects, or an error if there is a problem
 // communicating with the database. The rewards are sorted in descending order of their start
 // dates.
-func (r *rewardService) GetRewardsByBrand(brandID int) ([]domain.Reward, error) {
-	return r.rewardRepo.GetRewardsByBrand(brandID)
+func (r *rewardService) GetRewardsByBrand(ctx context.Context, brandID int) ([]domain.Reward, error) {
+	return r.rewardRepo.GetRewardsByBrand(ctx, brandID)
+}
+
+// GetStatement builds the coin settlement statement of a brand for a monthly period in
+// "yyyy-mm" format (the current month when empty).
+//
+// Coins are fungible, so the coins consumed at each brand are funded by every issuer in
+// proportion to the coins it issued in the period. The brand's payables are its share of
+// the coins consumed at other brands, and its receivables are the other issuers' shares of
+// the coins consumed at the brand. NetAmount is receivables minus payables.
+func (s *settlementService) GetStatement(ctx context.Context, brandID int, period string) (*domain.SettlementStatement, error) {
+	start, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	end := start.AddDate(0, 1, 0)
+
+	positions, err := s.settlementRepo.GetPositions(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &domain.SettlementStatement{
+		BrandID:     brandID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Position:    domain.SettlementPosition{BrandID: brandID},
+	}
+
+	totalIssued := 0
+	for _, p := range positions {
+		totalIssued += p.Issued
+		if p.BrandID == brandID {
+			statement.Position = p
+		}
+	}
+	if totalIssued == 0 {
+		return statement, nil
+	}
+
+	own := statement.Position
+	for _, p := range positions {
+		if p.BrandID == brandID {
+			continue
+		}
+		// Our share of the coins consumed at the other brand.
+		if payable := float64(p.Consumed) * float64(own.Issued) / float64(totalIssued); payable > 0 {
+			statement.Payables = append(statement.Payables, domain.SettlementObligation{
+				DebtorBrandID: brandID, CreditorBrandID: p.BrandID, Coins: payable,
+			})
+			statement.NetAmount -= payable
+		}
+		// The other brand's share of the coins consumed with us.
+		if receivable := float64(own.Consumed) * float64(p.Issued) / float64(totalIssued); receivable > 0 {
+			statement.Receivables = append(statement.Receivables, domain.SettlementObligation{
+				DebtorBrandID: p.BrandID, CreditorBrandID: brandID, Coins: receivable,
+			})
+			statement.NetAmount += receivable
+		}
+	}
+	return statement, nil
+}
+
+// parsePeriod parses a "yyyy-mm" period into the first instant of that month in UTC.
+// An empty period means the current month.
+func parsePeriod(period string) (time.Time, error) {
+	if period == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, domain.ErrInvalidPeriod
+	}
+	return start, nil
 }
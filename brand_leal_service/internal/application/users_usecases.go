@@ -0,0 +1,220 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/util"
+)
+
+type brandUserService struct {
+	userRepo   domain.BrandUserRepository
+	brandRepo  domain.BrandsRepository
+	branchRepo domain.BranchesRepository
+	uow        domain.UnitOfWork
+}
+
+func NewBrandUserService(ur domain.BrandUserRepository, br domain.BrandsRepository, bbr domain.BranchesRepository, uow domain.UnitOfWork) domain.BrandUserService {
+	return &brandUserService{userRepo: ur, brandRepo: br, branchRepo: bbr, uow: uow}
+}
+
+// InviteUser invites the owner of an email to the staff of a brand with a role. Branch
+// managers and cashiers need at least one branch, all of them open branches of the brand;
+// the other roles work with every branch and get none. The invitation is returned with
+// the code the invitee accepts it with.
+func (s *brandUserService) InviteUser(ctx context.Context, brandID int, email string, role string, branchIDs []int) (*domain.BrandUserInvitation, error) {
+	if !domain.ValidRole(role) {
+		return nil, domain.ErrInvalidRole
+	}
+	if !domain.BranchScoped(role) {
+		branchIDs = nil
+	} else if len(branchIDs) == 0 {
+		return nil, domain.ErrBranchesRequired
+	}
+	if err := checkBranches(ctx, s.branchRepo, brandID, branchIDs); err != nil {
+		return nil, err
+	}
+
+	email = strings.ToLower(email)
+	existing, err := s.userRepo.GetUserByEmail(ctx, brandID, email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, domain.ErrBrandUserTaken
+	}
+
+	code, err := util.GenerateToken()
+	if err != nil {
+		return nil, errors.New("error generating invitation code")
+	}
+	return s.userRepo.CreateInvitation(ctx, &domain.BrandUserInvitation{
+		BrandID:   brandID,
+		Email:     email,
+		Role:      role,
+		BranchIDs: branchIDs,
+		Code:      code,
+	})
+}
+
+// AcceptInvitation creates the member of the staff invited with code, with the given name
+// and password, and returns it with its token. The invitation is accepted in the same
+// transaction, so it can only be used once.
+func (s *brandUserService) AcceptInvitation(ctx context.Context, code string, name string, pass string) (*domain.BrandUser, error) {
+	if name == "" || pass == "" {
+		return nil, domain.ErrMissingCredentials
+	}
+	token, err := util.GenerateToken()
+	if err != nil {
+		return nil, errors.New("error generating token")
+	}
+
+	var user *domain.BrandUser
+	err = s.uow.Do(ctx, func(repos domain.Repositories) error {
+		inv, err := repos.Users.GetInvitationByCode(ctx, code)
+		if err != nil {
+			return err
+		}
+		if inv == nil {
+			return domain.ErrInvitationNotFound
+		}
+		if inv.Status != domain.InvitationPending {
+			return domain.ErrInvitationNotPending
+		}
+		user, err = repos.Users.CreateUser(ctx, &domain.BrandUser{
+			BrandID:   inv.BrandID,
+			Name:      name,
+			Email:     inv.Email,
+			Role:      inv.Role,
+			BranchIDs: inv.BranchIDs,
+			PassHash:  util.HashPassword(pass),
+			Token:     token,
+		})
+		if err != nil {
+			return err
+		}
+		return repos.Users.UpdateInvitationStatus(ctx, inv.ID, domain.InvitationAccepted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LoginUser authenticates a member of the staff of the brand with the given name by their
+// email and password, and returns it with a new token.
+func (s *brandUserService) LoginUser(ctx context.Context, brandName string, email string, pass string) (*domain.BrandUser, error) {
+	brand, err := s.brandRepo.GetBrandByName(ctx, brandName)
+	if err != nil {
+		return nil, err
+	}
+	if brand == nil {
+		return nil, domain.ErrInvalidUserCredentials
+	}
+	user, err := s.userRepo.GetUserByEmail(ctx, brand.ID, strings.ToLower(email))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active || !util.CheckPassHash(pass, user.PassHash) {
+		return nil, domain.ErrInvalidUserCredentials
+	}
+
+	token, err := util.GenerateToken()
+	if err != nil {
+		return nil, errors.New("failed generating token")
+	}
+	if err := s.userRepo.UpdateUserToken(ctx, user.ID, token); err != nil {
+		return nil, err
+	}
+	user.Token = token
+	return user, nil
+}
+
+// ValidateToken returns the member of the staff of the brand with the given ID, if the
+// token is theirs and they are still active.
+func (s *brandUserService) ValidateToken(ctx context.Context, brandID int, userID int, token string) (*domain.BrandUser, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.BrandID != brandID || !user.Active || user.Token == "" || user.Token != token {
+		return nil, domain.ErrInvalidToken
+	}
+	return user, nil
+}
+
+// GetUsers returns the staff of a brand.
+func (s *brandUserService) GetUsers(ctx context.Context, brandID int) ([]domain.BrandUser, error) {
+	return s.userRepo.GetUsersByBrandID(ctx, brandID)
+}
+
+// ChangeUserRole gives a member of the staff of a brand a new role. Branch managers and
+// cashiers need at least one branch, all of them open branches of the brand; the other
+// roles work with every branch and get none. The new role applies to their next request.
+func (s *brandUserService) ChangeUserRole(ctx context.Context, brandID int, userID int, role string, branchIDs []int) (*domain.BrandUser, error) {
+	if !domain.ValidRole(role) {
+		return nil, domain.ErrInvalidRole
+	}
+	if !domain.BranchScoped(role) {
+		branchIDs = nil
+	} else if len(branchIDs) == 0 {
+		return nil, domain.ErrBranchesRequired
+	}
+	if err := checkBranches(ctx, s.branchRepo, brandID, branchIDs); err != nil {
+		return nil, err
+	}
+
+	user, err := s.activeUser(ctx, brandID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateUserRole(ctx, user.ID, role, branchIDs); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	user.BranchIDs = branchIDs
+	return user, nil
+}
+
+// DeactivateUser removes a member from the staff of a brand. Their token stops working at
+// once and they can no longer log in.
+func (s *brandUserService) DeactivateUser(ctx context.Context, brandID int, userID int) error {
+	user, err := s.activeUser(ctx, brandID, userID)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.DeactivateUser(ctx, user.ID)
+}
+
+// RevokeInvitation revokes a pending invitation to the staff of a brand, so its code can
+// no longer be accepted. The invitation is locked while it is revoked, so it cannot be
+// accepted at the same time.
+func (s *brandUserService) RevokeInvitation(ctx context.Context, brandID int, invitationID int) error {
+	return s.uow.Do(ctx, func(repos domain.Repositories) error {
+		inv, err := repos.Users.GetInvitationByID(ctx, invitationID)
+		if err != nil {
+			return err
+		}
+		if inv == nil || inv.BrandID != brandID {
+			return domain.ErrInvitationNotFound
+		}
+		if inv.Status != domain.InvitationPending {
+			return domain.ErrInvitationNotPending
+		}
+		return repos.Users.UpdateInvitationStatus(ctx, inv.ID, domain.InvitationRevoked)
+	})
+}
+
+// activeUser returns the active member of the staff of the brand with the given ID.
+func (s *brandUserService) activeUser(ctx context.Context, brandID int, userID int) (*domain.BrandUser, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.BrandID != brandID || !user.Active {
+		return nil, domain.ErrBrandUserNotFound
+	}
+	return user, nil
+}
@@ -10,13 +10,52 @@ type Brand struct {
 	RegistrationDate time.Time
 }
 
+// BrandSettings holds the loyalty program options a brand controls and that
+// are shared with the customer service.
+//
+// Exchange rates are the amount received per unit given: CoinsToPointsRate is
+// brand points per Leal coin and PointsToCoinsRate is Leal coins per brand point.
+// A zero rate disables that direction. ExchangeDailyLimit caps the coins a customer
+// can exchange with the brand per day, zero meaning no limit.
+type BrandSettings struct {
+	BrandID             int
+	AllowPointsTransfer bool
+	CoinsToPointsRate   float64
+	PointsToCoinsRate   float64
+	ExchangeDailyLimit  int
+}
+
+// Branch is a store of a brand. Closed branches are kept, with Active false, so that
+// their history stays, but campaigns cannot be linked to them and their purchases are
+// rejected. Latitude and Longitude are nil until the branch is located.
+// OpeningHours are in the Timezone of the branch, an IANA name such as America/Bogota.
 type Branch struct {
 	ID               int
 	BrandID          int
 	Name             string
+	Active           bool
+	Address          string
+	Latitude         *float64
+	Longitude        *float64
+	Timezone         string
+	OpeningHours     []OpeningHours
 	RegistrationDate time.Time
 }
 
+// OpeningHours is the time a branch opens and closes on a day of the week, as hh:mm.
+type OpeningHours struct {
+	Day   time.Weekday
+	Open  string
+	Close string
+}
+
+// NearbyBranch is a branch found by the branch locator, with its distance in kilometers
+// to the searched point.
+type NearbyBranch struct {
+	Branch
+	DistanceKm float64
+}
+
 type Campaign struct {
 	ID            int
 	CampaignName  string
@@ -32,6 +71,43 @@ type Campaign struct {
 	Branches      []int
 }
 
+// BrandUser is a member of the staff of a brand, who logs in with their own email and
+// password instead of the credentials of the brand. Branch managers and cashiers only
+// work with the branches in BranchIDs. Deactivated members are no longer Active and
+// cannot log in or use their token.
+type BrandUser struct {
+	ID               int
+	BrandID          int
+	Name             string
+	Email            string
+	Role             string
+	BranchIDs        []int
+	PassHash         string
+	Token            string
+	Active           bool
+	RegistrationDate time.Time
+}
+
+// BrandUserInvitation invites someone to join the staff of a brand with a role. The
+// invitee accepts it with Code, choosing their name and password, while it is pending.
+// Pending invitations can be revoked.
+type BrandUserInvitation struct {
+	ID          int
+	BrandID     int
+	Email       string
+	Role        string
+	BranchIDs   []int
+	Code        string
+	Status      string
+	CreatedDate time.Time
+}
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
 type Reward struct {
 	ID          int
 	BrandId     int
@@ -50,10 +126,147 @@ type Purchase struct {
 	CoinsUsed    int
 }
 
+// PurchaseRejection is sent back to the customer service for a purchase that cannot be
+// rewarded, with the Reason why, so it rejects the purchase and refunds the coins used.
+type PurchaseRejection struct {
+	PurchaseID int
+	CustomerID int
+	BrandID    int
+	BranchID   int
+	CoinsUsed  int
+	Reason     string
+}
+
+// Exchange is a conversion of Leal coins into points of a brand, or of points of a brand
+// into coins, made by a customer in the customer service.
+type Exchange struct {
+	ID         int
+	CustomerID int
+	BrandID    int
+	Direction  string
+	Coins      int
+	Points     int
+	Date       time.Time
+}
+
+// Directions of an exchange.
+const (
+	ExchangeCoinsToPoints = "coins_to_points"
+	ExchangePointsToCoins = "points_to_coins"
+)
+
+// Reasons a purchase is rejected.
+const (
+	RejectBranchNotFound     = "branch_not_found"
+	RejectBranchOfOtherBrand = "branch_of_other_brand"
+	RejectBranchClosed       = "branch_closed"
+	RejectNoBaseCampaign     = "no_base_campaign"
+	RejectProcessingFailed   = "processing_failed"
+)
+
+// LealPointsApply are the points and coins a customer earns at a brand. For a purchase,
+// PurchaseID is set and Breakdown holds what each campaign issued towards them.
 type LealPointsApply struct {
+	PurchaseID int
 	CustomerID int
 	BrandID    int
 	Points     int
 	Coins      int
 	Reason     string
+	Breakdown  []RewardBreakdown
+}
+
+// RewardBreakdown is what a campaign issued for a purchase.
+type RewardBreakdown struct {
+	CampaignID   int
+	CampaignName string
+	Points       float64
+	Coins        float64
+}
+
+const (
+	SettlementIssued   = "issued"
+	SettlementConsumed = "consumed"
+)
+
+// SettlementEntry records Leal coins issued by a brand on a purchase (through its
+// campaigns' CoinFactor) or consumed at a brand (coins used to pay a purchase), or coins
+// exchanged with a brand: consumed when exchanged for its points, issued when given for
+// them. PurchaseID or ExchangeID is the operation the entry comes from; the other is zero.
+type SettlementEntry struct {
+	ID         int
+	BrandID    int
+	EntryType  string
+	Coins      int
+	PurchaseID int
+	ExchangeID int
+	CustomerID int
+	EntryDate  time.Time
+}
+
+// SettlementPosition is the coins a brand issued and consumed in a period.
+// Net is Consumed minus Issued: positive means the network owes the brand.
+type SettlementPosition struct {
+	BrandID  int
+	Issued   int
+	Consumed int
+	Net      int
+}
+
+// SettlementObligation is the coins a debtor brand owes a creditor brand for a period.
+type SettlementObligation struct {
+	DebtorBrandID   int
+	CreditorBrandID int
+	Coins           float64
+}
+
+// SettlementStatement summarizes a brand's coin settlement for a period.
+// Coins consumed at a brand are funded by every issuer in proportion to the coins
+// it issued in the period, which gives the payables and receivables of the brand.
+type SettlementStatement struct {
+	BrandID     int
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Position    SettlementPosition
+	Payables    []SettlementObligation
+	Receivables []SettlementObligation
+	NetAmount   float64
+}
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key header.
+// Scope identifies the endpoint and caller the key belongs to, and RequestHash the request
+// it was first used with. StatusCode is 0 while the original request is still in progress.
+type IdempotencyRecord struct {
+	Scope        string
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedDate  time.Time
+}
+
+// PrincipalKind is the kind of caller of a request.
+type PrincipalKind string
+
+const (
+	PrincipalCustomer PrincipalKind = "customer"
+	PrincipalBrand    PrincipalKind = "brand"
+	PrincipalService  PrincipalKind = "service"
+)
+
+// Principal is the authenticated caller of a request. ID is the customer or brand the
+// request acts for; for another service, Service is its name and ID the customer or brand
+// it acts for.
+//
+// UserID is the staff member of the brand calling, with their Role and, for branch
+// managers and cashiers, the branches they work with. The brand credentials and other
+// services have no user and act as the owner.
+type Principal struct {
+	Kind      PrincipalKind
+	ID        int
+	Service   string
+	UserID    int
+	Role      string
+	BranchIDs []int
 }
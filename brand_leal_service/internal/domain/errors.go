@@ -0,0 +1,107 @@
+package domain
+
+import "errors"
+
+// Kind classifies the errors of the domain, so that adapters such as the HTTP layer can
+// report them without knowing each one.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindInsufficientBalance
+)
+
+// Error is an error of the domain. Code is stable and meant for clients, such as
+// "brand_not_found"; Message describes the error for people and may change.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is a domain error with the same code, so that errors.Is matches
+// the errors below even when they are created again with another message.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Validation(code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func InsufficientBalance(code, message string) *Error {
+	return &Error{Kind: KindInsufficientBalance, Code: code, Message: message}
+}
+
+// AsError returns the domain error in the chain of err, or nil if there is none, in which
+// case err is an internal error.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+var (
+	ErrBrandNotFound      = NotFound("brand_not_found", "brand not found")
+	ErrBranchNotFound     = NotFound("branch_not_found", "branch not found")
+	ErrCampaignNotFound   = NotFound("campaign_not_found", "campaign not found")
+	ErrInvitationNotFound = NotFound("invitation_not_found", "invitation not found")
+	ErrBrandUserNotFound  = NotFound("brand_user_not_found", "member of the staff not found")
+
+	ErrBrandNameTaken       = Conflict("brand_name_taken", "brand name is already registered")
+	ErrBranchNameTaken      = Conflict("branch_name_taken", "the brand already has a branch with that name")
+	ErrBrandUserTaken       = Conflict("brand_user_taken", "email already belongs to the staff of the brand")
+	ErrInvitationNotPending = Conflict("invitation_not_pending", "invitation is no longer pending")
+
+	ErrInvalidRequest       = Validation("invalid_request", "invalid request")
+	ErrMissingCredentials   = Validation("missing_credentials", "name or password are empty")
+	ErrInvalidDateRange     = Validation("invalid_date_range", "start_date cannot be after end_date")
+	ErrInvalidExchangeRate  = Validation("invalid_exchange_rate", "exchange rates cannot be negative")
+	ErrInvalidExchangeLimit = Validation("invalid_exchange_limit", "exchange_daily_limit cannot be negative")
+	ErrInvalidPeriod        = Validation("invalid_period", "period must have the format yyyy-mm")
+	ErrInvalidRole          = Validation("invalid_role", "role must be owner, marketing_manager, branch_manager or cashier")
+	ErrBranchesRequired     = Validation("branches_required", "branch managers and cashiers need at least one branch")
+	ErrInvalidBranch        = Validation("invalid_branch", "branch does not belong to the brand")
+	ErrBranchClosed         = Validation("branch_closed", "branch is closed")
+	ErrInvalidLocation      = Validation("invalid_location", "latitude and longitude must be given together and be valid coordinates")
+	ErrInvalidTimezone      = Validation("invalid_timezone", "timezone must be an IANA time zone, such as America/Bogota")
+	ErrInvalidOpeningHours  = Validation("invalid_opening_hours", "opening hours need a day from 0 to 6 and open before close, as hh:mm")
+
+	ErrInvalidCredentials        = Unauthorized("invalid_credentials", "invalid brand name or password")
+	ErrInvalidUserCredentials    = Unauthorized("invalid_credentials", "invalid brand name, email or password")
+	ErrMissingAuthentication     = Unauthorized("missing_authentication", "brand_id and token headers are required")
+	ErrInvalidToken              = Unauthorized("invalid_token", "invalid brand_id or token")
+	ErrInvalidServiceCredentials = Unauthorized("invalid_service_credentials", "invalid service name or token")
+
+	ErrPermissionDenied = Forbidden("permission_denied", "the role of the user does not allow this action")
+	ErrBranchNotAllowed = Forbidden("branch_not_allowed", "the user does not work with some of the branches")
+	ErrBaseCampaign     = Forbidden("base_campaign_not_allowed", "only brand-wide users can modify the base campaign")
+)
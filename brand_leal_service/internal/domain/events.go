@@ -1,9 +1,61 @@
 package domain
 
+import (
+	"context"
+	"time"
+
+	"github.com/degarzonm/leal_contracts/events"
+)
+
+// Event types, carried in the event-type header and the envelope of every message.
+// They are defined by the shared contracts module.
+const (
+	EventPurchaseCreated      = events.TypePurchaseCreated
+	EventPointsApply          = events.TypePointsApply
+	EventBrandSettingsUpdated = events.TypeBrandSettingsUpdated
+	EventPurchaseRejected     = events.TypePurchaseRejected
+	EventExchangeCompleted    = events.TypeExchangeCompleted
+)
+
+// Fields an event can be partitioned by. Each topic is keyed by one of them, so the events
+// of the same customer (or brand) land on the same partition and are consumed in order.
+const (
+	KeyCustomerID = "customer_id"
+	KeyBrandID    = "brand_id"
+)
+
+// Event is a message published to the broker. Keys holds the values of the partition key
+// fields the event has, and CorrelationID ties together the events caused by the same
+// original request.
+type Event struct {
+	Type          string
+	CorrelationID string
+	Keys          map[string]string
+	Payload       interface{}
+}
+
+// OutboxEvent is an event stored in the transaction of the changes that caused it, to be
+// sent to Topic once that transaction commits. TraceHeaders holds the trace context of the
+// request that caused it.
+type OutboxEvent struct {
+	ID           int64
+	Topic        string
+	Event        Event
+	TraceHeaders map[string]string
+}
+
+// EventMetadata is the information read from the headers of a consumed message.
+type EventMetadata struct {
+	Type          string
+	SchemaVersion string
+	CorrelationID string
+	ProducedAt    time.Time
+}
+
 type EventProducer interface {
-	SendMessage(topic string, message interface{}) error
+	SendEvent(ctx context.Context, topic string, event Event) error
 }
 
 type EventListener interface {
-	Listen() error
+	Listen(ctx context.Context) error
 }
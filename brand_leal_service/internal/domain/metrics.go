@@ -0,0 +1,11 @@
+package domain
+
+// BusinessMetrics records business events for monitoring.
+type BusinessMetrics interface {
+	// PurchaseProcessed records a purchase turned into points and coins.
+	PurchaseProcessed(brandID int)
+	// PurchaseRejected records a purchase rejected for the given reason.
+	PurchaseRejected(brandID int, reason string)
+	// RewardIssued records the points and coins a campaign issued for a purchase.
+	RewardIssued(brandID int, campaignID int, points float64, coins float64)
+}
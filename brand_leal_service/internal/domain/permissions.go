@@ -0,0 +1,69 @@
+package domain
+
+import "slices"
+
+// Roles of the staff of a brand.
+const (
+	RoleOwner            = "owner"
+	RoleMarketingManager = "marketing_manager"
+	RoleBranchManager    = "branch_manager"
+	RoleCashier          = "cashier"
+)
+
+// Permission is an action on the resources of a brand.
+type Permission string
+
+const (
+	PermViewBranches    Permission = "view_branches"
+	PermManageBranches  Permission = "manage_branches"
+	PermViewCampaigns   Permission = "view_campaigns"
+	PermManageCampaigns Permission = "manage_campaigns"
+	PermViewRewards     Permission = "view_rewards"
+	PermManageRewards   Permission = "manage_rewards"
+	PermManageSettings  Permission = "manage_settings"
+	PermViewSettlement  Permission = "view_settlement"
+	PermManageUsers     Permission = "manage_users"
+)
+
+// rolePermissions are the permissions of each role. Owners can do everything; marketing
+// managers run the campaigns and rewards of every branch; branch managers run the
+// campaigns of their branches, and cashiers can only look them up.
+var rolePermissions = map[string][]Permission{
+	RoleOwner: {
+		PermViewBranches, PermManageBranches, PermViewCampaigns, PermManageCampaigns, PermViewRewards,
+		PermManageRewards, PermManageSettings, PermViewSettlement, PermManageUsers,
+	},
+	RoleMarketingManager: {PermViewBranches, PermViewCampaigns, PermManageCampaigns, PermViewRewards, PermManageRewards},
+	RoleBranchManager:    {PermViewBranches, PermViewCampaigns, PermManageCampaigns, PermViewRewards},
+	RoleCashier:          {PermViewBranches, PermViewCampaigns, PermViewRewards},
+}
+
+// ValidRole reports whether role is one of the roles of the staff.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// BranchScoped reports whether the users with role only work with some branches.
+func BranchScoped(role string) bool {
+	return role == RoleBranchManager || role == RoleCashier
+}
+
+// Can reports whether the role of the principal has the permission.
+func (p *Principal) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[p.Role], perm)
+}
+
+// CanAccessBranches reports whether the principal works with every one of the branches.
+// Only branch managers and cashiers are limited to some branches.
+func (p *Principal) CanAccessBranches(branchIDs []int) bool {
+	if !BranchScoped(p.Role) {
+		return true
+	}
+	for _, id := range branchIDs {
+		if !slices.Contains(p.BranchIDs, id) {
+			return false
+		}
+	}
+	return true
+}
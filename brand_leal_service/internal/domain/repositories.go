@@ -1,30 +1,93 @@
 package domain
 
+import (
+	"context"
+	"time"
+)
+
 type BrandsRepository interface {
-	GetBrandByID(id int) (*Brand, error)
-	GetBrandByName(brandName string) (*Brand, error)
-	CreateBrand(brandName, passHash, token string) (*Brand, error)
-	UpdateBrandToken(brandID int, token string) error
+	GetBrandByID(ctx context.Context, id int) (*Brand, error)
+	GetBrandByName(ctx context.Context, brandName string) (*Brand, error)
+	CreateBrand(ctx context.Context, brandName, passHash, token string) (*Brand, error)
+	UpdateBrandToken(ctx context.Context, brandID int, token string) error
+	GetBrandSettings(ctx context.Context, brandID int) (*BrandSettings, error)
+	UpdateBrandSettings(ctx context.Context, settings *BrandSettings) error
 }
 
 type BranchesRepository interface {
-	CreateBranch(brandID int, branchName string) (*Branch, error)
-	GetBranchesByBrandID(brandID int) ([]Branch, error)
-	LinkBranchToBaseCampaign(branchID *Branch) error
+	CreateBranch(ctx context.Context, branch *Branch) (*Branch, error)
+	GetBranchByID(ctx context.Context, id int) (*Branch, error)
+	GetBranchesByBrandID(ctx context.Context, brandID int) ([]Branch, error)
+	UpdateBranch(ctx context.Context, branch *Branch) error
+	DeactivateBranch(ctx context.Context, id int) error
+	GetNearestBranches(ctx context.Context, lat, lng float64, brandID int, limit int) ([]NearbyBranch, error)
+	LinkBranchToBaseCampaign(ctx context.Context, branchID *Branch) error
 }
 
 type CampaignRepository interface {
-	CreateCampaign(c *Campaign, branchIDs []int) (*Campaign, error)
-	GetCampaignByID(id int) (*Campaign, error)
-	UpdateCampaign(c *Campaign, branchIDs []int) error
-	UpdateCustomerCountCampaign(c *Campaign) error
-	GetCampaignsByBrandID(brandID int) ([]Campaign, error)
-	GetBranchesForCampaign(campaignID int) ([]Branch, error)
-	GetCampaignsForBranch(branchID int) ([]Campaign, error)
-	GetBaseCampaignForBrand(brandID int) (*Campaign, error)
+	CreateCampaign(ctx context.Context, c *Campaign, branchIDs []int) (*Campaign, error)
+	GetCampaignByID(ctx context.Context, id int) (*Campaign, error)
+	UpdateCampaign(ctx context.Context, c *Campaign, branchIDs []int) error
+	UpdateCustomerCountCampaign(ctx context.Context, c *Campaign, purchaseID int) error
+	GetCampaignsByBrandID(ctx context.Context, brandID int) ([]Campaign, error)
+	GetBranchesForCampaign(ctx context.Context, campaignID int) ([]Branch, error)
+	GetCampaignsForBranch(ctx context.Context, branchID int) ([]Campaign, error)
+	GetBaseCampaignForBrand(ctx context.Context, brandID int) (*Campaign, error)
 }
 
 type RewardRepository interface {
-	CreateReward(r *Reward) (*Reward, error)
-	GetRewardsByBrand(id int) ([]Reward, error)
+	CreateReward(ctx context.Context, r *Reward) (*Reward, error)
+	GetRewardsByBrand(ctx context.Context, id int) ([]Reward, error)
+}
+
+type BrandUserRepository interface {
+	CreateUser(ctx context.Context, u *BrandUser) (*BrandUser, error)
+	GetUserByID(ctx context.Context, id int) (*BrandUser, error)
+	GetUserByEmail(ctx context.Context, brandID int, email string) (*BrandUser, error)
+	GetUsersByBrandID(ctx context.Context, brandID int) ([]BrandUser, error)
+	UpdateUserRole(ctx context.Context, id int, role string, branchIDs []int) error
+	DeactivateUser(ctx context.Context, id int) error
+	UpdateUserToken(ctx context.Context, id int, token string) error
+	CreateInvitation(ctx context.Context, inv *BrandUserInvitation) (*BrandUserInvitation, error)
+	GetInvitationByCode(ctx context.Context, code string) (*BrandUserInvitation, error)
+	GetInvitationByID(ctx context.Context, id int) (*BrandUserInvitation, error)
+	UpdateInvitationStatus(ctx context.Context, id int, status string) error
+}
+
+type SettlementRepository interface {
+	RecordEntry(ctx context.Context, entry *SettlementEntry) error
+	GetPositions(ctx context.Context, from, to time.Time) ([]SettlementPosition, error)
+}
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *IdempotencyRecord, expiredBefore time.Time) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	Release(ctx context.Context, scope string, key string) error
+}
+
+// OutboxRepository stores events in the transaction of the changes that cause them, so
+// that an event is sent if and only if those changes commit.
+type OutboxRepository interface {
+	AddEvent(ctx context.Context, topic string, event Event) error
+	GetPendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	RecordFailure(ctx context.Context, id int64, reason string) error
+	DeleteEvent(ctx context.Context, id int64) error
+}
+
+// Repositories groups the repositories handed to a unit of work. All of them run in the
+// same database transaction.
+type Repositories struct {
+	Brands     BrandsRepository
+	Branches   BranchesRepository
+	Campaigns  CampaignRepository
+	Rewards    RewardRepository
+	Settlement SettlementRepository
+	Users      BrandUserRepository
+	Outbox     OutboxRepository
+}
+
+// UnitOfWork runs a group of repository operations atomically. Do commits the work when
+// fn returns nil and rolls it back when fn returns an error or ctx is cancelled.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(repos Repositories) error) error
 }
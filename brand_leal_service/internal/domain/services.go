@@ -1,23 +1,47 @@
 package domain
 
+import "context"
+
 type BrandService interface {
-	CreateBrand(name, pass string) (*Brand, error)
-	LoginBrand(name, pass string) (*Brand, error)
-	ValidateToken(brandID int, token string) error
+	CreateBrand(ctx context.Context, name, pass string) (*Brand, error)
+	LoginBrand(ctx context.Context, name, pass string) (*Brand, error)
+	GetBrandByID(ctx context.Context, brandID int) (*Brand, error)
+	ValidateToken(ctx context.Context, brandID int, token string) error
+	GetSettings(ctx context.Context, brandID int) (*BrandSettings, error)
+	UpdateSettings(ctx context.Context, settings *BrandSettings) (*BrandSettings, error)
 }
 
 type BranchService interface {
-	CreateBranch(brandID int, branchName string) (*Branch, error)
-	GetBranches(brandID int) ([]Branch, error)
+	CreateBranch(ctx context.Context, branch *Branch) (*Branch, error)
+	GetBranches(ctx context.Context, brandID int) ([]Branch, error)
+	UpdateBranch(ctx context.Context, branch *Branch) (*Branch, error)
+	DeactivateBranch(ctx context.Context, brandID int, branchID int) error
+	FindNearestBranches(ctx context.Context, lat, lng float64, brandID int, limit int) ([]NearbyBranch, error)
 }
 
 type CampaignService interface {
-	CreateCampaign(campaign *Campaign, branchIds []int) (*Campaign, error)
-	UpdateCampaign(campaign *Campaign, branchIds []int) (*Campaign, error)
-	GetCampaigns(brandID int) ([]Campaign, error)
+	CreateCampaign(ctx context.Context, campaign *Campaign, branchIds []int) (*Campaign, error)
+	UpdateCampaign(ctx context.Context, campaign *Campaign, branchIds []int) (*Campaign, error)
+	GetCampaigns(ctx context.Context, brandID int) ([]Campaign, error)
+	GetCampaign(ctx context.Context, brandID int, campaignID int) (*Campaign, error)
+}
+
+type BrandUserService interface {
+	InviteUser(ctx context.Context, brandID int, email string, role string, branchIDs []int) (*BrandUserInvitation, error)
+	AcceptInvitation(ctx context.Context, code string, name string, pass string) (*BrandUser, error)
+	LoginUser(ctx context.Context, brandName string, email string, pass string) (*BrandUser, error)
+	ValidateToken(ctx context.Context, brandID int, userID int, token string) (*BrandUser, error)
+	GetUsers(ctx context.Context, brandID int) ([]BrandUser, error)
+	ChangeUserRole(ctx context.Context, brandID int, userID int, role string, branchIDs []int) (*BrandUser, error)
+	DeactivateUser(ctx context.Context, brandID int, userID int) error
+	RevokeInvitation(ctx context.Context, brandID int, invitationID int) error
 }
 
 type RewardService interface {
-	CreateReward(reward *Reward) (*Reward, error)
-	GetRewardsByBrand(brandID int) ([]Reward, error)
+	CreateReward(ctx context.Context, reward *Reward) (*Reward, error)
+	GetRewardsByBrand(ctx context.Context, brandID int) ([]Reward, error)
+}
+
+type SettlementService interface {
+	GetStatement(ctx context.Context, brandID int, period string) (*SettlementStatement, error)
 }
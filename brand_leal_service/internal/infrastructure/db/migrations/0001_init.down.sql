@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reward;
+DROP TABLE IF EXISTS campaign_branches;
+DROP TABLE IF EXISTS campaign;
+DROP TABLE IF EXISTS branch;
+DROP TABLE IF EXISTS brand;
@@ -63,4 +63,4 @@ CREATE INDEX idx_campaign_branches_campaign_id_branch_id ON campaign_branches(ca
 
 CREATE INDEX idx_reward_brand_id ON reward(brand_id);
 
-CREATE INDEX idx_reward_start_end_date ON reward(start_date, end_date);
\ No newline at end of file
+CREATE INDEX idx_reward_start_end_date ON reward(start_date, end_date);
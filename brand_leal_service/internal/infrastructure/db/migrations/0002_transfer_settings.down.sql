@@ -0,0 +1 @@
+ALTER TABLE brand DROP COLUMN IF EXISTS allow_points_transfer;
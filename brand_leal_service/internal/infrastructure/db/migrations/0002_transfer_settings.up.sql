@@ -0,0 +1,2 @@
+-- Brands opt out of transfers of their points between customers.
+ALTER TABLE brand ADD COLUMN IF NOT EXISTS allow_points_transfer BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,4 @@
+ALTER TABLE brand
+    DROP COLUMN IF EXISTS exchange_daily_limit,
+    DROP COLUMN IF EXISTS points_to_coins_rate,
+    DROP COLUMN IF EXISTS coins_to_points_rate;
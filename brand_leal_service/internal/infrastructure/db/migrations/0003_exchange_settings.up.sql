@@ -0,0 +1,5 @@
+-- Rates and daily limit of the exchanges of coins and points of the brand.
+ALTER TABLE brand
+    ADD COLUMN IF NOT EXISTS coins_to_points_rate DECIMAL(10, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS points_to_coins_rate DECIMAL(10, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS exchange_daily_limit INT NOT NULL DEFAULT 0;
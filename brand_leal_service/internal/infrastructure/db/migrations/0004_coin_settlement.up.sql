@@ -0,0 +1,13 @@
+-- Ledger of the coins each brand issues and consumes, settled monthly between brands.
+CREATE TABLE IF NOT EXISTS coin_settlement_entry (
+    id SERIAL PRIMARY KEY,
+    brand_id INT NOT NULL,
+    entry_type VARCHAR(20) NOT NULL,
+    coins INT NOT NULL,
+    purchase_id INT NOT NULL,
+    customer_id INT NOT NULL,
+    entry_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_settlement_entry_per_purchase UNIQUE (purchase_id, entry_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coin_settlement_entry_date_brand_id ON coin_settlement_entry(entry_date, brand_id);
@@ -0,0 +1,13 @@
+-- Stored responses of the requests sent with an Idempotency-Key header.
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    scope VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INT,
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_key_created_date ON idempotency_key(created_date);
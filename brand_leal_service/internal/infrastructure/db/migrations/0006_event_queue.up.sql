@@ -0,0 +1,11 @@
+-- Queue of the postgres message broker (MSG_BROKER_TYPE=postgres).
+CREATE TABLE IF NOT EXISTS event_queue (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    msg_key VARCHAR(255) NOT NULL DEFAULT '',
+    headers JSONB NOT NULL DEFAULT '{}',
+    payload BYTEA NOT NULL,
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_queue_topic_key ON event_queue(topic, msg_key, id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS brand_user_invitation;
+DROP TABLE IF EXISTS brand_user;
@@ -0,0 +1,27 @@
+-- Staff of the brands, who log in with their own credentials. branch_ids scopes branch
+-- managers and cashiers to some branches.
+CREATE TABLE IF NOT EXISTS brand_user (
+    id SERIAL PRIMARY KEY,
+    brand_id INT NOT NULL REFERENCES brand(id),
+    user_name VARCHAR(100) NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    user_role VARCHAR(30) NOT NULL,
+    branch_ids INT[] NOT NULL DEFAULT '{}',
+    pass_hash VARCHAR(255) NOT NULL,
+    token VARCHAR(255),
+    registration_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_user_per_brand UNIQUE (brand_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS brand_user_invitation (
+    id SERIAL PRIMARY KEY,
+    brand_id INT NOT NULL REFERENCES brand(id),
+    email VARCHAR(100) NOT NULL,
+    user_role VARCHAR(30) NOT NULL,
+    branch_ids INT[] NOT NULL DEFAULT '{}',
+    code VARCHAR(255) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_brand_user_invitation_brand_id ON brand_user_invitation(brand_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_branch_active_location;
+
+ALTER TABLE branch
+    DROP COLUMN IF EXISTS opening_hours,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS address,
+    DROP COLUMN IF EXISTS active;
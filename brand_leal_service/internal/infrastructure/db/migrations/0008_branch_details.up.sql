@@ -0,0 +1,11 @@
+-- Branches can be closed, keeping their history, and carry their address, location,
+-- timezone and opening hours, for the branch locator.
+ALTER TABLE branch
+    ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS address VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS opening_hours JSONB NOT NULL DEFAULT '[]';
+
+CREATE INDEX idx_branch_active_location ON branch(active) WHERE latitude IS NOT NULL;
@@ -0,0 +1,4 @@
+DELETE FROM coin_settlement_entry WHERE exchange_id IS NOT NULL;
+ALTER TABLE coin_settlement_entry DROP CONSTRAINT IF EXISTS unique_settlement_entry_per_exchange;
+ALTER TABLE coin_settlement_entry DROP COLUMN IF EXISTS exchange_id;
+ALTER TABLE coin_settlement_entry ALTER COLUMN purchase_id SET NOT NULL;
@@ -0,0 +1,6 @@
+-- Settlement entries of coin exchanges: coins exchanged for points of a brand are consumed
+-- at it, and coins a brand gives for its points are issued by it.
+ALTER TABLE coin_settlement_entry ADD COLUMN IF NOT EXISTS exchange_id INT;
+ALTER TABLE coin_settlement_entry ALTER COLUMN purchase_id DROP NOT NULL;
+ALTER TABLE coin_settlement_entry DROP CONSTRAINT IF EXISTS unique_settlement_entry_per_exchange;
+ALTER TABLE coin_settlement_entry ADD CONSTRAINT unique_settlement_entry_per_exchange UNIQUE (exchange_id, entry_type);
@@ -0,0 +1 @@
+ALTER TABLE brand_user DROP COLUMN IF EXISTS active;
@@ -0,0 +1,2 @@
+-- Deactivated members of the staff keep their row, for the record, but cannot log in.
+ALTER TABLE brand_user ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,12 @@
+-- Events written in the transaction of the changes that cause them, and sent to the
+-- broker by the outbox relay once that transaction commits.
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    correlation_id VARCHAR(255) NOT NULL DEFAULT '',
+    keys JSONB NOT NULL DEFAULT '{}',
+    payload JSONB NOT NULL,
+    trace_headers JSONB NOT NULL DEFAULT '{}',
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
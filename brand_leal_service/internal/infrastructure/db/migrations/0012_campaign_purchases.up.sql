@@ -0,0 +1,7 @@
+-- Purchases counted in the customer count of each campaign, so a redelivered purchase
+-- event is not counted twice.
+CREATE TABLE IF NOT EXISTS campaign_purchase (
+    campaign_id INT NOT NULL REFERENCES campaign(id) ON DELETE CASCADE,
+    purchase_id INT NOT NULL,
+    PRIMARY KEY (campaign_id, purchase_id)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_event_outbox_pending;
+
+ALTER TABLE event_outbox
+    DROP COLUMN IF EXISTS dead_lettered_date,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS attempts;
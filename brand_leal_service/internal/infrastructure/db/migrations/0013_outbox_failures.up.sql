@@ -0,0 +1,9 @@
+-- The relay counts the failed attempts to send an event and keeps the last error. Events
+-- it cannot decode are dead-lettered: they stay in the outbox, with their error, but are
+-- no longer sent, so they do not hold back the events after them.
+ALTER TABLE event_outbox
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_error TEXT,
+    ADD COLUMN IF NOT EXISTS dead_lettered_date TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_event_outbox_pending ON event_outbox(id) WHERE dead_lettered_date IS NULL;
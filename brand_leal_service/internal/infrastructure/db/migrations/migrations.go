@@ -0,0 +1,22 @@
+// Package migrations holds the schema migrations of the service, applied with the shared
+// migrate package.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+
+	"github.com/degarzonm/leal_contracts/migrate"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// baselineTable is the first table of the initial migration, which databases created by
+// the former init script already have.
+const baselineTable = "brand"
+
+// New returns a Migrator of the migrations embedded in the service.
+func New(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, files, baselineTable)
+}
@@ -1,40 +1,116 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 
 	"github.com/degarzonm/brand_leal_service/internal/domain"
 )
 
 type postgresBranchRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresBranchRepo(db *sql.DB) domain.BranchesRepository {
+func NewPostgresBranchRepo(db DBTX) domain.BranchesRepository {
 	return &postgresBranchRepo{db: db}
 }
 
-// CreateBranch creates a new branch for a given brand_id and returns the newly created branch if successful.
-// The returned branch includes the generated id and registration_date.
-func (r *postgresBranchRepo) CreateBranch(brandID int, branchName string) (*domain.Branch, error) {
-	query := `INSERT INTO branch (brand_id, branch_name) VALUES ($1, $2) RETURNING id, registration_date`
-	row := r.db.QueryRow(query, brandID, branchName)
-	var br domain.Branch
-	br.BrandID = brandID
-	br.Name = branchName
-	if err := row.Scan(&br.ID, &br.RegistrationDate); err != nil {
+const branchColumns = `id, brand_id, branch_name, active, address, latitude, longitude, timezone, opening_hours, registration_date`
+
+// CreateBranch creates a new branch for the brand_id of the given branch and returns it if successful.
+// The returned branch includes the generated id and registration_date. It returns ErrBranchNameTaken
+// if the brand already has a branch with that name.
+func (r *postgresBranchRepo) CreateBranch(ctx context.Context, branch *domain.Branch) (*domain.Branch, error) {
+	hours, err := json.Marshal(openingHours(branch.OpeningHours))
+	if err != nil {
+		return nil, err
+	}
+	query := `INSERT INTO branch (brand_id, branch_name, address, latitude, longitude, timezone, opening_hours)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, active, registration_date`
+	row := r.db.QueryRowContext(ctx, query, branch.BrandID, branch.Name, branch.Address, branch.Latitude, branch.Longitude, branch.Timezone, hours)
+	br := *branch
+	if err := row.Scan(&br.ID, &br.Active, &br.RegistrationDate); err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrBranchNameTaken
+		}
 		return nil, err
 	}
 	return &br, nil
 }
 
+// GetBranchByID returns the branch with the given id, open or closed, or nil if there is none.
+func (r *postgresBranchRepo) GetBranchByID(ctx context.Context, id int) (*domain.Branch, error) {
+	query := `SELECT ` + branchColumns + ` FROM branch WHERE id = $1`
+	br, err := scanBranch(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return br, err
+}
+
+// UpdateBranch replaces the name, address, location, timezone and opening hours of a branch.
+// It returns ErrBranchNameTaken if the brand already has another branch with the new name.
+func (r *postgresBranchRepo) UpdateBranch(ctx context.Context, branch *domain.Branch) error {
+	hours, err := json.Marshal(openingHours(branch.OpeningHours))
+	if err != nil {
+		return err
+	}
+	query := `UPDATE branch SET branch_name = $1, address = $2, latitude = $3, longitude = $4, timezone = $5, opening_hours = $6
+		WHERE id = $7`
+	_, err = r.db.ExecContext(ctx, query, branch.Name, branch.Address, branch.Latitude, branch.Longitude, branch.Timezone, hours, branch.ID)
+	if isUniqueViolation(err) {
+		return domain.ErrBranchNameTaken
+	}
+	return err
+}
+
+// DeactivateBranch closes a branch. The branch and its links to campaigns are kept.
+func (r *postgresBranchRepo) DeactivateBranch(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE branch SET active = FALSE WHERE id = $1`, id)
+	return err
+}
+
+// GetNearestBranches returns up to limit open branches with a location, nearest first to
+// the point at lat and lng, with their great-circle distance in kilometers. If brandID
+// is not zero, only the branches of that brand are searched.
+func (r *postgresBranchRepo) GetNearestBranches(ctx context.Context, lat, lng float64, brandID int, limit int) ([]domain.NearbyBranch, error) {
+	query := `
+		SELECT ` + branchColumns + `,
+			6371 * 2 * ASIN(SQRT(
+				POWER(SIN(RADIANS(latitude - $1) / 2), 2) +
+				COS(RADIANS($1)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - $2) / 2), 2)
+			)) AS distance_km
+		FROM branch
+		WHERE active AND latitude IS NOT NULL AND longitude IS NOT NULL
+			AND ($3 = 0 OR brand_id = $3)
+		ORDER BY distance_km
+		LIMIT $4`
+	rows, err := r.db.QueryContext(ctx, query, lat, lng, brandID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var branches []domain.NearbyBranch
+	for rows.Next() {
+		var nb domain.NearbyBranch
+		br, err := scanBranch(rows, &nb.DistanceKm)
+		if err != nil {
+			return nil, err
+		}
+		nb.Branch = *br
+		branches = append(branches, nb)
+	}
+	return branches, rows.Err()
+}
+
 // LinkBranchToBaseCampaign links a branch to the base campaign for a given brand_id by inserting
 // a record into campaign_branches. It first queries the campaign table to retrieve the id of the
 // base campaign for the given brand_id. If the base campaign is not found, it returns an error.
 // If the base campaign is found, it inserts a record into campaign_branches with the campaign_id
 // and branch_id. If the insert fails, it returns an error. Otherwise, it returns nil.
-func (r *postgresBranchRepo) LinkBranchToBaseCampaign(branch *domain.Branch) error {
+func (r *postgresBranchRepo) LinkBranchToBaseCampaign(ctx context.Context, branch *domain.Branch) error {
 	// Query to find the base campaign for the brand
 	campaignQuery := `
 		SELECT id
@@ -45,7 +121,7 @@ func (r *postgresBranchRepo) LinkBranchToBaseCampaign(branch *domain.Branch) err
 	var campaignID int
 
 	// Step 1: Retrieve the base campaign ID
-	err := r.db.QueryRow(campaignQuery, branch.BrandID).Scan(&campaignID)
+	err := r.db.QueryRowContext(ctx, campaignQuery, branch.BrandID).Scan(&campaignID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return errors.New("base campaign not found for the given brand_id")
@@ -58,7 +134,7 @@ func (r *postgresBranchRepo) LinkBranchToBaseCampaign(branch *domain.Branch) err
 		INSERT INTO campaign_branches (campaign_id, branch_id)
 		VALUES ($1, $2)`
 
-	_, err = r.db.Exec(insertQuery, campaignID, branch.ID)
+	_, err = r.db.ExecContext(ctx, insertQuery, campaignID, branch.ID)
 	if err != nil {
 		return err
 	}
@@ -66,25 +142,48 @@ func (r *postgresBranchRepo) LinkBranchToBaseCampaign(branch *domain.Branch) err
 	return nil
 }
 
-// GetBranchesByBrandID retrieves a list of branches associated with a given brand_id.
-// It executes a SQL query that filters branches by the given brand_id and returns the
-// results as a slice of domain.Branch objects. If the query fails, it returns an error.
+// GetBranchesByBrandID retrieves a list of branches associated with a given brand_id, open
+// and closed. It executes a SQL query that filters branches by the given brand_id and returns
+// the results as a slice of domain.Branch objects. If the query fails, it returns an error.
 // Otherwise, it returns the list of branches.
-func (r *postgresBranchRepo) GetBranchesByBrandID(brandID int) ([]domain.Branch, error) {
-	query := `SELECT id, branch_name, registration_date FROM branch WHERE brand_id = $1`
-	rows, err := r.db.Query(query, brandID)
+func (r *postgresBranchRepo) GetBranchesByBrandID(ctx context.Context, brandID int) ([]domain.Branch, error) {
+	query := `SELECT ` + branchColumns + ` FROM branch WHERE brand_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, brandID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var branches []domain.Branch
 	for rows.Next() {
-		var br domain.Branch
-		br.BrandID = brandID
-		if err := rows.Scan(&br.ID, &br.Name, &br.RegistrationDate); err != nil {
+		br, err := scanBranch(rows)
+		if err != nil {
 			return nil, err
 		}
-		branches = append(branches, br)
+		branches = append(branches, *br)
+	}
+	return branches, rows.Err()
+}
+
+// scanBranch reads a branch selected with branchColumns, followed by the extra columns, if
+// any, into extra.
+func scanBranch(row interface{ Scan(dest ...any) error }, extra ...any) (*domain.Branch, error) {
+	var br domain.Branch
+	var hours []byte
+	dest := append([]any{&br.ID, &br.BrandID, &br.Name, &br.Active, &br.Address, &br.Latitude, &br.Longitude,
+		&br.Timezone, &hours, &br.RegistrationDate}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(hours, &br.OpeningHours); err != nil {
+		return nil, err
+	}
+	return &br, nil
+}
+
+// openingHours returns hours, or an empty list instead of nil, as stored in opening_hours.
+func openingHours(hours []domain.OpeningHours) []domain.OpeningHours {
+	if hours == nil {
+		return []domain.OpeningHours{}
 	}
-	return branches, nil
+	return hours
 }
@@ -1,22 +1,26 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+
 	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/lib/pq"
 )
 
 type postgresBrandRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresBrandRepo(db *sql.DB) domain.BrandsRepository {
+func NewPostgresBrandRepo(db DBTX) domain.BrandsRepository {
 	return &postgresBrandRepo{db: db}
 }
 
 // GetBrandByID obtains a brand by its id , if it does not exist it returns nil
-func (r *postgresBrandRepo) GetBrandByID(id int) (*domain.Brand, error) {
+func (r *postgresBrandRepo) GetBrandByID(ctx context.Context, id int) (*domain.Brand, error) {
 	query := `SELECT id, brand_name, token, registration_date FROM brand WHERE id = $1`
-	row := r.db.QueryRow(query, id)
+	row := r.db.QueryRowContext(ctx, query, id)
 	var b domain.Brand
 	if err := row.Scan(&b.ID, &b.Name, &b.Token, &b.RegistrationDate); err != nil {
 		if err == sql.ErrNoRows {
@@ -31,9 +35,9 @@ func (r *postgresBrandRepo) GetBrandByID(id int) (*domain.Brand, error) {
 // It returns the brand object if found, or nil if no brand with the given name exists.
 // If an error occurs during the query execution or scanning, it returns the error.
 
-func (r *postgresBrandRepo) GetBrandByName(brandName string) (*domain.Brand, error) {
+func (r *postgresBrandRepo) GetBrandByName(ctx context.Context, brandName string) (*domain.Brand, error) {
 	query := `SELECT id, brand_name,pass_hash, token, registration_date FROM brand WHERE brand_name = $1`
-	row := r.db.QueryRow(query, brandName)
+	row := r.db.QueryRowContext(ctx, query, brandName)
 	var b domain.Brand
 	if err := row.Scan(&b.ID, &b.Name, &b.PassHash, &b.Token, &b.RegistrationDate); err != nil {
 		if err == sql.ErrNoRows {
@@ -48,9 +52,9 @@ func (r *postgresBrandRepo) GetBrandByName(brandName string) (*domain.Brand, err
 // It returns the brand object if a matching brand is found, or nil if no such brand exists.
 // If an error occurs during the query execution or scanning process, it returns the error.
 
-func (r *postgresBrandRepo) GetBrandByNameAndPass(brandName, passHash string) (*domain.Brand, error) {
+func (r *postgresBrandRepo) GetBrandByNameAndPass(ctx context.Context, brandName, passHash string) (*domain.Brand, error) {
 	query := `SELECT id, brand_name, token, registration_date FROM brand WHERE brand_name = $1 AND pass_hash = $2`
-	row := r.db.QueryRow(query, brandName, passHash)
+	row := r.db.QueryRowContext(ctx, query, brandName, passHash)
 	var b domain.Brand
 	if err := row.Scan(&b.ID, &b.Name, &b.Token, &b.RegistrationDate); err != nil {
 		if err == sql.ErrNoRows {
@@ -64,14 +68,18 @@ func (r *postgresBrandRepo) GetBrandByNameAndPass(brandName, passHash string) (*
 // CreateBrand creates a new brand in the database and returns the brand object if it was created successfully,
 // or an error if there was an issue during the creation process. The brandName, passHash, and token parameters
 // are used to initialize the brand object. The returned brand object will have the id, name, registration_date, and token fields populated.
-// If the creation fails due to an error or if the brand already exists, the function returns nil and the error.
-func (r *postgresBrandRepo) CreateBrand(brandName, passHash, token string) (*domain.Brand, error) {
+// If the creation fails due to an error the function returns nil and the error, which is ErrBrandNameTaken if
+// the brand already exists.
+func (r *postgresBrandRepo) CreateBrand(ctx context.Context, brandName, passHash, token string) (*domain.Brand, error) {
 	query := `INSERT INTO brand (brand_name, pass_hash, token) VALUES ($1, $2, $3) RETURNING id, registration_date`
 	var b domain.Brand
 	b.Name = brandName
 	b.Token = token
-	row := r.db.QueryRow(query, brandName, passHash, token)
+	row := r.db.QueryRowContext(ctx, query, brandName, passHash, token)
 	if err := row.Scan(&b.ID, &b.RegistrationDate); err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrBrandNameTaken
+		}
 		return nil, err
 	}
 	return &b, nil
@@ -80,8 +88,37 @@ func (r *postgresBrandRepo) CreateBrand(brandName, passHash, token string) (*dom
 // UpdateBrandToken updates the token of a brand in the database identified by the given brandID.
 // It returns an error if the update operation fails.
 
-func (r *postgresBrandRepo) UpdateBrandToken(brandID int, token string) error {
+func (r *postgresBrandRepo) UpdateBrandToken(ctx context.Context, brandID int, token string) error {
 	query := `UPDATE brand SET token=$1 WHERE id=$2`
-	_, err := r.db.Exec(query, token, brandID)
+	_, err := r.db.ExecContext(ctx, query, token, brandID)
 	return err
 }
+
+// GetBrandSettings retrieves the loyalty program settings of the brand identified by brandID.
+// It returns nil if the brand does not exist, or an error if the query fails.
+func (r *postgresBrandRepo) GetBrandSettings(ctx context.Context, brandID int) (*domain.BrandSettings, error) {
+	query := `SELECT id, allow_points_transfer, coins_to_points_rate, points_to_coins_rate, exchange_daily_limit FROM brand WHERE id = $1`
+	row := r.db.QueryRowContext(ctx, query, brandID)
+	var s domain.BrandSettings
+	if err := row.Scan(&s.BrandID, &s.AllowPointsTransfer, &s.CoinsToPointsRate, &s.PointsToCoinsRate, &s.ExchangeDailyLimit); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpdateBrandSettings stores the loyalty program settings of a brand.
+// It returns an error if the update operation fails.
+func (r *postgresBrandRepo) UpdateBrandSettings(ctx context.Context, settings *domain.BrandSettings) error {
+	query := `UPDATE brand SET allow_points_transfer=$1, coins_to_points_rate=$2, points_to_coins_rate=$3, exchange_daily_limit=$4 WHERE id=$5`
+	_, err := r.db.ExecContext(ctx, query, settings.AllowPointsTransfer, settings.CoinsToPointsRate, settings.PointsToCoinsRate, settings.ExchangeDailyLimit, settings.BrandID)
+	return err
+}
+
+// isUniqueViolation reports whether err is the violation of a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/lib/pq"
+)
+
+type postgresBrandUserRepo struct {
+	db DBTX
+}
+
+func NewPostgresBrandUserRepo(db DBTX) domain.BrandUserRepository {
+	return &postgresBrandUserRepo{db: db}
+}
+
+const brandUserColumns = `id, brand_id, user_name, email, user_role, branch_ids, pass_hash, COALESCE(token, ''), active, registration_date`
+
+// CreateUser adds a member to the staff of a brand and returns it with its ID. It returns
+// ErrBrandUserTaken if the email already belongs to the staff of the brand.
+func (r *postgresBrandUserRepo) CreateUser(ctx context.Context, u *domain.BrandUser) (*domain.BrandUser, error) {
+	query := `INSERT INTO brand_user (brand_id, user_name, email, user_role, branch_ids, pass_hash, token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, active, registration_date`
+	created := *u
+	row := r.db.QueryRowContext(ctx, query, u.BrandID, u.Name, u.Email, u.Role, pq.Array(toInt64s(u.BranchIDs)), u.PassHash, u.Token)
+	if err := row.Scan(&created.ID, &created.Active, &created.RegistrationDate); err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrBrandUserTaken
+		}
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetUserByID returns a member of the staff by its ID, or nil if there is none.
+func (r *postgresBrandUserRepo) GetUserByID(ctx context.Context, id int) (*domain.BrandUser, error) {
+	query := `SELECT ` + brandUserColumns + ` FROM brand_user WHERE id = $1`
+	return scanBrandUser(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetUserByEmail returns the member of the staff of a brand with the given email, or nil
+// if there is none.
+func (r *postgresBrandUserRepo) GetUserByEmail(ctx context.Context, brandID int, email string) (*domain.BrandUser, error) {
+	query := `SELECT ` + brandUserColumns + ` FROM brand_user WHERE brand_id = $1 AND email = $2`
+	return scanBrandUser(r.db.QueryRowContext(ctx, query, brandID, email))
+}
+
+// GetUsersByBrandID returns the staff of a brand, oldest first.
+func (r *postgresBrandUserRepo) GetUsersByBrandID(ctx context.Context, brandID int) ([]domain.BrandUser, error) {
+	query := `SELECT ` + brandUserColumns + ` FROM brand_user WHERE brand_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, brandID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []domain.BrandUser
+	for rows.Next() {
+		u, err := scanBrandUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// UpdateUserToken replaces the token of a member of the staff.
+func (r *postgresBrandUserRepo) UpdateUserToken(ctx context.Context, id int, token string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE brand_user SET token = $1 WHERE id = $2`, token, id)
+	return err
+}
+
+// UpdateUserRole changes the role of a member of the staff and the branches they work with.
+func (r *postgresBrandUserRepo) UpdateUserRole(ctx context.Context, id int, role string, branchIDs []int) error {
+	query := `UPDATE brand_user SET user_role = $1, branch_ids = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, role, pq.Array(toInt64s(branchIDs)), id)
+	return err
+}
+
+// DeactivateUser deactivates a member of the staff and clears their token, so it stops
+// working at once.
+func (r *postgresBrandUserRepo) DeactivateUser(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE brand_user SET active = FALSE, token = NULL WHERE id = $1`, id)
+	return err
+}
+
+// CreateInvitation stores a pending invitation to the staff of a brand and returns it with
+// its ID.
+func (r *postgresBrandUserRepo) CreateInvitation(ctx context.Context, inv *domain.BrandUserInvitation) (*domain.BrandUserInvitation, error) {
+	query := `INSERT INTO brand_user_invitation (brand_id, email, user_role, branch_ids, code)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, status, created_date`
+	created := *inv
+	row := r.db.QueryRowContext(ctx, query, inv.BrandID, inv.Email, inv.Role, pq.Array(toInt64s(inv.BranchIDs)), inv.Code)
+	if err := row.Scan(&created.ID, &created.Status, &created.CreatedDate); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+const invitationColumns = `id, brand_id, email, user_role, branch_ids, code, status, created_date`
+
+// GetInvitationByCode returns the invitation with the given code, or nil if there is none.
+// The row is locked until the end of the transaction, so that an invitation is accepted
+// only once.
+func (r *postgresBrandUserRepo) GetInvitationByCode(ctx context.Context, code string) (*domain.BrandUserInvitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM brand_user_invitation WHERE code = $1 FOR UPDATE`
+	return scanInvitation(r.db.QueryRowContext(ctx, query, code))
+}
+
+// GetInvitationByID returns the invitation with the given ID, or nil if there is none.
+// The row is locked until the end of the transaction, so that an invitation is not
+// accepted while it is being revoked.
+func (r *postgresBrandUserRepo) GetInvitationByID(ctx context.Context, id int) (*domain.BrandUserInvitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM brand_user_invitation WHERE id = $1 FOR UPDATE`
+	return scanInvitation(r.db.QueryRowContext(ctx, query, id))
+}
+
+// scanInvitation reads an invitation selected with invitationColumns, returning nil if
+// there is no row.
+func scanInvitation(row interface{ Scan(dest ...any) error }) (*domain.BrandUserInvitation, error) {
+	var inv domain.BrandUserInvitation
+	var branchIDs []int64
+	err := row.Scan(&inv.ID, &inv.BrandID, &inv.Email, &inv.Role,
+		pq.Array(&branchIDs), &inv.Code, &inv.Status, &inv.CreatedDate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	inv.BranchIDs = toInts(branchIDs)
+	return &inv, nil
+}
+
+// UpdateInvitationStatus changes the status of an invitation.
+func (r *postgresBrandUserRepo) UpdateInvitationStatus(ctx context.Context, id int, status string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE brand_user_invitation SET status = $1 WHERE id = $2`, status, id)
+	return err
+}
+
+// scanBrandUser reads a member of the staff selected with brandUserColumns, returning nil
+// if there is no row.
+func scanBrandUser(row interface{ Scan(dest ...any) error }) (*domain.BrandUser, error) {
+	var u domain.BrandUser
+	var branchIDs []int64
+	err := row.Scan(&u.ID, &u.BrandID, &u.Name, &u.Email, &u.Role, pq.Array(&branchIDs), &u.PassHash, &u.Token, &u.Active, &u.RegistrationDate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	u.BranchIDs = toInts(branchIDs)
+	return &u, nil
+}
+
+// toInt64s and toInts convert IDs to and from the elements of an INT[] column.
+func toInt64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
+
+func toInts(ids []int64) []int {
+	out := make([]int, len(ids))
+	for i, id := range ids {
+		out[i] = int(id)
+	}
+	return out
+}
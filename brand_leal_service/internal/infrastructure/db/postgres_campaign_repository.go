@@ -1,8 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
 
@@ -10,10 +11,10 @@ import (
 )
 
 type postgresCampaignRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresCampaignRepo(db *sql.DB) domain.CampaignRepository {
+func NewPostgresCampaignRepo(db DBTX) domain.CampaignRepository {
 	return &postgresCampaignRepo{db: db}
 }
 
@@ -23,11 +24,11 @@ func NewPostgresCampaignRepo(db *sql.DB) domain.CampaignRepository {
 // Otherwise, it inserts the given branch IDs into the campaign_branches table, linking them with the campaign ID.
 // Returns the created campaign with its ID filled or an error if something goes wrong.
 
-func (r *postgresCampaignRepo) CreateCampaign(c *domain.Campaign, branchIDs []int) (*domain.Campaign, error) {
-	log.Println("Creating campaign:", c)
+func (r *postgresCampaignRepo) CreateCampaign(ctx context.Context, c *domain.Campaign, branchIDs []int) (*domain.Campaign, error) {
+	slog.DebugContext(ctx, "Creating campaign", "brand_id", c.BrandID, "campaign_name", c.CampaignName, "branch_ids", branchIDs)
 	query := `INSERT INTO campaign (campaign_name, brand_id, min_value, max_value, start_date, end_date, status, point_factor, coin_factor)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
-	row := r.db.QueryRow(query, c.CampaignName, c.BrandID, c.MinValue, c.MaxValue, c.StartDate, c.EndDate, c.Status, c.PointFactor, c.CoinFactor)
+	row := r.db.QueryRowContext(ctx, query, c.CampaignName, c.BrandID, c.MinValue, c.MaxValue, c.StartDate, c.EndDate, c.Status, c.PointFactor, c.CoinFactor)
 
 	if err := row.Scan(&c.ID); err != nil {
 		return nil, err
@@ -40,7 +41,7 @@ func (r *postgresCampaignRepo) CreateCampaign(c *domain.Campaign, branchIDs []in
 
 	// Insert into campaign_branches for all branch IDs
 	for _, bid := range branchIDs {
-		_, err := r.db.Exec(`INSERT INTO campaign_branches (campaign_id, branch_id) VALUES ($1, $2)`, c.ID, bid)
+		_, err := r.db.ExecContext(ctx, `INSERT INTO campaign_branches (campaign_id, branch_id) VALUES ($1, $2)`, c.ID, bid)
 		if err != nil {
 			return nil, err
 		}
@@ -50,9 +51,9 @@ func (r *postgresCampaignRepo) CreateCampaign(c *domain.Campaign, branchIDs []in
 }
 
 // GetCampaignByID returns a campaign by its ID or nil if the campaign does not exist.
-func (r *postgresCampaignRepo) GetCampaignByID(id int) (*domain.Campaign, error) {
+func (r *postgresCampaignRepo) GetCampaignByID(ctx context.Context, id int) (*domain.Campaign, error) {
 	query := `SELECT campaign_name, brand_id, min_value, max_value, start_date, end_date, status, point_factor, coin_factor, customer_count FROM campaign WHERE id=$1`
-	row := r.db.QueryRow(query, id)
+	row := r.db.QueryRowContext(ctx, query, id)
 	var c domain.Campaign
 	c.ID = id
 	if err := row.Scan(&c.CampaignName, &c.BrandID, &c.MinValue, &c.MaxValue, &c.StartDate, &c.EndDate, &c.Status, &c.PointFactor, &c.CoinFactor, &c.CustomerCount); err != nil {
@@ -69,22 +70,22 @@ func (r *postgresCampaignRepo) GetCampaignByID(id int) (*domain.Campaign, error)
 // Then it deletes the existing branch IDs associated with the campaign from the campaign_branches table.
 // Finally it inserts the given branch IDs into the campaign_branches table, linking them with the campaign ID.
 // Returns an error if something goes wrong.
-func (r *postgresCampaignRepo) UpdateCampaign(c *domain.Campaign, branchIDs []int) error {
+func (r *postgresCampaignRepo) UpdateCampaign(ctx context.Context, c *domain.Campaign, branchIDs []int) error {
 	query := `UPDATE campaign SET campaign_name=$1, min_value=$2, max_value=$3, start_date=$4, end_date=$5, point_factor=$6, coin_factor=$7 WHERE id=$8 AND brand_id=$9`
-	_, err := r.db.Exec(query, c.CampaignName, c.MinValue, c.MaxValue, c.StartDate, c.EndDate, c.PointFactor, c.CoinFactor, c.ID, c.BrandID)
+	_, err := r.db.ExecContext(ctx, query, c.CampaignName, c.MinValue, c.MaxValue, c.StartDate, c.EndDate, c.PointFactor, c.CoinFactor, c.ID, c.BrandID)
 	if err != nil {
 		return err
 	}
 
 	// first delete the existing branch IDs
-	_, err = r.db.Exec(`DELETE FROM campaign_branches WHERE campaign_id=$1`, c.ID)
+	_, err = r.db.ExecContext(ctx, `DELETE FROM campaign_branches WHERE campaign_id=$1`, c.ID)
 	if err != nil {
 		return err
 	}
 
 	// Insert the new branch IDs
 	for _, bid := range branchIDs {
-		_, err := r.db.Exec(`INSERT INTO campaign_branches (campaign_id, branch_id) VALUES ($1, $2)`, c.ID, bid)
+		_, err := r.db.ExecContext(ctx, `INSERT INTO campaign_branches (campaign_id, branch_id) VALUES ($1, $2)`, c.ID, bid)
 		if err != nil {
 			return err
 		}
@@ -97,7 +98,7 @@ func (r *postgresCampaignRepo) UpdateCampaign(c *domain.Campaign, branchIDs []in
 // The branch IDs are returned as a comma-separated string in the "branch_ids" field.
 // If a campaign does not have any branch IDs, the "branch_ids" field will be an empty string.
 // The campaigns are returned in descending order of start date.
-func (r *postgresCampaignRepo) GetCampaignsByBrandID(brandID int) ([]domain.Campaign, error) {
+func (r *postgresCampaignRepo) GetCampaignsByBrandID(ctx context.Context, brandID int) ([]domain.Campaign, error) {
 	query := `
 		SELECT 
 			c.id, c.campaign_name, c.min_value, c.max_value, c.start_date, c.end_date, 
@@ -114,7 +115,7 @@ func (r *postgresCampaignRepo) GetCampaignsByBrandID(brandID int) ([]domain.Camp
 		ORDER BY 
 			c.start_date DESC`
 
-	rows, err := r.db.Query(query, brandID)
+	rows, err := r.db.QueryContext(ctx, query, brandID)
 	if err != nil {
 		return nil, err
 	}
@@ -151,12 +152,12 @@ func (r *postgresCampaignRepo) GetCampaignsByBrandID(brandID int) ([]domain.Camp
 }
 
 // GetBranchesForCampaign returns a list of all branches associated with the given campaign ID.
-func (r *postgresCampaignRepo) GetBranchesForCampaign(campaignID int) ([]domain.Branch, error) {
+func (r *postgresCampaignRepo) GetBranchesForCampaign(ctx context.Context, campaignID int) ([]domain.Branch, error) {
 	query := `SELECT b.id, b.brand_id, b.branch_name, b.registration_date 
 		FROM campaign_branches cb
 		INNER JOIN branch b ON cb.branch_id = b.id
 		WHERE cb.campaign_id=$1`
-	rows, err := r.db.Query(query, campaignID)
+	rows, err := r.db.QueryContext(ctx, query, campaignID)
 	if err != nil {
 		return nil, err
 	}
@@ -176,16 +177,19 @@ func (r *postgresCampaignRepo) GetBranchesForCampaign(campaignID int) ([]domain.
 // GetCampaignsForBranch retrieves all active campaigns associated with a specific branch ID.
 // It queries the campaign_branches table to find campaigns linked to the given branch ID
 // and joins with the campaign table to obtain campaign details. Only campaigns with an "active"
-// status are retrieved. It returns a slice of Campaign objects or an error if the query fails.
+// status are retrieved, and none if the branch is closed. It returns a slice of Campaign objects
+// or an error if the query fails.
 
-func (r *postgresCampaignRepo) GetCampaignsForBranch(branchID int) ([]domain.Campaign, error) {
+func (r *postgresCampaignRepo) GetCampaignsForBranch(ctx context.Context, branchID int) ([]domain.Campaign, error) {
 	query := `SELECT c.id, c.campaign_name, c.brand_id, c.min_value, c.max_value, 
 	                 c.start_date, c.end_date, c.status, c.point_factor, c.coin_factor, c.customer_count
 	          FROM campaign_branches cb
 	          INNER JOIN campaign c ON cb.campaign_id = c.id
+	          INNER JOIN branch b ON cb.branch_id = b.id
 	          WHERE cb.branch_id = $1
-			  AND c.status = $2`
-	rows, err := r.db.Query(query, branchID, "active")
+			  AND c.status = $2
+			  AND b.active`
+	rows, err := r.db.QueryContext(ctx, query, branchID, "active")
 	if err != nil {
 		return nil, err
 	}
@@ -209,13 +213,13 @@ func (r *postgresCampaignRepo) GetCampaignsForBranch(branchID int) ([]domain.Cam
 // If no base campaign is found, it returns nil.
 // If any error occurs during the query execution, it returns the error.
 
-func (r *postgresCampaignRepo) GetBaseCampaignForBrand(brandID int) (*domain.Campaign, error) {
+func (r *postgresCampaignRepo) GetBaseCampaignForBrand(ctx context.Context, brandID int) (*domain.Campaign, error) {
 	query := `SELECT c.id, c.campaign_name, c.brand_id, c.min_value, c.max_value, 
 	                 c.start_date, c.end_date, c.status, c.point_factor, c.coin_factor, c.customer_count
 	          FROM campaign c
 	          WHERE c.campaign_name = 'base' AND c.brand_id = $1`
 
-	row := r.db.QueryRow(query, brandID)
+	row := r.db.QueryRowContext(ctx, query, brandID)
 
 	var camp domain.Campaign
 	err := row.Scan(&camp.ID, &camp.CampaignName, &camp.BrandID, &camp.MinValue, &camp.MaxValue,
@@ -229,12 +233,18 @@ func (r *postgresCampaignRepo) GetBaseCampaignForBrand(brandID int) (*domain.Cam
 	return &camp, nil
 }
 
-// UpdateCustomerCountCampaign increments the customer count for a specified campaign by 1 in the database.
-// It executes an update query on the campaign table using the campaign ID provided.
-// Returns an error if the update query fails, otherwise returns nil.
-
-func (r *postgresCampaignRepo) UpdateCustomerCountCampaign(c *domain.Campaign) error {
-	query := `UPDATE campaign SET customer_count = customer_count+1  WHERE id = $1`
-	_, err := r.db.Exec(query, c.ID)
+// UpdateCustomerCountCampaign increments the customer count of the campaign by 1 for the
+// given purchase. The purchases counted are recorded with the campaign, so counting the
+// same purchase again, when its event is redelivered, changes nothing.
+// Returns an error if the query fails, otherwise returns nil.
+func (r *postgresCampaignRepo) UpdateCustomerCountCampaign(ctx context.Context, c *domain.Campaign, purchaseID int) error {
+	query := `
+		WITH counted AS (
+			INSERT INTO campaign_purchase (campaign_id, purchase_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+			RETURNING campaign_id
+		)
+		UPDATE campaign SET customer_count = customer_count + 1 WHERE id IN (SELECT campaign_id FROM counted)`
+	_, err := r.db.ExecContext(ctx, query, c.ID, purchaseID)
 	return err
 }
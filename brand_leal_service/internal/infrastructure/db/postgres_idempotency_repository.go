@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+)
+
+type postgresIdempotencyRepo struct {
+	db DBTX
+}
+
+func NewPostgresIdempotencyRepo(db DBTX) domain.IdempotencyRepository {
+	return &postgresIdempotencyRepo{db: db}
+}
+
+// Reserve claims an idempotency key for a new request. It returns nil when the key was free,
+// or only used before expiredBefore, and is now reserved for the given request. Otherwise it
+// returns the stored record, which holds the response to replay or, while the first request
+// is still running, a StatusCode of 0.
+func (r *postgresIdempotencyRepo) Reserve(ctx context.Context, record *domain.IdempotencyRecord, expiredBefore time.Time) (*domain.IdempotencyRecord, error) {
+	query := `
+		INSERT INTO idempotency_key (scope, idempotency_key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scope, idempotency_key)
+		DO UPDATE SET request_hash = $3, status_code = NULL, content_type = NULL, response_body = NULL, created_date = CURRENT_TIMESTAMP
+		WHERE idempotency_key.created_date < $4
+		RETURNING created_date`
+	err := r.db.QueryRowContext(ctx, query, record.Scope, record.Key, record.RequestHash, expiredBefore).Scan(&record.CreatedDate)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	existing := domain.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	query = `SELECT request_hash, status_code, content_type, response_body, created_date
+		FROM idempotency_key WHERE scope = $1 AND idempotency_key = $2`
+	err = r.db.QueryRowContext(ctx, query, record.Scope, record.Key).Scan(&existing.RequestHash, &statusCode, &contentType, &existing.ResponseBody, &existing.CreatedDate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// The first request failed and released the key in the meantime;
+			// report it as in progress so the client retries.
+			existing.RequestHash = record.RequestHash
+			return &existing, nil
+		}
+		return nil, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	existing.ContentType = contentType.String
+	return &existing, nil
+}
+
+// Complete stores the response of the request that reserved the key, so replays get it.
+func (r *postgresIdempotencyRepo) Complete(ctx context.Context, record *domain.IdempotencyRecord) error {
+	query := `UPDATE idempotency_key SET status_code = $3, content_type = $4, response_body = $5 WHERE scope = $1 AND idempotency_key = $2`
+	_, err := r.db.ExecContext(ctx, query, record.Scope, record.Key, record.StatusCode, record.ContentType, record.ResponseBody)
+	return err
+}
+
+// Release frees a reserved key whose request failed, so the client can retry it.
+func (r *postgresIdempotencyRepo) Release(ctx context.Context, scope string, key string) error {
+	query := `DELETE FROM idempotency_key WHERE scope = $1 AND idempotency_key = $2`
+	_, err := r.db.ExecContext(ctx, query, scope, key)
+	return err
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+)
+
+type postgresSettlementRepo struct {
+	db DBTX
+}
+
+func NewPostgresSettlementRepo(db DBTX) domain.SettlementRepository {
+	return &postgresSettlementRepo{db: db}
+}
+
+// RecordEntry stores a coin issuance or consumption entry. A purchase or exchange has at
+// most one entry of each type, so reprocessing the same event does not count its coins twice.
+func (r *postgresSettlementRepo) RecordEntry(ctx context.Context, entry *domain.SettlementEntry) error {
+	query := `INSERT INTO coin_settlement_entry (brand_id, entry_type, coins, purchase_id, exchange_id, customer_id, entry_date)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, 0), $6, $7)
+		ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, entry.BrandID, entry.EntryType, entry.Coins, entry.PurchaseID, entry.ExchangeID, entry.CustomerID, entry.EntryDate)
+	return err
+}
+
+// GetPositions returns, for every brand with entries in [from, to), the coins it issued
+// and consumed and its net position. Brands are returned in ascending ID order.
+func (r *postgresSettlementRepo) GetPositions(ctx context.Context, from, to time.Time) ([]domain.SettlementPosition, error) {
+	query := `
+		SELECT
+			brand_id,
+			COALESCE(SUM(coins) FILTER (WHERE entry_type = 'issued'), 0) AS issued,
+			COALESCE(SUM(coins) FILTER (WHERE entry_type = 'consumed'), 0) AS consumed
+		FROM coin_settlement_entry
+		WHERE entry_date >= $1 AND entry_date < $2
+		GROUP BY brand_id
+		ORDER BY brand_id`
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []domain.SettlementPosition
+	for rows.Next() {
+		var p domain.SettlementPosition
+		if err := rows.Scan(&p.BrandID, &p.Issued, &p.Consumed); err != nil {
+			return nil, err
+		}
+		p.Net = p.Consumed - p.Issued
+		positions = append(positions, p)
+	}
+	return positions, nil
+}
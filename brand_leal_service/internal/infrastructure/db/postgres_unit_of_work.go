@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+)
+
+// DBTX is the part of *sql.DB and *sql.Tx used by the repositories, so the same
+// repository can run on the connection pool or inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type postgresUnitOfWork struct {
+	db *sql.DB
+}
+
+func NewPostgresUnitOfWork(db *sql.DB) domain.UnitOfWork {
+	return &postgresUnitOfWork{db: db}
+}
+
+// Do begins a transaction, hands fn the repositories bound to it, and commits when fn
+// returns nil. If fn returns an error or panics, the transaction is rolled back and
+// nothing fn wrote is kept.
+func (u *postgresUnitOfWork) Do(ctx context.Context, fn func(repos domain.Repositories) error) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	repos := domain.Repositories{
+		Brands:     NewPostgresBrandRepo(tx),
+		Branches:   NewPostgresBranchRepo(tx),
+		Campaigns:  NewPostgresCampaignRepo(tx),
+		Rewards:    NewPostgresRewardRepo(tx),
+		Settlement: NewPostgresSettlementRepo(tx),
+		Users:      NewPostgresBrandUserRepo(tx),
+		Outbox:     NewPostgresOutboxRepo(tx),
+	}
+	if err := fn(repos); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
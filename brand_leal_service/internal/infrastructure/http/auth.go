@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/subtle"
+	"strconv"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	brandIDHeader      = "Leal-Brand-Id"
+	brandUserIDHeader  = "Leal-Brand-User-Id"
+	brandTokenHeader   = "Leal-Brand-Token"
+	serviceNameHeader  = "Leal-Service-Name"
+	serviceTokenHeader = "Leal-Service-Token"
+
+	// principalKey is the key of the authenticated caller in the context of a request.
+	principalKey = "principal"
+)
+
+// AuthMiddleware authenticates the caller of the routes it guards and stores it in the
+// context as the principal of the request, so that handlers read it with principal.
+//
+// Brands send their ID and token in the Leal-Brand-Id and Leal-Brand-Token headers, and act
+// as their owner. Members of the staff also send their user ID in Leal-Brand-User-Id, with
+// their own token, and act with their role. Other services send their name and token in
+// Leal-Service-Name and Leal-Service-Token, checked against serviceTokens, and the brand
+// they act for, as its owner, in Leal-Brand-Id. Requests without valid credentials are
+// answered with a 401 Unauthorized problem.
+func AuthMiddleware(brands domain.BrandService, users domain.BrandUserService, serviceTokens map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := authenticate(c, brands, users, serviceTokens)
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// authenticate returns the principal of the credentials of the request.
+func authenticate(c *gin.Context, brands domain.BrandService, users domain.BrandUserService, serviceTokens map[string]string) (*domain.Principal, error) {
+	brandIDStr := c.GetHeader(brandIDHeader)
+	service := c.GetHeader(serviceNameHeader)
+	if service != "" {
+		token, ok := serviceTokens[service]
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.GetHeader(serviceTokenHeader))) != 1 {
+			return nil, domain.ErrInvalidServiceCredentials
+		}
+		brandID, err := strconv.Atoi(brandIDStr)
+		if err != nil {
+			return nil, domain.ErrMissingAuthentication
+		}
+		if _, err := brands.GetBrandByID(c.Request.Context(), brandID); err != nil {
+			return nil, err
+		}
+		return &domain.Principal{Kind: domain.PrincipalService, ID: brandID, Service: service, Role: domain.RoleOwner}, nil
+	}
+
+	tokenReq := c.GetHeader(brandTokenHeader)
+	if brandIDStr == "" || tokenReq == "" {
+		return nil, domain.ErrMissingAuthentication
+	}
+	brandID, err := strconv.Atoi(brandIDStr)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+	if userIDStr := c.GetHeader(brandUserIDHeader); userIDStr != "" {
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			return nil, domain.ErrInvalidToken
+		}
+		user, err := users.ValidateToken(c.Request.Context(), brandID, userID, tokenReq)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.Principal{Kind: domain.PrincipalBrand, ID: brandID, UserID: user.ID, Role: user.Role, BranchIDs: user.BranchIDs}, nil
+	}
+	if err := brands.ValidateToken(c.Request.Context(), brandID, tokenReq); err != nil {
+		return nil, err
+	}
+	return &domain.Principal{Kind: domain.PrincipalBrand, ID: brandID, Role: domain.RoleOwner}, nil
+}
+
+// RequirePermission lets the request through only if the role of its principal has the
+// permission, and answers it with a 403 Forbidden problem otherwise. It runs after
+// AuthMiddleware.
+func RequirePermission(perm domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !principal(c).Can(perm) {
+			c.Error(domain.ErrPermissionDenied)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// principal returns the caller authenticated by AuthMiddleware.
+func principal(c *gin.Context) *domain.Principal {
+	return c.MustGet(principalKey).(*domain.Principal)
+}
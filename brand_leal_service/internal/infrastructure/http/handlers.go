@@ -1,25 +1,32 @@
 package http
 
 import (
-	"errors"
-	"log"
+	"bytes"
+	"encoding/csv"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/degarzonm/brand_leal_service/internal/domain"
 	"github.com/degarzonm/brand_leal_service/internal/infrastructure/util"
 	"github.com/gin-gonic/gin"
 )
 
+// Handler serves the routes of the brand service. Errors are added to the context with
+// c.Error and written as problems by ErrorMiddleware.
 type Handler struct {
-	brandService    domain.BrandService
-	branchService   domain.BranchService
-	campaignService domain.CampaignService
-	rewardService   domain.RewardService
+	brandService      domain.BrandService
+	branchService     domain.BranchService
+	campaignService   domain.CampaignService
+	rewardService     domain.RewardService
+	settlementService domain.SettlementService
+	userService       domain.BrandUserService
 }
 
-func NewHandler(bs domain.BrandService, bss domain.BranchService, cs domain.CampaignService, r domain.RewardService) *Handler {
-	return &Handler{brandService: bs, branchService: bss, campaignService: cs, rewardService: r}
+func NewHandler(bs domain.BrandService, bss domain.BranchService, cs domain.CampaignService, r domain.RewardService, ss domain.SettlementService, us domain.BrandUserService) *Handler {
+	return &Handler{brandService: bs, branchService: bss, campaignService: cs, rewardService: r, settlementService: ss, userService: us}
 }
 
 // Ping checks if the service is up and running.
@@ -34,17 +41,15 @@ func (h *Handler) Ping(c *gin.Context) {
 // If the request is incorrect, it returns a JSON with an error message.
 // If the service has a problem, it returns a JSON with an error message.
 func (h *Handler) NewBrand(c *gin.Context) {
-	log.Println("NewBrand Request")
 	var req NewBrandRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
-	log.Println("object received: ", req)
 	req.BrandName = util.Sanitize(req.BrandName)
-	b, err := h.brandService.CreateBrand(req.BrandName, req.Pass)
+	b, err := h.brandService.CreateBrand(c.Request.Context(), req.BrandName, req.Pass)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"brand_id": b.ID, "token": b.Token})
@@ -58,44 +63,141 @@ func (h *Handler) NewBrand(c *gin.Context) {
 func (h *Handler) LoginBrand(c *gin.Context) {
 	var req LoginBrandRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 	req.BrandName = util.Sanitize(req.BrandName)
-	b, err := h.brandService.LoginBrand(req.BrandName, req.Pass)
+	b, err := h.brandService.LoginBrand(c.Request.Context(), req.BrandName, req.Pass)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"brand_id": b.ID, "token": b.Token})
 }
 
 // NewBranch creates a new branch for the authorized brand.
-// It requires a JSON object with a branch_name field.
+// It requires a JSON object with a branch_name field, and optionally the address,
+// latitude and longitude, timezone and opening_hours of the branch.
 // If the brand is not authorized, it returns a 401 Unauthorized error.
-// If the JSON binding fails, it returns a 400 Bad Request error.
+// If the JSON binding fails, or the location, timezone or hours are invalid, it returns
+// a 400 Bad Request error.
+// If the brand already has a branch with that name, it returns a 409 Conflict error.
 // If the branch creation fails, it returns a 500 Internal Server Error.
-// On success, it returns a 200 OK status with the branch_id, brand_id, and branch_name.
-
+// On success, it returns a 200 OK status with the branch.
 func (h *Handler) NewBranch(c *gin.Context) {
-	brandID, err := h.auhorizeBrand(c)
+	brandID := principal(c).ID
+
+	var req NewBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	branch := &domain.Branch{
+		BrandID:      brandID,
+		Name:         util.Sanitize(req.BranchName),
+		Address:      util.Sanitize(req.Address),
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Timezone:     req.Timezone,
+		OpeningHours: openingHours(req.OpeningHours),
+	}
+	br, err := h.branchService.CreateBranch(c.Request.Context(), branch)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	c.JSON(http.StatusOK, branchResponse(br))
+}
 
-	var req NewBranchRequest
+// ModifyBranch replaces the name, address, location, timezone and opening hours of a
+// branch of the authorized brand.
+// If the branch is not found, it returns a 404 Not Found error.
+// If the branch is closed, or the new values are invalid, it returns a 400 Bad Request error.
+// If the brand already has another branch with the new name, it returns a 409 Conflict error.
+// On success, it returns a 200 OK status with the branch.
+func (h *Handler) ModifyBranch(c *gin.Context) {
+	brandID := principal(c).ID
+
+	var req ModifyBranchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
-	req.BranchName = util.Sanitize(req.BranchName)
-	br, err := h.branchService.CreateBranch(brandID, req.BranchName)
+	branch := &domain.Branch{
+		ID:           req.BranchID,
+		BrandID:      brandID,
+		Name:         util.Sanitize(req.BranchName),
+		Address:      util.Sanitize(req.Address),
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Timezone:     req.Timezone,
+		OpeningHours: openingHours(req.OpeningHours),
+	}
+	br, err := h.branchService.UpdateBranch(c.Request.Context(), branch)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, branchResponse(br))
+}
+
+// DeactivateBranch closes a branch of the authorized brand. The branch keeps its
+// history, but campaigns can no longer be linked to it and its purchases are
+// rejected.
+// If the branch is not found, it returns a 404 Not Found error.
+// On success, it returns a 200 OK status with the branch_id and active set to false.
+func (h *Handler) DeactivateBranch(c *gin.Context) {
+	brandID := principal(c).ID
+
+	var req DeactivateBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"branch_id": br.ID, "brand_id": br.BrandID, "branch_name": br.Name})
+	if err := h.branchService.DeactivateBranch(c.Request.Context(), brandID, req.BranchID); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branch_id": req.BranchID, "active": false})
+}
+
+// NearestBranches is the public branch locator. It returns the open branches nearest
+// to the point in the "lat" and "lng" query parameters, of every brand or of the one
+// in "brand_id", up to "limit" of them, each with its distance_km.
+// If the coordinates are missing or invalid, it returns a 400 Bad Request error.
+func (h *Handler) NearestBranches(c *gin.Context) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil {
+		c.Error(invalidField("lat"))
+		return
+	}
+	lng, err := strconv.ParseFloat(c.Query("lng"), 64)
+	if err != nil {
+		c.Error(invalidField("lng"))
+		return
+	}
+	brandID, err := strconv.Atoi(c.DefaultQuery("brand_id", "0"))
+	if err != nil {
+		c.Error(invalidField("brand_id"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.Error(invalidField("limit"))
+		return
+	}
+
+	nearby, err := h.branchService.FindNearestBranches(c.Request.Context(), lat, lng, brandID, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	branches := make([]gin.H, len(nearby))
+	for i, nb := range nearby {
+		branches[i] = branchResponse(&nb.Branch)
+		branches[i]["distance_km"] = nb.DistanceKm
+	}
+	c.JSON(http.StatusOK, gin.H{"branches": branches})
 }
 
 // MyBranches returns all the branches of the authorized brand.
@@ -103,20 +205,21 @@ func (h *Handler) NewBranch(c *gin.Context) {
 // If the brand is not authorized, it returns a 401 Unauthorized error.
 // If the service has a problem, it returns a 500 Internal Server Error.
 // On success, it returns a 200 OK status with a JSON object
-// with a list of branch objects.
+// with a list of branch objects. Staff scoped to some branches only see those.
 func (h *Handler) MyBranches(c *gin.Context) {
 
-	brandID, err := h.auhorizeBrand(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	p := principal(c)
 
-	branches, err := h.branchService.GetBranches(brandID)
+	branches, err := h.branchService.GetBranches(c.Request.Context(), p.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	if domain.BranchScoped(p.Role) {
+		branches = slices.DeleteFunc(branches, func(b domain.Branch) bool {
+			return !slices.Contains(p.BranchIDs, b.ID)
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"branches": branches})
 }
@@ -127,37 +230,39 @@ func (h *Handler) MyBranches(c *gin.Context) {
 // If the request is invalid, it returns a 400 Bad Request error.
 // If the service has a problem, it returns a 500 Internal Server Error.
 // On success, it returns a 200 OK status with a JSON object
-// with the campaign ID.
+// with the campaign ID. Staff scoped to some branches can only create
+// campaigns in those, otherwise it returns a 403 Forbidden error.
 func (h *Handler) NewCampaign(c *gin.Context) {
 
-	brandID, err := h.auhorizeBrand(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
+	p := principal(c)
+	brandID := p.ID
 
 	var req NewCampaignRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
 	// Validar y convertir BranchIDs
 	branchIDs, err := util.ParseBranchIDs(req.BranchIDs)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch_ids"})
+		c.Error(invalidField("branch_ids"))
+		return
+	}
+	if !p.CanAccessBranches(branchIDs) {
+		c.Error(domain.ErrBranchNotAllowed)
 		return
 	}
 
 	start, err := util.ParseDate(req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date"})
+		c.Error(invalidField("start_date"))
 		return
 	}
 	end, err := util.ParseDate(req.EndDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date"})
+		c.Error(invalidField("end_date"))
 		return
 	}
 
@@ -173,9 +278,9 @@ func (h *Handler) NewCampaign(c *gin.Context) {
 		Status:       req.Status,
 	}
 
-	camp, err := h.campaignService.CreateCampaign(campaign, branchIDs)
+	camp, err := h.campaignService.CreateCampaign(c.Request.Context(), campaign, branchIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"campaign_id": camp.ID})
@@ -186,33 +291,48 @@ func (h *Handler) NewCampaign(c *gin.Context) {
 // given branches. If the campaign is not found, or the brand is not
 // authorized, an error is returned. If the dates are invalid, an
 // error is returned. If there is an error in the database, an error
-// is returned.
+// is returned. Staff scoped to some branches can only modify campaigns
+// that run only in those, and only move them to those. They cannot
+// modify the base campaign, which applies to every branch of the brand,
+// nor rename a campaign to "base".
 func (h *Handler) ModifyCampaign(c *gin.Context) {
-	brandID, err := h.auhorizeBrand(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
+	p := principal(c)
+	brandID := p.ID
 	var req ModifyCampaignRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
 	branchIDs, err := util.ParseBranchIDs(req.BranchIDs)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch_ids"})
+		c.Error(invalidField("branch_ids"))
 		return
 	}
+	if domain.BranchScoped(p.Role) {
+		current, err := h.campaignService.GetCampaign(c.Request.Context(), brandID, req.CampaignID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if current.CampaignName == "base" || req.CampaignName == "base" {
+			c.Error(domain.ErrBaseCampaign)
+			return
+		}
+		if !p.CanAccessBranches(branchIDs) || !p.CanAccessBranches(current.Branches) {
+			c.Error(domain.ErrBranchNotAllowed)
+			return
+		}
+	}
 
 	start, err := util.ParseDate(req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date"})
+		c.Error(invalidField("start_date"))
 		return
 	}
 	end, err := util.ParseDate(req.EndDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date"})
+		c.Error(invalidField("end_date"))
 		return
 	}
 
@@ -229,9 +349,9 @@ func (h *Handler) ModifyCampaign(c *gin.Context) {
 		Status:       req.Status,
 	}
 
-	campaign, err = h.campaignService.UpdateCampaign(campaign, branchIDs)
+	campaign, err = h.campaignService.UpdateCampaign(c.Request.Context(), campaign, branchIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"campaign_id": campaign.ID})
@@ -239,19 +359,21 @@ func (h *Handler) ModifyCampaign(c *gin.Context) {
 
 // MyCampaigns returns all the campaigns of the brand of the given token.
 // If the token is invalid, an error is returned. If there is an error
-// in the database, an error is returned.
+// in the database, an error is returned. Staff scoped to some branches
+// only see the campaigns that run in any of them.
 func (h *Handler) MyCampaigns(c *gin.Context) {
-	brandID, err := h.auhorizeBrand(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
+	p := principal(c)
 
-	campaigns, err := h.campaignService.GetCampaigns(brandID)
+	campaigns, err := h.campaignService.GetCampaigns(c.Request.Context(), p.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	if domain.BranchScoped(p.Role) {
+		campaigns = slices.DeleteFunc(campaigns, func(camp domain.Campaign) bool {
+			return !slices.ContainsFunc(camp.Branches, func(id int) bool { return slices.Contains(p.BranchIDs, id) })
+		})
+	}
 	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
 }
 
@@ -263,25 +385,21 @@ func (h *Handler) MyCampaigns(c *gin.Context) {
 // On success, it returns a 200 OK status with a JSON object
 // with the reward ID.
 func (h *Handler) NewReward(c *gin.Context) {
-	brandID, err := h.auhorizeBrand(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
+	brandID := principal(c).ID
 	var req NewRewardRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
 	start, err := util.ParseDate(req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date"})
+		c.Error(invalidField("start_date"))
 		return
 	}
 	end, err := util.ParseDate(req.EndDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date"})
+		c.Error(invalidField("end_date"))
 		return
 	}
 	reward := &domain.Reward{
@@ -291,9 +409,9 @@ func (h *Handler) NewReward(c *gin.Context) {
 		StartDate:   start,
 		EndDate:     end,
 	}
-	reward, err = h.rewardService.CreateReward(reward)
+	reward, err = h.rewardService.CreateReward(c.Request.Context(), reward)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"reward_id": reward.ID})
@@ -306,45 +424,319 @@ func (h *Handler) NewReward(c *gin.Context) {
 // On success, it returns a 200 OK status with a JSON object containing a list of rewards.
 
 func (h *Handler) MyRewards(c *gin.Context) {
-	brandID, err := h.auhorizeBrand(c)
+	brandID := principal(c).ID
+
+	rewards, err := h.rewardService.GetRewardsByBrand(c.Request.Context(), brandID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"rewards": rewards})
+}
+
+// MySettings returns the loyalty program settings of the authorized brand.
+// If the brand is not authorized, it returns a 401 Unauthorized error.
+// If the service has a problem, it returns a 500 Internal Server Error.
+func (h *Handler) MySettings(c *gin.Context) {
+	brandID := principal(c).ID
 
-	rewards, err := h.rewardService.GetRewardsByBrand(brandID)
+	settings, err := h.brandService.GetSettings(c.Request.Context(), brandID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"rewards": rewards})
+	c.JSON(http.StatusOK, settingsResponse(settings))
+}
+
+// ModifySettings updates the loyalty program settings of the authorized brand.
+// Only the fields present in the JSON body are changed.
+// If the brand is not authorized, it returns a 401 Unauthorized error.
+// If the request is invalid, it returns a 400 Bad Request error.
+// If the service has a problem, it returns a 500 Internal Server Error.
+func (h *Handler) ModifySettings(c *gin.Context) {
+	brandID := principal(c).ID
+	var req BrandSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	settings, err := h.brandService.GetSettings(c.Request.Context(), brandID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if req.AllowPointsTransfer != nil {
+		settings.AllowPointsTransfer = *req.AllowPointsTransfer
+	}
+	if req.CoinsToPointsRate != nil {
+		settings.CoinsToPointsRate = *req.CoinsToPointsRate
+	}
+	if req.PointsToCoinsRate != nil {
+		settings.PointsToCoinsRate = *req.PointsToCoinsRate
+	}
+	if req.ExchangeDailyLimit != nil {
+		settings.ExchangeDailyLimit = *req.ExchangeDailyLimit
+	}
+
+	settings, err = h.brandService.UpdateSettings(c.Request.Context(), settings)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, settingsResponse(settings))
+}
+
+// SettlementStatement returns the coin settlement statement of the authorized brand for the
+// month given in the "period" query parameter (yyyy-mm, the current month by default).
+// With "format=csv" the statement is returned as a CSV file instead of JSON.
+// If the brand is not authorized, it returns a 401 Unauthorized error.
+// If the period is invalid, it returns a 400 Bad Request error.
+// If the service has a problem, it returns a 500 Internal Server Error.
+func (h *Handler) SettlementStatement(c *gin.Context) {
+	brandID := principal(c).ID
+
+	statement, err := h.settlementService.GetStatement(c.Request.Context(), brandID, c.Query("period"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		filename := fmt.Sprintf("settlement_%d_%s.csv", brandID, statement.PeriodStart.Format("2006-01"))
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Data(http.StatusOK, "text/csv", settlementCSV(statement))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"statement": statement})
 }
 
-// auhorizeBrand checks if the given brand ID and token are valid.
-// It reads the required headers from the gin.Context object.
-// If any of the required headers are missing, or if the validation fails, it returns an error.
-// On success, it returns the brand ID and a nil error.
-func (h *Handler) auhorizeBrand(c *gin.Context) (int, error) {
-	brandIDStr := c.GetHeader("Leal-Brand-Id")
-	if brandIDStr == "" {
-		return 0, errors.New("brand_id header required")
+// InviteBrandUser invites someone to the staff of the authorized brand with a role.
+// Branch managers and cashiers need the comma separated IDs of their branches.
+// If the caller cannot manage users, it returns a 403 Forbidden error.
+// If the role or the branches are invalid, it returns a 400 Bad Request error.
+// If the email already belongs to the staff, it returns a 409 Conflict error.
+// On success, it returns a 200 OK status with the invitation ID and the code
+// the invitee accepts it with.
+func (h *Handler) InviteBrandUser(c *gin.Context) {
+	brandID := principal(c).ID
+	var req InviteBrandUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	var branchIDs []int
+	if req.BranchIDs != "" {
+		ids, err := util.ParseBranchIDs(req.BranchIDs)
+		if err != nil {
+			c.Error(invalidField("branch_ids"))
+			return
+		}
+		branchIDs = ids
+	}
+
+	inv, err := h.userService.InviteUser(c.Request.Context(), brandID, req.Email, req.Role, branchIDs)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitation_id": inv.ID, "code": inv.Code, "email": inv.Email, "role": inv.Role})
+}
+
+// AcceptBrandInvitation creates the member of the staff invited with a code, with
+// a name and password, and returns their user_id, brand_id and token.
+// If the invitation is not found, it returns a 404 Not Found error.
+// If it was already accepted, it returns a 409 Conflict error.
+func (h *Handler) AcceptBrandInvitation(c *gin.Context) {
+	var req AcceptBrandInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	req.UserName = util.Sanitize(req.UserName)
+	u, err := h.userService.AcceptInvitation(c.Request.Context(), req.Code, req.UserName, req.Pass)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, brandUserLoginResponse(u))
+}
+
+// LoginBrandUser logs in a member of the staff of a brand, given the brand_name,
+// their email and pass, and returns their user_id, brand_id, role and token.
+// If the credentials are invalid, it returns a 401 Unauthorized error.
+func (h *Handler) LoginBrandUser(c *gin.Context) {
+	var req LoginBrandUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	req.BrandName = util.Sanitize(req.BrandName)
+	u, err := h.userService.LoginUser(c.Request.Context(), req.BrandName, req.Email, req.Pass)
+	if err != nil {
+		c.Error(err)
+		return
 	}
+	c.JSON(http.StatusOK, brandUserLoginResponse(u))
+}
+
+// BrandUsers returns the staff of the authorized brand, with their roles and branches.
+// If the caller cannot manage users, it returns a 403 Forbidden error.
+func (h *Handler) BrandUsers(c *gin.Context) {
+	brandID := principal(c).ID
 
-	brandID, err := strconv.Atoi(brandIDStr)
+	users, err := h.userService.GetUsers(c.Request.Context(), brandID)
 	if err != nil {
-		return 0, errors.New("invalid brand_id")
+		c.Error(err)
+		return
+	}
+	staff := make([]gin.H, len(users))
+	for i, u := range users {
+		staff[i] = gin.H{
+			"user_id":           u.ID,
+			"user_name":         u.Name,
+			"email":             u.Email,
+			"role":              u.Role,
+			"branch_ids":        u.BranchIDs,
+			"active":            u.Active,
+			"registration_date": u.RegistrationDate,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"users": staff})
+}
+
+// ChangeBrandUserRole gives a member of the staff of the authorized brand a new role,
+// with the branch_ids they work with for branch managers and cashiers, and returns
+// their user_id, role and branch_ids.
+// If the member is not found or was deactivated, it returns a 404 Not Found error.
+func (h *Handler) ChangeBrandUserRole(c *gin.Context) {
+	brandID := principal(c).ID
+	var req ChangeBrandUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
 	}
 
-	tokenReq := c.GetHeader("Leal-Brand-Token")
-	if tokenReq == "" {
-		return 0, errors.New("token header required")
+	var branchIDs []int
+	if req.BranchIDs != "" {
+		ids, err := util.ParseBranchIDs(req.BranchIDs)
+		if err != nil {
+			c.Error(invalidField("branch_ids"))
+			return
+		}
+		branchIDs = ids
 	}
 
-	err = h.brandService.ValidateToken(brandID, tokenReq)
+	u, err := h.userService.ChangeUserRole(c.Request.Context(), brandID, req.UserID, req.Role, branchIDs)
 	if err != nil {
-		return 0, err
+		c.Error(err)
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"user_id": u.ID, "role": u.Role, "branch_ids": u.BranchIDs})
+}
 
-	return brandID, nil
+// DeactivateBrandUser removes a member from the staff of the authorized brand. Their
+// token stops working at once and they can no longer log in.
+// If the member is not found or was already deactivated, it returns a 404 Not Found error.
+func (h *Handler) DeactivateBrandUser(c *gin.Context) {
+	brandID := principal(c).ID
+	var req DeactivateBrandUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if err := h.userService.DeactivateUser(c.Request.Context(), brandID, req.UserID); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": req.UserID, "active": false})
+}
+
+// RevokeBrandInvitation revokes a pending invitation to the staff of the authorized
+// brand, so its code can no longer be accepted.
+// If the invitation is not found, it returns a 404 Not Found error.
+// If it was already accepted or revoked, it returns a 409 Conflict error.
+func (h *Handler) RevokeBrandInvitation(c *gin.Context) {
+	brandID := principal(c).ID
+	var req RevokeBrandInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if err := h.userService.RevokeInvitation(c.Request.Context(), brandID, req.InvitationID); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitation_id": req.InvitationID, "status": domain.InvitationRevoked})
+}
+
+// settlementCSV renders a settlement statement as CSV: a summary row with the brand
+// position, a blank line, and one row per payable or receivable obligation.
+func settlementCSV(st *domain.SettlementStatement) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"brand_id", "period_start", "period_end", "coins_issued", "coins_consumed", "net_position", "net_amount"})
+	w.Write([]string{
+		strconv.Itoa(st.BrandID),
+		st.PeriodStart.Format("2006-01-02"),
+		st.PeriodEnd.Format("2006-01-02"),
+		strconv.Itoa(st.Position.Issued),
+		strconv.Itoa(st.Position.Consumed),
+		strconv.Itoa(st.Position.Net),
+		fmt.Sprintf("%.2f", st.NetAmount),
+	})
+	w.Write(nil)
+	w.Write([]string{"type", "debtor_brand_id", "creditor_brand_id", "coins"})
+	for _, o := range st.Payables {
+		w.Write([]string{"payable", strconv.Itoa(o.DebtorBrandID), strconv.Itoa(o.CreditorBrandID), fmt.Sprintf("%.2f", o.Coins)})
+	}
+	for _, o := range st.Receivables {
+		w.Write([]string{"receivable", strconv.Itoa(o.DebtorBrandID), strconv.Itoa(o.CreditorBrandID), fmt.Sprintf("%.2f", o.Coins)})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
 
+// brandUserLoginResponse builds the JSON body returned when a member of the staff logs in.
+func brandUserLoginResponse(u *domain.BrandUser) gin.H {
+	return gin.H{"user_id": u.ID, "brand_id": u.BrandID, "role": u.Role, "token": u.Token}
+}
+
+// branchResponse builds the JSON body of a branch returned by the branch endpoints.
+func branchResponse(br *domain.Branch) gin.H {
+	hours := make([]gin.H, len(br.OpeningHours))
+	for i, h := range br.OpeningHours {
+		hours[i] = gin.H{"day": int(h.Day), "open": h.Open, "close": h.Close}
+	}
+	return gin.H{
+		"branch_id":     br.ID,
+		"brand_id":      br.BrandID,
+		"branch_name":   br.Name,
+		"active":        br.Active,
+		"address":       br.Address,
+		"latitude":      br.Latitude,
+		"longitude":     br.Longitude,
+		"timezone":      br.Timezone,
+		"opening_hours": hours,
+	}
+}
+
+// openingHours converts the opening hours of a request to the ones of a branch.
+func openingHours(req []OpeningHoursRequest) []domain.OpeningHours {
+	hours := make([]domain.OpeningHours, len(req))
+	for i, h := range req {
+		hours[i] = domain.OpeningHours{Day: time.Weekday(h.Day), Open: h.Open, Close: h.Close}
+	}
+	return hours
+}
+
+// settingsResponse builds the JSON body returned by the settings endpoints.
+func settingsResponse(settings *domain.BrandSettings) gin.H {
+	return gin.H{
+		"allow_points_transfer": settings.AllowPointsTransfer,
+		"coins_to_points_rate":  settings.CoinsToPointsRate,
+		"points_to_coins_rate":  settings.PointsToCoinsRate,
+		"exchange_daily_limit":  settings.ExchangeDailyLimit,
+	}
 }
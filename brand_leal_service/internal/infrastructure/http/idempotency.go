@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// Errors of the requests sent with an Idempotency-Key header.
+var (
+	errIdempotencyKeyTooLong    = domain.Validation("idempotency_key_too_long", "Idempotency-Key is too long")
+	errIdempotencyKeyReused     = domain.Conflict("idempotency_key_reused", "Idempotency-Key was already used with a different request")
+	errIdempotencyKeyInProgress = domain.Conflict("idempotency_key_in_progress", "a request with this Idempotency-Key is still being processed")
+)
+
+// IdempotencyMiddleware makes mutating requests sent with an Idempotency-Key header safe to
+// retry. The first request with a key runs normally and its response is stored; a replay
+// with the same key and the same request gets the stored response back, marked with the
+// Idempotent-Replayed header, without running the handler again.
+//
+// It runs after AuthMiddleware, and keys are scoped to the endpoint and the authenticated
+// caller. Reusing a key with a different body, or while the first request is still running,
+// returns 409 Conflict. Responses with a 5xx, 401 or 403 status are not stored, so the
+// request can be retried, for example with valid credentials. Keys expire after ttl.
+func IdempotencyMiddleware(repo domain.IdempotencyRepository, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithProblem(c, newProblem(c, errIdempotencyKeyTooLong))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithProblem(c, newProblem(c, invalidRequest(err)))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &domain.IdempotencyRecord{
+			Scope:       c.Request.Method + " " + c.Request.URL.Path + " " + callerScope(principal(c)),
+			Key:         key,
+			RequestHash: requestHash(c, body),
+		}
+		existing, err := repo.Reserve(c.Request.Context(), record, time.Now().Add(-ttl))
+		if err != nil {
+			abortWithProblem(c, newProblem(c, err))
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != record.RequestHash:
+				abortWithProblem(c, newProblem(c, errIdempotencyKeyReused))
+			case existing.StatusCode == 0:
+				abortWithProblem(c, newProblem(c, errIdempotencyKeyInProgress))
+			default:
+				c.Header(idempotentReplayedHeader, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		// Store the outcome even if the client went away while the handler ran.
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		if !storable(writer.Status()) {
+			if err := repo.Release(ctx, record.Scope, record.Key); err != nil {
+				slog.ErrorContext(ctx, "Error releasing idempotency key", "key", record.Key, "error", err)
+			}
+			return
+		}
+		record.StatusCode = writer.Status()
+		record.ContentType = writer.Header().Get("Content-Type")
+		record.ResponseBody = writer.body.Bytes()
+		if err := repo.Complete(ctx, record); err != nil {
+			slog.ErrorContext(ctx, "Error storing response for idempotency key", "key", record.Key, "error", err)
+		}
+	}
+}
+
+// storable reports whether a response with the given status is stored for its key. Server
+// errors may not happen again, and 401 and 403 responses are answered before the request
+// runs, so a retry must run it.
+func storable(status int) bool {
+	return status < http.StatusInternalServerError && status != http.StatusUnauthorized && status != http.StatusForbidden
+}
+
+// callerScope identifies the authenticated caller of a request in the scope of its keys:
+// the brand and the member of its staff calling, or the service and the brand it acts for.
+func callerScope(p *domain.Principal) string {
+	return string(p.Kind) + ":" + p.Service + ":" + strconv.Itoa(p.ID) + ":" + strconv.Itoa(p.UserID)
+}
+
+// requestHash fingerprints a request by its method, path, query and body, so a key cannot
+// be replayed with different content.
+func requestHash(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + "\n" + c.Request.URL.Path + "\n" + c.Request.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body written by the handler.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
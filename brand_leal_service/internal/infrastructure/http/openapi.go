@@ -0,0 +1,120 @@
+package http
+
+import (
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec is the OpenAPI 3 document of the brand service, served at /openapi.json and
+// used to validate the requests.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// FieldError is an invalid field of a request: a body field, a query parameter or a header.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// OpenAPI serves the OpenAPI document of the service.
+func OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// ValidationMiddleware validates the requests to the routes of the OpenAPI document against
+// it: required fields, types, ranges, formats and query parameters. Invalid requests are
+// answered with an invalid_request problem listing the invalid fields, without reaching
+// the handler. Routes not in the document, such as the health checks, are not validated, and
+// neither are the credentials, which the handlers check.
+func ValidationMiddleware() (gin.HandlerFunc, error) {
+	router, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{
+		MultiError:          true,
+		SkipSettingDefaults: true,
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+	}
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+		err = openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		})
+		if err != nil {
+			problem := newProblem(c, domain.ErrInvalidRequest)
+			problem.Errors = fieldErrors(err)
+			abortWithProblem(c, problem)
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// loadSpec parses and checks the OpenAPI document and returns a router of its operations.
+// Dates are checked the way the handlers parse them, which also rejects days out of range.
+func loadSpec() (routers.Router, error) {
+	openapi3.DefineStringFormatCallback("date", func(value string) error {
+		_, err := time.Parse(time.DateOnly, value)
+		return err
+	})
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, err
+	}
+	return legacy.NewRouter(doc)
+}
+
+// fieldErrors flattens the errors returned by the validation into one error per field.
+// Body fields are named by their path in the body, such as "items.0.name", and parameters
+// by their name.
+func fieldErrors(err error) []FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var fields []FieldError
+		for _, err := range e {
+			fields = append(fields, fieldErrors(err)...)
+		}
+		return fields
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			if e.Err == nil {
+				return []FieldError{{Field: e.Parameter.Name, Message: e.Reason}}
+			}
+			fields := fieldErrors(e.Err)
+			for i := range fields {
+				fields[i].Field = e.Parameter.Name
+			}
+			return fields
+		}
+		var schemaErr *openapi3.SchemaError
+		var multi openapi3.MultiError
+		if errors.As(e.Err, &schemaErr) || errors.As(e.Err, &multi) {
+			return fieldErrors(e.Err)
+		}
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			return []FieldError{{Field: strings.Join(pointer, "."), Message: e.Reason}}
+		}
+		return []FieldError{{Field: "body", Message: e.Reason}}
+	}
+	return []FieldError{{Field: "body", Message: err.Error()}}
+}
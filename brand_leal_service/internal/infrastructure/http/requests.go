@@ -11,7 +11,32 @@ type LoginBrandRequest struct {
 }
 
 type NewBranchRequest struct {
-	BranchName string `json:"branch_name"`
+	BranchName   string                `json:"branch_name"`
+	Address      string                `json:"address"`
+	Latitude     *float64              `json:"latitude"`
+	Longitude    *float64              `json:"longitude"`
+	Timezone     string                `json:"timezone"`
+	OpeningHours []OpeningHoursRequest `json:"opening_hours"`
+}
+
+type ModifyBranchRequest struct {
+	BranchID     int                   `json:"branch_id"`
+	BranchName   string                `json:"branch_name"`
+	Address      string                `json:"address"`
+	Latitude     *float64              `json:"latitude"`
+	Longitude    *float64              `json:"longitude"`
+	Timezone     string                `json:"timezone"`
+	OpeningHours []OpeningHoursRequest `json:"opening_hours"`
+}
+
+type DeactivateBranchRequest struct {
+	BranchID int `json:"branch_id"`
+}
+
+type OpeningHoursRequest struct {
+	Day   int    `json:"day"` // 0 is Sunday
+	Open  string `json:"open"`
+	Close string `json:"close"`
 }
 
 type NewCampaignRequest struct {
@@ -48,3 +73,42 @@ type NewRewardRequest struct {
 	StartDate   string `json:"start_date"`
 	EndDate     string `json:"end_date"`
 }
+
+type BrandSettingsRequest struct {
+	AllowPointsTransfer *bool    `json:"allow_points_transfer"`
+	CoinsToPointsRate   *float64 `json:"coins_to_points_rate"`
+	PointsToCoinsRate   *float64 `json:"points_to_coins_rate"`
+	ExchangeDailyLimit  *int     `json:"exchange_daily_limit"`
+}
+
+type InviteBrandUserRequest struct {
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	BranchIDs string `json:"branch_ids"` // comma separated ids, for branch managers and cashiers
+}
+
+type ChangeBrandUserRoleRequest struct {
+	UserID    int    `json:"user_id"`
+	Role      string `json:"role"`
+	BranchIDs string `json:"branch_ids"` // comma separated ids, for branch managers and cashiers
+}
+
+type DeactivateBrandUserRequest struct {
+	UserID int `json:"user_id"`
+}
+
+type RevokeBrandInvitationRequest struct {
+	InvitationID int `json:"invitation_id"`
+}
+
+type AcceptBrandInvitationRequest struct {
+	Code     string `json:"code"`
+	UserName string `json:"user_name"`
+	Pass     string `json:"pass"`
+}
+
+type LoginBrandUserRequest struct {
+	BrandName string `json:"brand_name"`
+	Email     string `json:"email"`
+	Pass      string `json:"pass"`
+}
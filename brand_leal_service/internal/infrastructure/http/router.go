@@ -1,25 +1,59 @@
 package http
 
 import (
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/metrics"
 	"github.com/gin-gonic/gin"
 )
 
 // NewRouter returns a new gin Engine with all the routes needed for the
-// brand service.
-func NewRouter(h *Handler) *gin.Engine {
-	r := gin.Default()
+// brand service, plus the liveness, readiness, metrics and OpenAPI document
+// routes. The given middlewares run before every route, followed by the
+// error middleware. The routes of a brand are grouped behind auth, which
+// authenticates the caller, and idempotency, which replays retried requests
+// of that caller, and each of them requires the permission its role needs;
+// registration, logins, accepting an invitation, the branch locator and the
+// operational routes are public. Panics are recovered, but requests are not
+// logged by gin, so that the logging middleware writes them as structured
+// records.
+func NewRouter(h *Handler, health *HealthHandler, auth gin.HandlerFunc, idempotency gin.HandlerFunc, middlewares ...gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(middlewares...)
+	r.Use(ErrorMiddleware())
 	//health check
 	r.GET("/ping", h.Ping)
+	r.GET("/healthz", health.Liveness)
+	r.GET("/readyz", health.Readiness)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.GET("/openapi.json", OpenAPI)
+
+	// Public brand endpoints
+	public := r.Group("/")
+	public.POST("/new-brand", h.NewBrand)
+	public.POST("/login-brand", h.LoginBrand)
+	public.POST("/accept-brand-invitation", h.AcceptBrandInvitation)
+	public.POST("/login-brand-user", h.LoginBrandUser)
+	public.GET("/nearest-branches", h.NearestBranches)
 
 	// Brand endpoints
-	r.POST("/new-brand", h.NewBrand)
-	r.POST("/login-brand", h.LoginBrand)
-	r.POST("/new-branch", h.NewBranch)
-	r.GET("/my-branches", h.MyBranches)
-	r.POST("/new-campaign", h.NewCampaign)
-	r.POST("/modify-campaign", h.ModifyCampaign)
-	r.GET("/my-campaigns", h.MyCampaigns)
-	r.POST("/new-reward", h.NewReward)
-	r.GET("/my-rewards", h.MyRewards)
+	brand := r.Group("/", auth, idempotency, ErrorMiddleware())
+	brand.POST("/new-branch", RequirePermission(domain.PermManageBranches), h.NewBranch)
+	brand.POST("/modify-branch", RequirePermission(domain.PermManageBranches), h.ModifyBranch)
+	brand.POST("/deactivate-branch", RequirePermission(domain.PermManageBranches), h.DeactivateBranch)
+	brand.GET("/my-branches", RequirePermission(domain.PermViewBranches), h.MyBranches)
+	brand.POST("/new-campaign", RequirePermission(domain.PermManageCampaigns), h.NewCampaign)
+	brand.POST("/modify-campaign", RequirePermission(domain.PermManageCampaigns), h.ModifyCampaign)
+	brand.GET("/my-campaigns", RequirePermission(domain.PermViewCampaigns), h.MyCampaigns)
+	brand.POST("/new-reward", RequirePermission(domain.PermManageRewards), h.NewReward)
+	brand.GET("/my-rewards", RequirePermission(domain.PermViewRewards), h.MyRewards)
+	brand.GET("/my-settings", RequirePermission(domain.PermManageSettings), h.MySettings)
+	brand.POST("/modify-settings", RequirePermission(domain.PermManageSettings), h.ModifySettings)
+	brand.GET("/settlement-statement", RequirePermission(domain.PermViewSettlement), h.SettlementStatement)
+	brand.POST("/invite-brand-user", RequirePermission(domain.PermManageUsers), h.InviteBrandUser)
+	brand.GET("/brand-users", RequirePermission(domain.PermManageUsers), h.BrandUsers)
+	brand.POST("/change-brand-user-role", RequirePermission(domain.PermManageUsers), h.ChangeBrandUserRole)
+	brand.POST("/deactivate-brand-user", RequirePermission(domain.PermManageUsers), h.DeactivateBrandUser)
+	brand.POST("/revoke-brand-invitation", RequirePermission(domain.PermManageUsers), h.RevokeBrandInvitation)
 	return r
 }
@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/util"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+// probeRoutes are the probe and scrape routes, logged at debug level.
+var probeRoutes = map[string]bool{"/ping": true, "/healthz": true, "/readyz": true, "/metrics": true}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	correlationIDKey
+)
+
+// Init replaces the default logger, which the log package writes to as well, with a JSON
+// logger of the given level (debug, info, warn or error) that masks passwords, tokens,
+// emails and phones, and adds the request ID, correlation ID and trace ID of the context
+// to every record.
+func Init(level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: l})
+	slog.SetDefault(slog.New(&redactHandler{next: &contextHandler{next: handler}}))
+	return nil
+}
+
+// WithRequestID returns a copy of ctx carrying the ID of the HTTP request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID of the event being
+// processed.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// HTTPMiddleware gives every request an ID, taken from the X-Request-Id header or
+// generated, returns it in the same header and adds it to the context of the request. Once
+// the request is served, it is logged with its status and duration; probe and scrape
+// requests at debug level.
+func HTTPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(requestIDHeader)
+		if id == "" {
+			id, _ = util.GenerateToken()
+		}
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= 500:
+			level = slog.LevelError
+		case probeRoutes[c.Request.URL.Path]:
+			level = slog.LevelDebug
+		}
+		slog.Log(c.Request.Context(), level, "HTTP request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// contextHandler adds the request ID, correlation ID and trace context found in the
+// context to the records.
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id, ok := ctx.Value(correlationIDKey).(string); ok && id != "" {
+		r.AddAttrs(slog.String("correlation_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// secretKeys are the parts of an attribute or field name whose value is never written.
+	secretKeys = []string{"pass", "token", "secret", "authorization", "hash"}
+
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+?\d(?:[ -]?\d){9,14}`)
+)
+
+// redactHandler masks passwords, tokens, emails and phones in the message and the
+// attributes of a record before passing it to the next handler. Attributes are matched by
+// name, at any depth of groups, maps and structs, and any string is scanned for emails and
+// phone numbers.
+type redactHandler struct {
+	next slog.Handler
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, maskString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = redactAttr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(masked)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch {
+	case v.Kind() == slog.KindGroup:
+		group := v.Group()
+		masked := make([]any, len(group))
+		for i, ga := range group {
+			masked[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, masked...)
+	case isSecret(a.Key):
+		return slog.String(a.Key, redacted)
+	case v.Kind() == slog.KindString:
+		return slog.String(a.Key, maskField(a.Key, v.String()))
+	case v.Kind() == slog.KindAny:
+		return slog.Any(a.Key, redactValue(a.Key, v.Any()))
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactValue masks a value of any type. Errors are written as their masked message, and
+// other values are converted to their JSON form so their fields can be masked by name.
+func redactValue(key string, value any) any {
+	if err, ok := value.(error); ok {
+		return maskString(err.Error())
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return maskString(fmt.Sprintf("%+v", value))
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return maskString(string(b))
+	}
+	return redactJSON(key, decoded)
+}
+
+func redactJSON(key string, value any) any {
+	if isSecret(key) {
+		return redacted
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for k, field := range v {
+			v[k] = redactJSON(k, field)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactJSON(key, item)
+		}
+	case string:
+		return maskField(key, v)
+	}
+	return value
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskField masks a string by the name of its field: emails, phones and contacts (an
+// email or a phone) are always masked, and any other string is scanned for them.
+func maskField(key string, value string) string {
+	switch key = strings.ToLower(key); {
+	case strings.Contains(key, "email"):
+		return maskEmail(value)
+	case strings.Contains(key, "phone"):
+		return maskPhone(value)
+	case strings.Contains(key, "contact"):
+		if strings.Contains(value, "@") {
+			return maskEmail(value)
+		}
+		return maskPhone(value)
+	}
+	return maskString(value)
+}
+
+// maskString masks the emails and phone numbers found in s.
+func maskString(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, maskEmail)
+	return phonePattern.ReplaceAllStringFunc(s, maskPhone)
+}
+
+// maskEmail keeps the first character of the local part and the domain: j***@example.com.
+func maskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	return local[:1] + "***@" + domain
+}
+
+// maskPhone keeps the last 4 digits: ***4567.
+func maskPhone(phone string) string {
+	digits := make([]byte, 0, len(phone))
+	for i := 0; i < len(phone); i++ {
+		if phone[i] >= '0' && phone[i] <= '9' {
+			digits = append(digits, phone[i])
+		}
+	}
+	if len(digits) <= 4 {
+		return "***"
+	}
+	return "***" + string(digits[len(digits)-4:])
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	purchasesProcessed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purchases_processed_total",
+		Help:      "Purchases processed into points and coins, by brand.",
+	}, []string{"brand_id"})
+
+	purchasesRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purchases_rejected_total",
+		Help:      "Purchases rejected without rewards, by brand and reason.",
+	}, []string{"brand_id", "reason"})
+
+	pointsIssued = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_issued_total",
+		Help:      "Points issued for purchases, by brand and campaign.",
+	}, []string{"brand_id", "campaign_id"})
+
+	coinsIssued = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coins_issued_total",
+		Help:      "Leal coins issued for purchases, by brand and campaign.",
+	}, []string{"brand_id", "campaign_id"})
+)
+
+type prometheusBusinessMetrics struct{}
+
+func NewPrometheusBusinessMetrics() domain.BusinessMetrics {
+	return &prometheusBusinessMetrics{}
+}
+
+func (m *prometheusBusinessMetrics) PurchaseProcessed(brandID int) {
+	purchasesProcessed.WithLabelValues(strconv.Itoa(brandID)).Inc()
+}
+
+func (m *prometheusBusinessMetrics) PurchaseRejected(brandID int, reason string) {
+	purchasesRejected.WithLabelValues(strconv.Itoa(brandID), reason).Inc()
+}
+
+func (m *prometheusBusinessMetrics) RewardIssued(brandID int, campaignID int, points float64, coins float64) {
+	brand, campaign := strconv.Itoa(brandID), strconv.Itoa(campaignID)
+	if points > 0 {
+		pointsIssued.WithLabelValues(brand, campaign).Add(points)
+	}
+	if coins > 0 {
+		coinsIssued.WithLabelValues(brand, campaign).Add(coins)
+	}
+}
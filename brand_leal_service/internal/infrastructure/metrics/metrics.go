@@ -0,0 +1,113 @@
+// Package metrics exposes the Prometheus metrics of the service: HTTP requests, events
+// produced and consumed, consumer lag, database pool stats and business counters.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "leal"
+
+// registry holds the metrics of the service, with the Go runtime and process metrics the
+// default registry would have. It is its own, so that both services can run in one process
+// in the end-to-end tests without their metrics colliding.
+var (
+	registry = prometheus.NewRegistry()
+	factory  = promauto.With(registry)
+)
+
+func init() {
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	eventsProduced = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_produced_total",
+		Help:      "Events sent to the broker, by topic, event type and result (ok or error).",
+	}, []string{"topic", "event_type", "result"})
+
+	eventsConsumed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_consumed_total",
+		Help:      "Events consumed from the broker, by topic, event type and result (ok or error).",
+	}, []string{"topic", "event_type", "result"})
+
+	consumerLag = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag",
+		Help:      "Messages behind the high water mark of each consumed partition.",
+	}, []string{"topic", "partition"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(registry, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// HTTPMiddleware records the count and latency of every request by its route pattern,
+// so paths with parameters do not create a series each. Unknown routes are recorded as
+// "unmatched".
+func HTTPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterDB exports the connection pool stats of db, labeled with dbName.
+func RegisterDB(db *sql.DB, dbName string) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// EventProduced counts an event sent to the broker, or that failed to be sent.
+func EventProduced(topic string, eventType string, err error) {
+	eventsProduced.WithLabelValues(topic, eventType, result(err)).Inc()
+}
+
+// EventConsumed counts an event consumed from the broker, by whether it was processed.
+func EventConsumed(topic string, eventType string, err error) {
+	eventsConsumed.WithLabelValues(topic, eventType, result(err)).Inc()
+}
+
+// SetConsumerLag records how many messages a consumed partition is behind.
+func SetConsumerLag(topic string, partition int32, lag int64) {
+	consumerLag.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
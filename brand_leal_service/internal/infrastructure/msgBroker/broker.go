@@ -0,0 +1,130 @@
+package msgBroker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/IBM/sarama"
+
+	"github.com/degarzonm/brand_leal_service/internal/application"
+	"github.com/degarzonm/brand_leal_service/internal/config"
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
+)
+
+// Broker types selectable with MSG_BROKER_TYPE.
+const (
+	BrokerKafka    = "kafka"
+	BrokerMemory   = "memory"
+	BrokerPostgres = "postgres"
+)
+
+// Broker gives the event producer and listeners of one of the supported transports.
+type Broker interface {
+	Producer() domain.EventProducer
+	// Listener creates a listener that passes the messages of the given topics to the
+	// application service.
+	Listener(appService *application.AppService, topics []string) (Listener, error)
+	// Health reports whether events can be sent, with details about the connection.
+	Health(ctx context.Context) (map[string]any, error)
+	Close() error
+}
+
+// Listener is an event listener that can report its health.
+type Listener interface {
+	domain.EventListener
+	// Health reports whether the listener is consuming its topics, with the number of
+	// messages waiting to be consumed.
+	Health(ctx context.Context) (map[string]any, error)
+}
+
+// NewBroker creates the broker of the configured type. The postgres broker keeps its queue
+// in the database of MSG_QUEUE_DSN.
+func NewBroker() (Broker, error) {
+	cfg := config.GetConfig()
+	switch cfg.MsgBrokerType {
+	case BrokerKafka:
+		producer, err := NewKafkaProducer()
+		if err != nil {
+			return nil, err
+		}
+		client, err := sarama.NewClient(cfg.KafkaBrokers, sarama.NewConfig())
+		if err != nil {
+			producer.(*KafkaProducer).Close()
+			return nil, err
+		}
+		return &kafkaBroker{producer: producer.(*KafkaProducer), client: client}, nil
+	case BrokerMemory:
+		return &memoryBroker{broker: NewMemoryBroker()}, nil
+	case BrokerPostgres:
+		queueDB, err := tracing.OpenDB(cfg.MsgQueueDSN)
+		if err != nil {
+			return nil, err
+		}
+		if err := queueDB.Ping(); err != nil {
+			queueDB.Close()
+			return nil, err
+		}
+		return &postgresBroker{queue: NewPostgresQueue(queueDB, cfg.MsgQueuePollInterval), db: queueDB}, nil
+	}
+	return nil, fmt.Errorf("unknown message broker type %q", cfg.MsgBrokerType)
+}
+
+type kafkaBroker struct {
+	producer *KafkaProducer
+	client   sarama.Client // used to check the cluster is reachable
+}
+
+func (b *kafkaBroker) Producer() domain.EventProducer { return b.producer }
+
+func (b *kafkaBroker) Listener(appService *application.AppService, topics []string) (Listener, error) {
+	return NewKafkaListener(appService, topics)
+}
+
+// Health refreshes the cluster metadata, which fails when no broker can be reached.
+func (b *kafkaBroker) Health(_ context.Context) (map[string]any, error) {
+	if err := b.client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	return map[string]any{"brokers": len(b.client.Brokers())}, nil
+}
+
+func (b *kafkaBroker) Close() error {
+	b.client.Close()
+	return b.producer.Close()
+}
+
+type memoryBroker struct {
+	broker *MemoryBroker
+}
+
+func (b *memoryBroker) Producer() domain.EventProducer { return b.broker }
+
+func (b *memoryBroker) Listener(appService *application.AppService, topics []string) (Listener, error) {
+	return NewMemoryListener(b.broker, appService, topics), nil
+}
+
+func (b *memoryBroker) Health(_ context.Context) (map[string]any, error) {
+	return nil, b.broker.bus.Err()
+}
+
+func (b *memoryBroker) Close() error { return b.broker.Close() }
+
+type postgresBroker struct {
+	queue *PostgresQueue
+	db    *sql.DB // the queue database
+}
+
+func (b *postgresBroker) Producer() domain.EventProducer { return b.queue }
+
+func (b *postgresBroker) Listener(appService *application.AppService, topics []string) (Listener, error) {
+	return NewPostgresListener(b.queue, appService, topics), nil
+}
+
+// Health checks the queue database can be reached.
+func (b *postgresBroker) Health(ctx context.Context) (map[string]any, error) {
+	return nil, b.queue.queue.Ping(ctx)
+}
+
+func (b *postgresBroker) Close() error { return b.db.Close() }
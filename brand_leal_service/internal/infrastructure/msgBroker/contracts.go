@@ -0,0 +1,83 @@
+package msgBroker
+
+import (
+	"fmt"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/leal_contracts/events"
+)
+
+// toContract maps the domain payload of an event to its contract in the shared
+// contracts module, which defines how it is serialized.
+func toContract(event domain.Event) (any, error) {
+	switch payload := event.Payload.(type) {
+	case domain.LealPointsApply:
+		breakdown := make([]events.PointsBreakdown, len(payload.Breakdown))
+		for i, b := range payload.Breakdown {
+			breakdown[i] = events.PointsBreakdown{CampaignID: b.CampaignID, CampaignName: b.CampaignName, Points: b.Points, Coins: b.Coins}
+		}
+		return events.PointsApply{
+			PurchaseID: payload.PurchaseID,
+			CustomerID: payload.CustomerID,
+			BrandID:    payload.BrandID,
+			Points:     payload.Points,
+			Coins:      payload.Coins,
+			Reason:     payload.Reason,
+			Breakdown:  breakdown,
+		}, nil
+	case domain.PurchaseRejection:
+		return events.PurchaseRejected{
+			PurchaseID: payload.PurchaseID,
+			CustomerID: payload.CustomerID,
+			BrandID:    payload.BrandID,
+			BranchID:   payload.BranchID,
+			CoinsUsed:  payload.CoinsUsed,
+			Reason:     payload.Reason,
+		}, nil
+	case domain.BrandSettings:
+		return events.BrandSettingsUpdated{
+			BrandID:             payload.BrandID,
+			AllowPointsTransfer: payload.AllowPointsTransfer,
+			CoinsToPointsRate:   payload.CoinsToPointsRate,
+			PointsToCoinsRate:   payload.PointsToCoinsRate,
+			ExchangeDailyLimit:  payload.ExchangeDailyLimit,
+		}, nil
+	}
+	return nil, fmt.Errorf("no contract for %s payload %T", event.Type, event.Payload)
+}
+
+// decodePurchase reads a purchase created event of any supported version.
+func decodePurchase(body []byte) (domain.Purchase, *events.Envelope, error) {
+	var data events.PurchaseCreated
+	env, err := events.Decode(events.TypePurchaseCreated, body, &data)
+	if err != nil {
+		return domain.Purchase{}, nil, err
+	}
+	return domain.Purchase{
+		ID:           data.PurchaseID,
+		CustomerID:   data.CustomerID,
+		Amount:       data.Amount,
+		PurchaseDate: data.PurchaseDate,
+		BrandID:      data.BrandID,
+		BranchID:     data.BranchID,
+		CoinsUsed:    data.CoinsUsed,
+	}, env, nil
+}
+
+// decodeExchange reads an exchange completed event of any supported version.
+func decodeExchange(body []byte) (domain.Exchange, *events.Envelope, error) {
+	var data events.ExchangeCompleted
+	env, err := events.Decode(events.TypeExchangeCompleted, body, &data)
+	if err != nil {
+		return domain.Exchange{}, nil, err
+	}
+	return domain.Exchange{
+		ID:         data.ExchangeID,
+		CustomerID: data.CustomerID,
+		BrandID:    data.BrandID,
+		Direction:  data.Direction,
+		Coins:      data.Coins,
+		Points:     data.Points,
+		Date:       data.ExchangedAt,
+	}, env, nil
+}
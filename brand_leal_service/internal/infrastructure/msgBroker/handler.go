@@ -0,0 +1,61 @@
+package msgBroker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/degarzonm/brand_leal_service/internal/application"
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/logging"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/metrics"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
+)
+
+// eventHandler passes the consumed messages to the application layer, whatever broker
+// they come from.
+type eventHandler struct {
+	appService *application.AppService
+}
+
+// handle routes a message by its event type and processes it with the given context, in a
+// span that continues the trace of the producer. Errors are logged and counted in the
+// consumed events metric, and the message is dropped.
+func (h *eventHandler) handle(ctx context.Context, msg *message) {
+	meta := msg.metadata()
+	ctx = logging.WithCorrelationID(ctx, meta.CorrelationID)
+	slog.InfoContext(ctx, "Processing event", "event_type", meta.Type, "topic", msg.Topic)
+
+	ctx, span := tracing.StartConsumer(ctx, msg.Topic, meta.Type, msg.Headers)
+	err := h.process(ctx, meta, msg)
+	tracing.End(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error processing event", "event_type", meta.Type, "topic", msg.Topic, "error", err)
+	}
+	metrics.EventConsumed(msg.Topic, meta.Type, err)
+}
+
+// process handles a message of a known event type. Purchase and exchange events are decoded
+// with the shared contracts, which upcasts older versions to the current one, and passed to
+// the application layer, purchases along with their correlation ID. Events of a version newer than the
+// contracts know fail to decode.
+func (h *eventHandler) process(ctx context.Context, meta domain.EventMetadata, msg *message) error {
+	switch meta.Type {
+	case domain.EventPurchaseCreated:
+		purchase, env, err := decodePurchase(msg.Value)
+		if err != nil {
+			return fmt.Errorf("decoding purchase: %w", err)
+		}
+		if meta.CorrelationID == "" {
+			meta.CorrelationID = env.CorrelationID
+		}
+		return h.appService.ProcessPurchase(ctx, purchase, meta.CorrelationID)
+	case domain.EventExchangeCompleted:
+		exchange, _, err := decodeExchange(msg.Value)
+		if err != nil {
+			return fmt.Errorf("decoding exchange: %w", err)
+		}
+		return h.appService.ProcessExchange(ctx, exchange)
+	}
+	return fmt.Errorf("unhandled event type %q", meta.Type)
+}
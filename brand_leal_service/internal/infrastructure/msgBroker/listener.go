@@ -2,30 +2,40 @@ package msgBroker
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 
 	"github.com/IBM/sarama"
 	"github.com/degarzonm/brand_leal_service/internal/application"
 	"github.com/degarzonm/brand_leal_service/internal/config"
-	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/metrics"
 )
 
 type KafkaListener struct {
 	consumerGroup sarama.ConsumerGroup
-	appService    *application.AppService
+	group         string
+	topics        []string
+	handler       *eventHandler
+
+	// Consumer group membership and lag, for Health.
+	mu           sync.Mutex
+	memberID     string
+	generationID int32
+	lag          map[string]int64 // "topic/partition" -> messages behind the high water mark
 }
 
 // NewKafkaListener creates a new Kafka listener instance that consumes
-// messages from the topic specified in the configuration, and passes them
-// to the provided application service for processing.
+// messages from the given topics, and passes them to the provided
+// application service for processing.
 //
 // The application service is expected to have a ProcessPurchase method
-// that takes a domain.Purchase as an argument.
+// that takes a domain.Purchase and its correlation ID as arguments.
 //
 // The returned listener instance is ready to be used with the Listen
 // method to start consuming messages.
-func NewKafkaListener(appService *application.AppService) (*KafkaListener, error) {
+func NewKafkaListener(appService *application.AppService, topics []string) (*KafkaListener, error) {
 	cfg := config.GetConfig()
 	kafkaConfig := sarama.NewConfig()
 	kafkaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
@@ -36,61 +46,115 @@ func NewKafkaListener(appService *application.AppService) (*KafkaListener, error
 	}
 	return &KafkaListener{
 		consumerGroup: consumerGroup,
-		appService:    appService,
+		group:         cfg.BrandGroup,
+		topics:        topics,
+		handler:       &eventHandler{appService: appService},
 	}, nil
 }
 
-// Listen starts consuming messages from the topics specified in the configuration.
+// Listen starts consuming messages from the topics of the listener until ctx is
+// cancelled. It then waits for the messages being handled, commits the offsets of the
+// handled messages and closes the consumer group.
 //
-// The method will loop indefinitely, and will log any errors that occur while
-// consuming messages. The method will return an error if the underlying
-// consumer group fails to consume from the topics.
-func (kl *KafkaListener) Listen() error {
-	cfg := config.GetConfig()
-	topics := []string{cfg.MsgPurchaseTopic}
-
+// The method will log any errors that occur while consuming messages, and will
+// return an error if the underlying consumer group fails to consume from the topics.
+func (kl *KafkaListener) Listen(ctx context.Context) error {
+	defer kl.consumerGroup.Close()
 	for {
-		if err := kl.consumerGroup.Consume(context.Background(), topics, kl); err != nil {
-			log.Printf("Error consuming Kafka topics: %v", err)
+		if err := kl.consumerGroup.Consume(ctx, kl.topics, kl); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return nil
+			}
+			slog.ErrorContext(ctx, "Error consuming Kafka topics", "error", err)
 			return err
 		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Setup records the membership of the new consumer group session and the partitions
+// claimed by it.
+func (kl *KafkaListener) Setup(session sarama.ConsumerGroupSession) error {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	kl.memberID = session.MemberID()
+	kl.generationID = session.GenerationID()
+	kl.lag = map[string]int64{}
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			kl.lag[fmt.Sprintf("%s/%d", topic, partition)] = 0
+		}
 	}
+	return nil
 }
 
-func (kl *KafkaListener) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
-func (kl *KafkaListener) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+// Cleanup clears the membership when the session ends, until the next one is set up.
+func (kl *KafkaListener) Cleanup(_ sarama.ConsumerGroupSession) error {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	kl.memberID = ""
+	kl.lag = nil
+	return nil
+}
+
+// Health reports the consumer group membership of the listener and its lag per partition,
+// as of the last message consumed. It fails while the listener has no group session.
+func (kl *KafkaListener) Health(_ context.Context) (map[string]any, error) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.memberID == "" {
+		return nil, errors.New("not a member of consumer group " + kl.group)
+	}
+	lag := make(map[string]int64, len(kl.lag))
+	for partition, behind := range kl.lag {
+		lag[partition] = behind
+	}
+	return map[string]any{
+		"group":         kl.group,
+		"member_id":     kl.memberID,
+		"generation_id": kl.generationID,
+		"lag":           lag,
+	}, nil
+}
 
 // ConsumeClaim processes messages from the Kafka topic.
 //
-// The method will loop indefinitely, and will log any errors that occur while
-// consuming messages. The method will return an error if the underlying
-// consumer group fails to consume from the topics.
-//
-// The method will unmarshal purchase messages from the MSG_PURCHASE topic,
-// and pass them to the application layer to be processed. Any errors that occur
-// while processing the purchase will be logged.
-//
-// If the method encounters an unhandled topic, it will log a message indicating
-// this.
+// The method loops until the session ends, passing every message to the event handler
+// and marking it as consumed once handled. Messages are handled with the session context
+// detached from its cancellation, so a message being handled when the listener stops
+// is finished and marked before the session ends.
 func (kl *KafkaListener) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	cfg := config.GetConfig()
-
-	for message := range claim.Messages() {
-		log.Println("Processing message from topic:", message.Topic)
-		switch message.Topic {
-		case cfg.MsgPurchaseTopic:
-			var purchase domain.Purchase
-			if err := json.Unmarshal(message.Value, &purchase); err != nil {
-				log.Printf("Error unmarshalling purchase: %v", err)
-				continue
-			}
-			if err := kl.appService.ProcessPurchase(purchase); err != nil {
-				log.Printf("Error processing purchase: %v", err)
+	for {
+		var msg *sarama.ConsumerMessage
+		select {
+		case <-session.Context().Done():
+			return nil
+		case m, ok := <-claim.Messages():
+			if !ok {
+				return nil
 			}
-		default:
-			log.Printf("Unhandled topic: %s", message.Topic)
+			msg = m
+		}
+		m := &message{
+			Topic:   msg.Topic,
+			Key:     string(msg.Key),
+			Value:   msg.Value,
+			Headers: map[string]string{},
+		}
+		for _, h := range msg.Headers {
+			m.Headers[string(h.Key)] = string(h.Value)
 		}
-		session.MarkMessage(message, "")
+		kl.handler.handle(context.WithoutCancel(session.Context()), m)
+		session.MarkMessage(msg, "")
+
+		lag := claim.HighWaterMarkOffset() - msg.Offset - 1
+		kl.mu.Lock()
+		if kl.lag != nil {
+			kl.lag[fmt.Sprintf("%s/%d", msg.Topic, msg.Partition)] = lag
+		}
+		kl.mu.Unlock()
+		metrics.SetConsumerLag(msg.Topic, msg.Partition, lag)
 	}
-	return nil
 }
@@ -0,0 +1,90 @@
+package msgBroker
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/degarzonm/brand_leal_service/internal/application"
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/metrics"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
+	"github.com/degarzonm/leal_contracts/bus"
+)
+
+// MemoryBroker is an in-process broker, for tests and for running the service without
+// Kafka. Every topic is a queue shared by the listeners subscribed to it, like the
+// consumers of a Kafka consumer group; messages sent before a listener starts are kept
+// until one consumes them. Messages are lost when the process exits.
+type MemoryBroker struct {
+	bus *bus.Bus
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return NewMemoryBrokerOn(bus.New())
+}
+
+// NewMemoryBrokerOn creates a broker on a bus shared with other services of the process,
+// which consume the events it sends and send it theirs.
+func NewMemoryBrokerOn(b *bus.Bus) *MemoryBroker {
+	return &MemoryBroker{bus: b}
+}
+
+// SendEvent appends the event to the queue of the topic and wakes up its listeners.
+func (b *MemoryBroker) SendEvent(ctx context.Context, topic string, event domain.Event) (err error) {
+	defer func() { metrics.EventProduced(topic, event.Type, err) }()
+	ctx, span := tracing.StartProducer(ctx, topic, event.Type)
+	defer func() { tracing.End(span, err) }()
+
+	m, err := newMessage(ctx, topic, event)
+	if err != nil {
+		return err
+	}
+	if err := b.bus.Publish(bus.Message(*m)); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Event queued", "event_type", event.Type, "topic", topic, "correlation_id", event.CorrelationID)
+	return nil
+}
+
+// Close stops the listeners of the broker, and of every other broker on its bus. Queued
+// messages are discarded.
+func (b *MemoryBroker) Close() error {
+	return b.bus.Close()
+}
+
+type memoryListener struct {
+	broker  *MemoryBroker
+	topics  []string
+	handler *eventHandler
+}
+
+// NewMemoryListener creates a listener that consumes the given topics of the broker and
+// passes their messages to the application service.
+func NewMemoryListener(broker *MemoryBroker, appService *application.AppService, topics []string) Listener {
+	return &memoryListener{broker: broker, topics: topics, handler: &eventHandler{appService: appService}}
+}
+
+// Listen handles the messages of the listener topics until the broker is closed or ctx is
+// cancelled. A message being handled when ctx is cancelled is finished first.
+func (l *memoryListener) Listen(ctx context.Context) error {
+	for {
+		m, ok := l.broker.bus.Next(ctx, l.topics)
+		if !ok {
+			return nil
+		}
+		msg := message(m)
+		l.handler.handle(context.WithoutCancel(ctx), &msg)
+	}
+}
+
+// Health reports the messages queued on the listener topics.
+func (l *memoryListener) Health(_ context.Context) (map[string]any, error) {
+	if err := l.broker.bus.Err(); err != nil {
+		return nil, err
+	}
+	lag := map[string]int{}
+	for _, topic := range l.topics {
+		lag[topic] = l.broker.bus.Len(topic)
+	}
+	return map[string]any{"lag": lag}, nil
+}
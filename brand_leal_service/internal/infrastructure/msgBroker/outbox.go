@@ -0,0 +1,77 @@
+package msgBroker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/degarzonm/brand_leal_service/internal/domain"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
+)
+
+// outboxBatchSize is the number of outbox events sent in each transaction.
+const outboxBatchSize = 100
+
+// OutboxRelay sends the events stored in the outbox with the producer of the configured
+// broker, and deletes them once sent. An event whose transaction committed is sent at
+// least once, so consumers must tolerate duplicates, which they already do for redelivered
+// messages.
+type OutboxRelay struct {
+	uow          domain.UnitOfWork
+	producer     domain.EventProducer
+	pollInterval time.Duration
+}
+
+func NewOutboxRelay(uow domain.UnitOfWork, producer domain.EventProducer, pollInterval time.Duration) *OutboxRelay {
+	return &OutboxRelay{uow: uow, producer: producer, pollInterval: pollInterval}
+}
+
+// Run sends the outbox events until ctx is cancelled, waiting the poll interval whenever
+// the outbox is empty. Errors are logged and retried after the interval. A batch being
+// sent when ctx is cancelled is finished first.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		sent, err := r.relayBatch(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.ErrorContext(ctx, "Error relaying outbox events", "error", err)
+		}
+		if sent == outboxBatchSize && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// relayBatch sends the oldest events of the outbox, in order, deleting each one once sent.
+// When an event cannot be sent, its failed attempt is recorded, the events sent before it
+// are still deleted and the rest are left for the next batch. Events the outbox cannot
+// decode are dead-lettered by it and never reach the relay. It returns the number of
+// events sent.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	sent := 0
+	var sendErr error
+	err := r.uow.Do(ctx, func(repos domain.Repositories) error {
+		pending, err := repos.Outbox.GetPendingEvents(ctx, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range pending {
+			eventCtx := tracing.Extract(ctx, e.TraceHeaders)
+			if sendErr = r.producer.SendEvent(eventCtx, e.Topic, e.Event); sendErr != nil {
+				return repos.Outbox.RecordFailure(ctx, e.ID, sendErr.Error())
+			}
+			if err := repos.Outbox.DeleteEvent(ctx, e.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	if err != nil {
+		return sent, err
+	}
+	return sent, sendErr
+}
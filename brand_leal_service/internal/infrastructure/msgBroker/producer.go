@@ -1,13 +1,14 @@
 package msgBroker
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/IBM/sarama"
 	"github.com/degarzonm/brand_leal_service/internal/config"
 	"github.com/degarzonm/brand_leal_service/internal/domain"
-	"github.com/degarzonm/brand_leal_service/internal/infrastructure/util"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/metrics"
+	"github.com/degarzonm/brand_leal_service/internal/infrastructure/tracing"
 )
 
 type KafkaProducer struct {
@@ -33,28 +34,35 @@ func NewKafkaProducer() (domain.EventProducer, error) {
 	return &KafkaProducer{Producer: producer}, nil
 }
 
-// SendMessage sends a message to the specified Kafka topic.
+// SendEvent sends an event to the specified Kafka topic.
 //
-// It generates a unique key for the message using the util.GenerateToken function.
-// The message is marshaled into JSON format and sent as a Kafka ProducerMessage
-// with the specified topic and the generated key. If the message is successfully
-// sent, it logs the partition and offset of the message in the topic.
+// The event is encoded by newMessage and sent as a Kafka ProducerMessage keyed by its
+// partition key, so the hash partitioner sends the events of the same customer to the
+// same partition. The sync producer cannot be cancelled, so the context is only checked
+// before sending. If the message is successfully sent, it logs the partition and offset
+// of the message in the topic.
+func (kp *KafkaProducer) SendEvent(ctx context.Context, topic string, event domain.Event) (err error) {
+	defer func() { metrics.EventProduced(topic, event.Type, err) }()
+	ctx, span := tracing.StartProducer(ctx, topic, event.Type)
+	defer func() { tracing.End(span, err) }()
 
-func (kp *KafkaProducer) SendMessage(topic string, message interface{}) error {
-	key, err := util.GenerateToken()
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	messageBytes, err := json.Marshal(message)
+	m, err := newMessage(ctx, topic, event)
 	if err != nil {
 		return err
 	}
 
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
-		Key:   sarama.StringEncoder(key),
-		Value: sarama.ByteEncoder(messageBytes),
+		Value: sarama.ByteEncoder(m.Value),
+	}
+	for key, value := range m.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	if m.Key != "" {
+		msg.Key = sarama.StringEncoder(m.Key)
 	}
 
 	partition, offset, err := kp.Producer.SendMessage(msg)
@@ -62,6 +70,11 @@ func (kp *KafkaProducer) SendMessage(topic string, message interface{}) error {
 		return err
 	}
 
-	log.Printf("Message sent to topic %s [partition=%d, offset=%d]\n", topic, partition, offset)
+	slog.InfoContext(ctx, "Event sent", "event_type", event.Type, "topic", topic, "partition", partition, "offset", offset, "correlation_id", event.CorrelationID)
 	return nil
 }
+
+// Close closes the underlying Kafka producer.
+func (kp *KafkaProducer) Close() error {
+	return kp.Producer.Close()
+}
@@ -6,7 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"regexp"
 	"strconv"
 	"strings"
@@ -28,7 +28,6 @@ func HashPassword(pass string) string {
 // uses a cryptographically secure hashing algorithm.
 func CheckPassHash(pass string, hashed string) bool {
 	attempPass := HashPassword(pass)
-	log.Println(attempPass, "   :    ", hashed)
 	return attempPass == hashed
 }
 
@@ -83,7 +82,6 @@ func ParseBranchIDs(branchIDs string) ([]int, error) {
 		return nil, errors.New("branch_ids cannot be empty")
 	}
 
-	log.Println("branch_ids: ", branchIDs)
 	idStrings := strings.Split(branchIDs, ",")
 	ids := make([]int, len(idStrings))
 
@@ -94,6 +92,6 @@ func ParseBranchIDs(branchIDs string) ([]int, error) {
 		}
 		ids[i] = id
 	}
-	log.Println("ids: ", ids)
+	slog.Debug("Parsed branch IDs", "branch_ids", ids)
 	return ids, nil
 }
@@ -0,0 +1,102 @@
+// Package bus is an in-process message transport shared by the services, so they can
+// exchange events in one process without Kafka: each service's memory broker sends to
+// and consumes from a Bus, and two services given the same Bus see each other's events.
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned once the bus is closed.
+var ErrClosed = errors.New("memory bus is closed")
+
+// Message is an encoded event as carried by the bus, with its partition key and headers.
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Bus keeps a queue per topic, shared by the consumers of the topic like the consumers of
+// a Kafka consumer group. Messages published before a consumer starts are kept until one
+// takes them, and are lost when the process exits.
+type Bus struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string][]Message
+	closed bool
+}
+
+func New() *Bus {
+	b := &Bus{queues: map[string][]Message{}}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Publish appends the message to the queue of its topic and wakes up its consumers.
+func (b *Bus) Publish(m Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	b.queues[m.Topic] = append(b.queues[m.Topic], m)
+	b.cond.Broadcast()
+	return nil
+}
+
+// Next blocks until one of the topics has a message and takes it off its queue.
+// It returns false once the bus is closed or ctx is cancelled.
+func (b *Bus) Next(ctx context.Context, topics []string) (Message, bool) {
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.cond.Broadcast()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if b.closed || ctx.Err() != nil {
+			return Message{}, false
+		}
+		for _, topic := range topics {
+			if queue := b.queues[topic]; len(queue) > 0 {
+				b.queues[topic] = queue[1:]
+				return queue[0], true
+			}
+		}
+		b.cond.Wait()
+	}
+}
+
+// Len returns the number of messages queued on the topic.
+func (b *Bus) Len(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queues[topic])
+}
+
+// Err returns ErrClosed once the bus is closed.
+func (b *Bus) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close stops the consumers of the bus. Queued messages are discarded.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.queues = map[string][]Message{}
+	b.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,79 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestNextTakesQueuedMessagesInOrder checks that messages published before a consumer
+// starts are kept, and taken once each in order.
+func TestNextTakesQueuedMessagesInOrder(t *testing.T) {
+	b := New()
+	for _, key := range []string{"1", "2"} {
+		if err := b.Publish(Message{Topic: "a", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := b.Len("a"); n != 2 {
+		t.Errorf("%d messages queued, want 2", n)
+	}
+	for _, want := range []string{"1", "2"} {
+		m, ok := b.Next(context.Background(), []string{"b", "a"})
+		if !ok || m.Key != want {
+			t.Fatalf("got %+v, %v, want message %s", m, ok, want)
+		}
+	}
+	if n := b.Len("a"); n != 0 {
+		t.Errorf("%d messages queued, want none", n)
+	}
+}
+
+// TestNextWaitsForPublish checks that a consumer waiting on an empty topic is woken up by
+// the next message published to it.
+func TestNextWaitsForPublish(t *testing.T) {
+	b := New()
+	got := make(chan Message)
+	go func() {
+		m, _ := b.Next(context.Background(), []string{"a"})
+		got <- m
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := b.Publish(Message{Topic: "a", Key: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-got:
+		if m.Key != "1" {
+			t.Errorf("got message %s, want 1", m.Key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+}
+
+// TestNextStops checks that a waiting consumer returns once its context is cancelled or
+// the bus is closed, and that a closed bus refuses new messages.
+func TestNextStops(t *testing.T) {
+	b := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := b.Next(ctx, []string{"a"}); ok {
+		t.Error("Next returned a message after ctx was cancelled")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Close()
+	}()
+	if _, ok := b.Next(context.Background(), []string{"a"}); ok {
+		t.Error("Next returned a message after the bus was closed")
+	}
+	if err := b.Publish(Message{Topic: "a"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish error %v, want ErrClosed", err)
+	}
+	if err := b.Err(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Err %v, want ErrClosed", err)
+	}
+}
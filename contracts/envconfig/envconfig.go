@@ -0,0 +1,228 @@
+// Package envconfig reads the settings of the services from the environment and an
+// optional YAML file, validating each one and collecting every problem found.
+package envconfig
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Loader reads settings from the environment and, for the ones not set there, from the
+// YAML file named by CONFIG_FILE. Every setting is read with its type, default and
+// constraints, and the problems found are collected instead of stopping at the first one.
+type Loader struct {
+	file     map[string]string
+	problems []string
+}
+
+// NewLoader reads the config file, if any. The file holds the same keys as the
+// environment variables; lists are joined with commas and maps into key=value pairs.
+func NewLoader() *Loader {
+	l := &Loader{file: map[string]string{}}
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return l
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.Problem("CONFIG_FILE: %v", err)
+		return l
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		l.Problem("CONFIG_FILE %s: %v", path, err)
+		return l
+	}
+	for key, value := range values {
+		l.file[strings.ToUpper(key)] = flatten(value)
+	}
+	return l
+}
+
+// Err returns the problems found, if any, as a ValidationError.
+func (l *Loader) Err() error {
+	if len(l.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: l.problems}
+}
+
+// Problem records a problem with the settings, reported by Err.
+func (l *Loader) Problem(format string, args ...any) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+// lookup returns the value of key, from the environment or else from the config file.
+// Empty values count as unset.
+func (l *Loader) lookup(key string) (string, bool) {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value, true
+	}
+	value, ok := l.file[key]
+	return value, ok && value != ""
+}
+
+// Required returns the value of key, which must be set.
+func (l *Loader) Required(key string) string {
+	value, ok := l.lookup(key)
+	if !ok {
+		l.Problem("%s is required", key)
+	}
+	return value
+}
+
+// Optional returns the value of key, or def when it is not set.
+func (l *Loader) Optional(key string, def string) string {
+	if value, ok := l.lookup(key); ok {
+		return value
+	}
+	return def
+}
+
+// OneOf returns the value of key, or def when it is not set, which must be one of allowed.
+func (l *Loader) OneOf(key string, def string, allowed ...string) string {
+	value := l.Optional(key, def)
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	l.Problem("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+	return value
+}
+
+// Int returns the value of key as an integer of at least min, or def when it is not set.
+func (l *Loader) Int(key string, def int, min int) int {
+	value, ok := l.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.Problem("%s must be an integer, got %q", key, value)
+		return def
+	}
+	if n < min {
+		l.Problem("%s must be at least %d, got %d", key, min, n)
+	}
+	return n
+}
+
+// RequiredInt returns the value of key, which must be set, as an integer between min and max.
+func (l *Loader) RequiredInt(key string, min int, max int) int {
+	if _, ok := l.lookup(key); !ok {
+		l.Problem("%s is required", key)
+		return 0
+	}
+	n := l.Int(key, 0, min)
+	if n > max {
+		l.Problem("%s must be at most %d, got %d", key, max, n)
+	}
+	return n
+}
+
+// Float returns the value of key as a number of at least min, or def when it is not set.
+func (l *Loader) Float(key string, def float64, min float64) float64 {
+	value, ok := l.lookup(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		l.Problem("%s must be a number, got %q", key, value)
+		return def
+	}
+	if f < min {
+		l.Problem("%s must be at least %g, got %g", key, min, f)
+	}
+	return f
+}
+
+// Duration returns the value of key, a positive count of unit, or def units when it is
+// not set.
+func (l *Loader) Duration(key string, def int, unit time.Duration) time.Duration {
+	return time.Duration(l.Int(key, def, 1)) * unit
+}
+
+// Bool returns the value of key as a boolean, or def when it is not set.
+func (l *Loader) Bool(key string, def bool) bool {
+	value, ok := l.lookup(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.Problem("%s must be true or false, got %q", key, value)
+		return def
+	}
+	return b
+}
+
+// List returns the comma separated values of key, which must have at least one value
+// when required.
+func (l *Loader) List(key string, required bool) []string {
+	var values []string
+	raw, _ := l.lookup(key)
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if required && len(values) == 0 {
+		l.Problem("%s is required", key)
+	}
+	return values
+}
+
+// Pairs parses the comma separated key=value pairs of key, such as
+// "purchase-topic=customer_id,brand-settings-topic=brand_id", into a map.
+func (l *Loader) Pairs(key string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range l.List(key, false) {
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			l.Problem("%s must be a list of key=value pairs, got %q", key, pair)
+			continue
+		}
+		pairs[k] = v
+	}
+	return pairs
+}
+
+// flatten converts a value of the config file to the form of an environment variable.
+func flatten(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = flatten(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]any:
+		items := make([]string, 0, len(v))
+		for k, item := range v {
+			items = append(items, k+"="+flatten(item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,72 @@
+package envconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoaderReadsEnvironmentBeforeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "db_host: file-host\nmsg_broker_address: [a:9092, b:9092]\nmsg_key_fields:\n  purchase-topic: customer_id\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("OUTBOX_POLL_MS", "250")
+
+	l := NewLoader()
+	if got := l.Required("DB_HOST"); got != "env-host" {
+		t.Errorf("DB_HOST = %q, want the environment value", got)
+	}
+	if got := l.RequiredInt("DB_PORT", 1, 65535); got != 5432 {
+		t.Errorf("DB_PORT = %d, want 5432", got)
+	}
+	if got := l.Duration("OUTBOX_POLL_MS", 500, time.Millisecond); got != 250*time.Millisecond {
+		t.Errorf("OUTBOX_POLL_MS = %v, want 250ms", got)
+	}
+	if got := l.List("MSG_BROKER_ADDRESS", true); !reflect.DeepEqual(got, []string{"a:9092", "b:9092"}) {
+		t.Errorf("MSG_BROKER_ADDRESS = %v, want the file list", got)
+	}
+	if got := l.Pairs("MSG_KEY_FIELDS"); !reflect.DeepEqual(got, map[string]string{"purchase-topic": "customer_id"}) {
+		t.Errorf("MSG_KEY_FIELDS = %v, want the file map", got)
+	}
+	if got := l.Optional("LOG_LEVEL", "info"); got != "info" {
+		t.Errorf("LOG_LEVEL = %q, want the default", got)
+	}
+	if err := l.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestLoaderCollectsEveryProblem(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_PORT", "99999")
+	t.Setenv("MSG_BROKER_TYPE", "rabbit")
+	t.Setenv("MIGRATE_ON_START", "maybe")
+
+	l := NewLoader()
+	l.Required("DB_HOST")
+	l.RequiredInt("DB_PORT", 1, 65535)
+	l.OneOf("MSG_BROKER_TYPE", "kafka", "kafka", "memory", "postgres")
+	l.Bool("MIGRATE_ON_START", true)
+
+	var verr *ValidationError
+	if err := l.Err(); !errors.As(err, &verr) {
+		t.Fatalf("Err() = %v, want a ValidationError", err)
+	}
+	want := []string{
+		"DB_HOST is required",
+		"DB_PORT must be at most 65535, got 99999",
+		`MSG_BROKER_TYPE must be one of kafka, memory, postgres, got "rabbit"`,
+		`MIGRATE_ON_START must be true or false, got "maybe"`,
+	}
+	if !reflect.DeepEqual(verr.Problems, want) {
+		t.Errorf("problems = %q, want %q", verr.Problems, want)
+	}
+}
@@ -0,0 +1,114 @@
+// Package events holds the contracts of the events exchanged by the Leal services
+// through Kafka: the envelope every event is wrapped in, the versioned payload of each
+// event type, and the upcasters that turn older payload versions into the current one.
+//
+// The JSON Schema of each payload version lives in the schemas directory of this module.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event types.
+const (
+	TypePurchaseCreated      = "purchase.created"
+	TypePointsApply          = "points.apply"
+	TypeBrandSettingsUpdated = "brand.settings.updated"
+	TypePurchaseRejected     = "purchase.rejected"
+	TypeExchangeCompleted    = "exchange.completed"
+)
+
+// currentVersions is the payload version each event type is produced with.
+var currentVersions = map[string]int{
+	TypePurchaseCreated:      2,
+	TypePointsApply:          3,
+	TypeBrandSettingsUpdated: 2,
+	TypePurchaseRejected:     1,
+	TypeExchangeCompleted:    1,
+}
+
+// ErrUnsupportedVersion is returned when an event was produced with a payload version
+// newer than the one this module knows, so it cannot be read safely.
+var ErrUnsupportedVersion = errors.New("unsupported event version")
+
+// Envelope wraps every event. Version is the schema version of Data.
+type Envelope struct {
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// CurrentVersion returns the payload version events of the given type are produced with,
+// or 0 for unknown types.
+func CurrentVersion(eventType string) int {
+	return currentVersions[eventType]
+}
+
+// Encode wraps data, the current payload of the given event type, in an envelope and
+// returns its JSON.
+func Encode(eventType string, correlationID string, data any) ([]byte, error) {
+	version := CurrentVersion(eventType)
+	if version == 0 {
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		Type:          eventType,
+		Version:       version,
+		CorrelationID: correlationID,
+		ProducedAt:    time.Now().UTC(),
+		Data:          raw,
+	})
+}
+
+// Decode reads an event of the given type into out, which must point to the current
+// payload struct of that type, and returns its envelope.
+//
+// Payloads of older versions are upcast to the current one. A body without an envelope
+// is read as version 1, the bare payload the services sent before envelopes existed.
+// Versions newer than the current one return ErrUnsupportedVersion.
+func Decode(eventType string, body []byte, out any) (*Envelope, error) {
+	current := CurrentVersion(eventType)
+	if current == 0 {
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, err
+	}
+	if env.Version == 0 {
+		env = Envelope{Type: eventType, Version: 1, Data: body}
+	}
+	if env.Type != eventType {
+		return nil, fmt.Errorf("expected event %q, got %q", eventType, env.Type)
+	}
+	if env.Version > current {
+		return nil, fmt.Errorf("%w: %s v%d", ErrUnsupportedVersion, eventType, env.Version)
+	}
+
+	for env.Version < current {
+		upcast, ok := upcasters[upcasterKey{eventType, env.Version}]
+		if !ok {
+			return nil, fmt.Errorf("no upcaster for %s v%d", eventType, env.Version)
+		}
+		data, err := upcast(env.Data)
+		if err != nil {
+			return nil, fmt.Errorf("upcasting %s v%d: %w", eventType, env.Version, err)
+		}
+		env.Data = data
+		env.Version++
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
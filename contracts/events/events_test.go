@@ -0,0 +1,218 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var producedAt = time.Date(2024, 5, 2, 15, 4, 5, 0, time.UTC)
+
+// TestDecodeGoldenFixtures decodes a message of every version each event type was ever
+// produced with, from testdata, into the current payload struct.
+func TestDecodeGoldenFixtures(t *testing.T) {
+	purchase := PurchaseCreated{PurchaseID: 7, CustomerID: 3, BrandID: 2, BranchID: 4, Amount: 120.5, CoinsUsed: 10, PurchaseDate: producedAt}
+	points := PointsApply{CustomerID: 3, BrandID: 2, Points: 120, Coins: 12, Reason: "purchase"}
+	settings := BrandSettingsUpdated{BrandID: 2, AllowPointsTransfer: true, CoinsToPointsRate: 10, PointsToCoinsRate: 0.1, ExchangeDailyLimit: 1000}
+
+	tests := []struct {
+		file          string
+		eventType     string
+		correlationID string
+		out           any
+		want          any
+	}{
+		{"purchase.created.v1.json", TypePurchaseCreated, "", &PurchaseCreated{}, &purchase},
+		{"purchase.created.v2.json", TypePurchaseCreated, "c0ffee", &PurchaseCreated{}, &purchase},
+		{"points.apply.v1.json", TypePointsApply, "", &PointsApply{}, &points},
+		{"points.apply.v2.json", TypePointsApply, "c0ffee", &PointsApply{}, &points},
+		{"points.apply.v3.json", TypePointsApply, "c0ffee", &PointsApply{}, &PointsApply{
+			PurchaseID: 7, CustomerID: 3, BrandID: 2, Points: 120, Coins: 12, Reason: "purchase",
+			Breakdown: []PointsBreakdown{
+				{CampaignID: 1, CampaignName: "base", Points: 60, Coins: 6},
+				{CampaignID: 5, CampaignName: "double points", Points: 60, Coins: 6},
+			},
+		}},
+		{"brand.settings.updated.v1.json", TypeBrandSettingsUpdated, "", &BrandSettingsUpdated{}, &settings},
+		{"brand.settings.updated.v2.json", TypeBrandSettingsUpdated, "", &BrandSettingsUpdated{}, &settings},
+		{"purchase.rejected.v1.json", TypePurchaseRejected, "c0ffee", &PurchaseRejected{}, &PurchaseRejected{
+			PurchaseID: 7, CustomerID: 3, BrandID: 2, BranchID: 4, CoinsUsed: 10, Reason: "branch_closed",
+		}},
+		{"exchange.completed.v1.json", TypeExchangeCompleted, "c0ffee", &ExchangeCompleted{}, &ExchangeCompleted{
+			ExchangeID: 9, CustomerID: 3, BrandID: 2, Direction: "coins_to_points", Coins: 50, Points: 500,
+			ExchangedAt: producedAt.Add(3 * time.Second),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, err := Decode(tt.eventType, body, tt.out)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(tt.out, tt.want) {
+				t.Errorf("decoded %+v, want %+v", tt.out, tt.want)
+			}
+			if env.Version != CurrentVersion(tt.eventType) {
+				t.Errorf("envelope version %d, want the current %d", env.Version, CurrentVersion(tt.eventType))
+			}
+			if env.CorrelationID != tt.correlationID {
+				t.Errorf("correlation ID %q, want %q", env.CorrelationID, tt.correlationID)
+			}
+		})
+	}
+}
+
+// TestEncodeDecode checks that a current payload survives a round trip.
+func TestEncodeDecode(t *testing.T) {
+	in := PointsApply{PurchaseID: 7, CustomerID: 3, BrandID: 2, Points: 1, Coins: 1, Reason: "purchase"}
+	body, err := Encode(TypePointsApply, "c0ffee", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out PointsApply
+	env, err := Decode(TypePointsApply, body, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) || env.CorrelationID != "c0ffee" {
+		t.Errorf("decoded %+v with correlation ID %q, want %+v", out, env.CorrelationID, in)
+	}
+}
+
+func TestDecodeRejectsNewerVersions(t *testing.T) {
+	body := []byte(`{"type": "points.apply", "version": 99, "produced_at": "2024-05-02T15:04:05Z", "data": {}}`)
+	if _, err := Decode(TypePointsApply, body, &PointsApply{}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Decode error %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestDecodeRejectsOtherTypes(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "purchase.rejected.v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(TypePointsApply, body, &PointsApply{}); err == nil {
+		t.Error("decoded a purchase.rejected event as points.apply")
+	}
+}
+
+// schema is the part of a JSON Schema the payload structs are checked against.
+type schema struct {
+	Required   []string          `json:"required"`
+	Properties map[string]schema `json:"properties"`
+	Items      *schema           `json:"items"`
+	Enum       []string          `json:"enum"`
+}
+
+func readSchema(t *testing.T, name string) schema {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("..", "schemas", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s schema
+	if err := json.Unmarshal(body, &s); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return s
+}
+
+// TestSchemasMatchPayloads checks that the schema of the current version of every event
+// type has a property for each field of its payload struct and no other, and requires
+// exactly the fields that are not omitted when empty.
+func TestSchemasMatchPayloads(t *testing.T) {
+	payloads := map[string]any{
+		TypePurchaseCreated:      PurchaseCreated{},
+		TypePointsApply:          PointsApply{},
+		TypeBrandSettingsUpdated: BrandSettingsUpdated{},
+		TypePurchaseRejected:     PurchaseRejected{},
+		TypeExchangeCompleted:    ExchangeCompleted{},
+	}
+	for eventType := range currentVersions {
+		if _, ok := payloads[eventType]; !ok {
+			t.Errorf("no payload struct checked for %s", eventType)
+		}
+	}
+	for eventType, payload := range payloads {
+		name := eventType + ".v" + strconv.Itoa(CurrentVersion(eventType)) + ".json"
+		t.Run(name, func(t *testing.T) {
+			checkSchema(t, name, readSchema(t, name), reflect.TypeOf(payload))
+		})
+	}
+}
+
+func checkSchema(t *testing.T, path string, s schema, typ reflect.Type) {
+	t.Helper()
+	fields := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		fields[name] = true
+
+		prop, ok := s.Properties[name]
+		if !ok {
+			t.Errorf("%s: no property for field %s (%q)", path, f.Name, name)
+			continue
+		}
+		omitted := strings.Contains(opts, "omitempty")
+		if required := slices.Contains(s.Required, name); required == omitted {
+			t.Errorf("%s: %q required is %v, but the field is omitted when empty: %v", path, name, required, omitted)
+		}
+		if f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct {
+			if prop.Items == nil {
+				t.Errorf("%s: %q has no items schema", path, name)
+				continue
+			}
+			checkSchema(t, path+"/"+name, *prop.Items, f.Type.Elem())
+		}
+	}
+	for name := range s.Properties {
+		if !fields[name] {
+			t.Errorf("%s: property %q has no field in %s", path, name, typ.Name())
+		}
+	}
+	for _, name := range s.Required {
+		if !fields[name] {
+			t.Errorf("%s: required %q has no field in %s", path, name, typ.Name())
+		}
+	}
+}
+
+// TestEnvelopeSchemaListsEveryType checks that the envelope schema accepts every event
+// type at every version it is produced with.
+func TestEnvelopeSchemaListsEveryType(t *testing.T) {
+	var env struct {
+		Properties struct {
+			Type    schema `json:"type"`
+			Version struct {
+				Minimum int `json:"minimum"`
+			} `json:"version"`
+		} `json:"properties"`
+	}
+	body, err := os.ReadFile(filepath.Join("..", "schemas", "envelope.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		t.Fatal(err)
+	}
+	for eventType, version := range currentVersions {
+		if !slices.Contains(env.Properties.Type.Enum, eventType) {
+			t.Errorf("envelope type does not list %s", eventType)
+		}
+		if version < env.Properties.Version.Minimum {
+			t.Errorf("%s is produced at version %d, below the envelope minimum %d", eventType, version, env.Properties.Version.Minimum)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package events
+
+import "time"
+
+// PurchaseCreated is published by the customer service when a customer makes a purchase
+// (version 2).
+type PurchaseCreated struct {
+	PurchaseID   int       `json:"purchase_id"`
+	CustomerID   int       `json:"customer_id"`
+	BrandID      int       `json:"brand_id"`
+	BranchID     int       `json:"branch_id"`
+	Amount       float64   `json:"amount"`
+	CoinsUsed    int       `json:"coins_used"`
+	PurchaseDate time.Time `json:"purchase_date"`
+}
+
+// PointsApply is published by the brand service with the points and coins a customer
+// earns, usually for a purchase (version 3). PurchaseID is the purchase they are earned
+// for, zero otherwise, and Breakdown what the base campaign and each other campaign
+// issued for it.
+type PointsApply struct {
+	PurchaseID int               `json:"purchase_id,omitempty"`
+	CustomerID int               `json:"customer_id"`
+	BrandID    int               `json:"brand_id"`
+	Points     int               `json:"points"`
+	Coins      int               `json:"coins"`
+	Reason     string            `json:"reason"`
+	Breakdown  []PointsBreakdown `json:"breakdown,omitempty"`
+}
+
+// PointsBreakdown is what a campaign issued towards a PointsApply.
+type PointsBreakdown struct {
+	CampaignID   int     `json:"campaign_id"`
+	CampaignName string  `json:"campaign_name"`
+	Points       float64 `json:"points"`
+	Coins        float64 `json:"coins"`
+}
+
+// BrandSettingsUpdated is published by the brand service when a brand changes the
+// settings the customer service enforces (version 2).
+type BrandSettingsUpdated struct {
+	BrandID             int     `json:"brand_id"`
+	AllowPointsTransfer bool    `json:"allow_points_transfer"`
+	CoinsToPointsRate   float64 `json:"coins_to_points_rate"`
+	PointsToCoinsRate   float64 `json:"points_to_coins_rate"`
+	ExchangeDailyLimit  int     `json:"exchange_daily_limit"`
+}
+
+// PurchaseRejected is published by the brand service when a purchase cannot be rewarded,
+// because its branch does not exist, is closed or belongs to another brand, so the customer
+// service rejects it and gives the coins used back (version 1).
+type PurchaseRejected struct {
+	PurchaseID int    `json:"purchase_id"`
+	CustomerID int    `json:"customer_id"`
+	BrandID    int    `json:"brand_id"`
+	BranchID   int    `json:"branch_id"`
+	CoinsUsed  int    `json:"coins_used"`
+	Reason     string `json:"reason"`
+}
+
+// ExchangeCompleted is published by the customer service when a customer exchanges Leal
+// coins for points of a brand (coins_to_points) or points of a brand for coins
+// (points_to_coins), so the brand service settles the coins with the brand (version 1).
+type ExchangeCompleted struct {
+	ExchangeID  int       `json:"exchange_id"`
+	CustomerID  int       `json:"customer_id"`
+	BrandID     int       `json:"brand_id"`
+	Direction   string    `json:"direction"`
+	Coins       int       `json:"coins"`
+	Points      int       `json:"points"`
+	ExchangedAt time.Time `json:"exchanged_at"`
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type upcasterKey struct {
+	eventType string
+	version   int
+}
+
+// upcasters turn the payload of an event type from a version into the next one.
+var upcasters = map[upcasterKey]func(json.RawMessage) (json.RawMessage, error){
+	{TypePurchaseCreated, 1}:      upcastPurchaseCreatedV1,
+	{TypePointsApply, 1}:          upcastPointsApplyV1,
+	{TypePointsApply, 2}:          upcastPointsApplyV2,
+	{TypeBrandSettingsUpdated, 1}: upcastBrandSettingsUpdatedV1,
+}
+
+// Version 1 payloads are the Go structs of the services marshaled without tags,
+// so their fields are named after the struct fields.
+
+type purchaseCreatedV1 struct {
+	ID           int
+	CustomerID   int
+	Amount       float64
+	PurchaseDate time.Time
+	BrandID      int
+	BranchID     int
+	CoinsUsed    int
+}
+
+type pointsApplyV1 struct {
+	CustomerID int
+	BrandID    int
+	Points     int
+	Coins      int
+	Reason     string
+}
+
+type brandSettingsUpdatedV1 struct {
+	BrandID             int
+	AllowPointsTransfer bool
+	CoinsToPointsRate   float64
+	PointsToCoinsRate   float64
+	ExchangeDailyLimit  int
+}
+
+// pointsApplyV2 is version 2 of PointsApply, without the purchase and breakdown.
+type pointsApplyV2 struct {
+	CustomerID int    `json:"customer_id"`
+	BrandID    int    `json:"brand_id"`
+	Points     int    `json:"points"`
+	Coins      int    `json:"coins"`
+	Reason     string `json:"reason"`
+}
+
+func upcastPurchaseCreatedV1(data json.RawMessage) (json.RawMessage, error) {
+	var v1 purchaseCreatedV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	return json.Marshal(PurchaseCreated{
+		PurchaseID:   v1.ID,
+		CustomerID:   v1.CustomerID,
+		BrandID:      v1.BrandID,
+		BranchID:     v1.BranchID,
+		Amount:       v1.Amount,
+		CoinsUsed:    v1.CoinsUsed,
+		PurchaseDate: v1.PurchaseDate,
+	})
+}
+
+func upcastPointsApplyV1(data json.RawMessage) (json.RawMessage, error) {
+	var v1 pointsApplyV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	return json.Marshal(pointsApplyV2(v1))
+}
+
+func upcastPointsApplyV2(data json.RawMessage) (json.RawMessage, error) {
+	var v2 pointsApplyV2
+	if err := json.Unmarshal(data, &v2); err != nil {
+		return nil, err
+	}
+	return json.Marshal(PointsApply{
+		CustomerID: v2.CustomerID,
+		BrandID:    v2.BrandID,
+		Points:     v2.Points,
+		Coins:      v2.Coins,
+		Reason:     v2.Reason,
+	})
+}
+
+func upcastBrandSettingsUpdatedV1(data json.RawMessage) (json.RawMessage, error) {
+	var v1 brandSettingsUpdatedV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	return json.Marshal(BrandSettingsUpdated(v1))
+}
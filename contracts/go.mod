@@ -0,0 +1,8 @@
+module github.com/degarzonm/leal_contracts
+
+go 1.23
+
+require (
+	github.com/lib/pq v1.10.9
+	gopkg.in/yaml.v3 v3.0.1
+)
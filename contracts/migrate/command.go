@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const usage = "usage: migrate up | down [steps] | force <version> | status"
+
+// Command runs the migrate subcommand of a service with its arguments: up applies the
+// pending migrations, down reverts the last steps migrations (1 by default), force records
+// the schema as clean at a version and status prints the version of the schema.
+func Command(ctx context.Context, migrator *Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migrations\n", reverted)
+	case "force":
+		if len(args) < 2 {
+			return errors.New(usage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("Schema forced to version %d\n", version)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Version: %d\nDirty: %t\nLatest: %d\nPending: %d\n", status.Version, status.Dirty, status.Latest, status.Pending)
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
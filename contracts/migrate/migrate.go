@@ -0,0 +1,312 @@
+// Package migrate applies the versioned schema migrations of a service to its database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lockKey identifies the advisory lock held while migrating, so that only one instance of
+// a service migrates the database at a time.
+const lockKey = 7263541
+
+// Reasons for the service to refuse the schema.
+var (
+	ErrDirty             = errors.New("database schema is dirty")
+	ErrNewerSchema       = errors.New("database schema is newer than the service")
+	ErrPendingMigrations = errors.New("database schema has pending migrations")
+)
+
+// Migration is a schema change, applied with Up and reverted with Down.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of the schema: the version it is at, whether a migration failed
+// midway, and the migrations known by the service.
+type Status struct {
+	Version int
+	Dirty   bool
+	Latest  int
+	Pending int
+}
+
+// Migrator applies the migrations of a service, in order of version. Each migration runs
+// in a transaction and is recorded in the schema_migrations table. A migration is marked
+// dirty before it runs, so one that fails leaves the schema dirty until it is fixed by hand
+// and forced to a version.
+type Migrator struct {
+	db            *sql.DB
+	migrations    []Migration
+	baselineTable string
+}
+
+// New returns a Migrator of the migrations in files, which are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+// baselineTable is the first table of the initial migration. A database that has it but
+// no schema_migrations table was created by the former init script of the service and is
+// baselined at version 1, the schema of that script. The later migrations only create what
+// is missing, so they also apply to databases created by a newer copy of the script.
+func New(db *sql.DB, files fs.FS, baselineTable string) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, baselineTable: baselineTable}, nil
+}
+
+// Up applies the pending migrations and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, version)
+		}
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			slog.InfoContext(ctx, "Applying migration", "version", migration.Version, "name", migration.Name)
+			if err := run(ctx, conn, migration.Version, migration.Up,
+				`UPDATE schema_migrations SET dirty = FALSE, applied_at = NOW() WHERE version = $1`,
+				`INSERT INTO schema_migrations (version, dirty) VALUES ($1, TRUE)`); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps migrations and returns how many were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, version)
+		}
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > version {
+				continue
+			}
+			slog.InfoContext(ctx, "Reverting migration", "version", migration.Version, "name", migration.Name)
+			if err := run(ctx, conn, migration.Version, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`,
+				`UPDATE schema_migrations SET dirty = TRUE WHERE version = $1`); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force records the schema as clean at version, without running any migration, once a
+// failed migration has been fixed by hand. Version 0 clears the history.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, migration.Version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the state of the schema.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		status.Version, status.Dirty, err = currentVersion(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return status, err
+	}
+	for _, migration := range m.migrations {
+		status.Latest = migration.Version
+		if migration.Version > status.Version {
+			status.Pending++
+		}
+	}
+	return status, nil
+}
+
+// Check returns an error when the schema is not the one the service expects: dirty,
+// migrated by a newer version of the service, or with pending migrations.
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	switch {
+	case err != nil:
+		return err
+	case status.Dirty:
+		return fmt.Errorf("%w at version %d", ErrDirty, status.Version)
+	case status.Version > status.Latest:
+		return fmt.Errorf("%w: version %d, latest known %d", ErrNewerSchema, status.Version, status.Latest)
+	case status.Pending > 0:
+		return fmt.Errorf("%w: version %d, latest %d", ErrPendingMigrations, status.Version, status.Latest)
+	}
+	return nil
+}
+
+// locked runs fn on a connection holding the migrations lock, once the schema_migrations
+// table exists.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if err := ensureTable(ctx, conn, m.baselineTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// ensureTable creates the schema_migrations table, baselining databases created by the
+// former init script at version 1.
+func ensureTable(ctx context.Context, conn *sql.Conn, baselineTable string) error {
+	var exists, baseline bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL, to_regclass($1) IS NOT NULL`,
+		baselineTable).Scan(&exists, &baseline)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		dirty BOOLEAN NOT NULL DEFAULT FALSE,
+		applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil || !baseline {
+		return err
+	}
+	slog.InfoContext(ctx, "Baselining existing schema at version 1")
+	_, err = conn.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (1) ON CONFLICT DO NOTHING`)
+	return err
+}
+
+// currentVersion returns the highest recorded version and whether any is dirty.
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, bool, error) {
+	var version int
+	var dirty bool
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0), COALESCE(BOOL_OR(dirty), FALSE) FROM schema_migrations`).
+		Scan(&version, &dirty)
+	return version, dirty, err
+}
+
+// run marks version dirty with markQuery, then runs script and records the version as
+// done with doneQuery in a single transaction.
+func run(ctx context.Context, conn *sql.Conn, version int, script string, doneQuery string, markQuery string) error {
+	if _, err := conn.ExecContext(ctx, markQuery, version); err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, doneQuery, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// load reads the migrations in files and checks that every version has an up and a down
+// script.
+func load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := cutSuffix(name)
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected a .up.sql or .down.sql suffix", name)
+		}
+		prefix, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", name, prefix)
+		}
+		script, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: label}
+			byVersion[version] = migration
+		} else if migration.Name != label {
+			return nil, fmt.Errorf("migration %s: version %d is already used by %s", name, version, migration.Name)
+		}
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down scripts are required", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func cutSuffix(name string) (string, string, bool) {
+	if base, ok := strings.CutSuffix(name, ".up.sql"); ok {
+		return base, "up", true
+	}
+	if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadOrdersMigrationsByVersion(t *testing.T) {
+	files := fstest.MapFS{
+		"0002_referrals.up.sql":   {Data: []byte("CREATE TABLE referral ();")},
+		"0002_referrals.down.sql": {Data: []byte("DROP TABLE referral;")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE customer ();")},
+		"0001_init.down.sql":      {Data: []byte("DROP TABLE customer;")},
+	}
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("loaded %d migrations, want 2", len(migrations))
+	}
+	first, second := migrations[0], migrations[1]
+	if first.Version != 1 || first.Name != "init" || first.Up != "CREATE TABLE customer ();" || first.Down != "DROP TABLE customer;" {
+		t.Errorf("first migration = %+v", first)
+	}
+	if second.Version != 2 || second.Name != "referrals" {
+		t.Errorf("second migration = %+v", second)
+	}
+}
+
+func TestLoadRejectsInvalidMigrations(t *testing.T) {
+	tests := map[string]struct {
+		files fstest.MapFS
+		want  string
+	}{
+		"missing down": {
+			files: fstest.MapFS{"0001_init.up.sql": {}},
+			want:  "both up and down scripts are required",
+		},
+		"unknown suffix": {
+			files: fstest.MapFS{"0001_init.sql": {}},
+			want:  "expected a .up.sql or .down.sql suffix",
+		},
+		"invalid version": {
+			files: fstest.MapFS{"init.up.sql": {}},
+			want:  "invalid version",
+		},
+		"version used twice": {
+			files: fstest.MapFS{"0001_init.up.sql": {}, "0001_other.down.sql": {}},
+			want:  "is already used by",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(tt.files)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("load() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
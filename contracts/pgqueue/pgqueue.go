@@ -0,0 +1,135 @@
+// Package pgqueue is a message transport backed by the event_queue table of a PostgreSQL
+// database, shared by the services for deployments without Kafka: each service's postgres
+// broker sends to and consumes from a Queue, and services given the same database see
+// each other's events.
+package pgqueue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/degarzonm/leal_contracts/bus"
+	"github.com/lib/pq"
+)
+
+// Queue keeps the messages in the event_queue table until they are handled. Messages with
+// the same topic and key are handled one at a time in the order they were published, so
+// the events of a customer keep their order.
+type Queue struct {
+	db           *sql.DB
+	pollInterval time.Duration
+}
+
+// New returns a Queue on db, polled every pollInterval when it is empty.
+func New(db *sql.DB, pollInterval time.Duration) *Queue {
+	return &Queue{db: db, pollInterval: pollInterval}
+}
+
+// Publish inserts the message in the queue and returns its ID.
+func (q *Queue) Publish(ctx context.Context, m bus.Message) (int64, error) {
+	headers, err := json.Marshal(m.Headers)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	query := `INSERT INTO event_queue (topic, msg_key, headers, payload) VALUES ($1, $2, $3, $4) RETURNING id`
+	err = q.db.QueryRowContext(ctx, query, m.Topic, m.Key, headers, m.Value).Scan(&id)
+	return id, err
+}
+
+// Listen polls the queue for messages of the topics until ctx is cancelled, passing each
+// one to handle and deleting it once handled. It waits the poll interval whenever the
+// queue is empty. Database errors are logged and retried after the interval. A message
+// being handled when ctx is cancelled is finished and deleted first.
+func (q *Queue) Listen(ctx context.Context, topics []string, handle func(context.Context, bus.Message)) error {
+	for ctx.Err() == nil {
+		handled, err := q.handleNext(context.WithoutCancel(ctx), topics, handle)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error reading event queue", "error", err)
+		}
+		if handled {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(q.pollInterval):
+		}
+	}
+	return nil
+}
+
+// handleNext locks the oldest message of the topics that has no older message with the
+// same topic and key, handles it and deletes it. Listeners in other processes skip the
+// locked message. It returns false when there was no message to handle.
+func (q *Queue) handleNext(ctx context.Context, topics []string, handle func(context.Context, bus.Message)) (bool, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, topic, msg_key, headers, payload
+		FROM event_queue e
+		WHERE topic = ANY($1)
+			AND NOT EXISTS (
+				SELECT 1 FROM event_queue prev
+				WHERE prev.topic = e.topic AND prev.msg_key = e.msg_key AND prev.id < e.id)
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`
+	var (
+		id      int64
+		headers []byte
+		m       bus.Message
+	)
+	err = tx.QueryRowContext(ctx, query, pq.Array(topics)).Scan(&id, &m.Topic, &m.Key, &headers, &m.Value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(headers, &m.Headers); err != nil {
+		return false, err
+	}
+
+	handle(ctx, m)
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM event_queue WHERE id = $1`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Lag returns the number of messages queued on each of the topics.
+func (q *Queue) Lag(ctx context.Context, topics []string) (map[string]int, error) {
+	query := `SELECT topic, COUNT(*) FROM event_queue WHERE topic = ANY($1) GROUP BY topic`
+	rows, err := q.db.QueryContext(ctx, query, pq.Array(topics))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lag := map[string]int{}
+	for _, topic := range topics {
+		lag[topic] = 0
+	}
+	for rows.Next() {
+		var topic string
+		var count int
+		if err := rows.Scan(&topic, &count); err != nil {
+			return nil, err
+		}
+		lag[topic] = count
+	}
+	return lag, rows.Err()
+}
+
+// Ping checks the queue database can be reached.
+func (q *Queue) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
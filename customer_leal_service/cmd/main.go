@@ -2,9 +2,10 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	nethttp "net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,97 +13,206 @@ import (
 	"github.com/degarzonm/customer_leal_service/internal/application"
 	"github.com/degarzonm/customer_leal_service/internal/config"
 	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db/migrations"
 	"github.com/degarzonm/customer_leal_service/internal/infrastructure/http"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/logging"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/metrics"
 	"github.com/degarzonm/customer_leal_service/internal/infrastructure/msg_broker"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/tracing"
+	"github.com/degarzonm/leal_contracts/migrate"
 	_ "github.com/lib/pq"
 )
 
+// serviceName identifies the service in the traces.
+const serviceName = "customer_leal_service"
+
 func main() {
 	// Load initial configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+
+	// Structured logging, with passwords, tokens, emails and phones masked
+	if err := logging.Init(cfg.LogLevel); err != nil {
+		fatal("Failed to initialize logging", err)
+	}
+
+	// Tracing of requests, events and queries
+	shutdownTracing, err := tracing.Init(context.Background(), serviceName)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
 	}
 
 	// database connection and ping test
-	dbConn, err := sql.Open("postgres", fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.DBHost,
-		cfg.DBPort,
-		cfg.DBUser,
-		cfg.DBPassword,
-		cfg.DBName,
-	))
+	dbConn, err := tracing.OpenDB(cfg.DBDSN())
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	dbConn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	dbConn.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
 
 	if err := dbConn.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+		fatal("Failed to ping database", err)
+	}
+	slog.Info("Database connection established")
+	metrics.RegisterDB(dbConn, cfg.DBName)
+
+	// Database migrations: the migrate subcommand runs them and exits. Otherwise the
+	// pending ones are applied on start, if enabled, and the service refuses to start
+	// on a dirty, newer or outdated schema.
+	migrator, err := migrations.New(dbConn)
+	if err != nil {
+		fatal("Failed to load migrations", err)
 	}
-	log.Println("Database connection established")
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			fatal("Unknown command", fmt.Errorf("%q, expected migrate", os.Args[1]))
+		}
+		if err := migrate.Command(context.Background(), migrator, os.Args[2:]); err != nil {
+			fatal("Failed to run migrations", err)
+		}
+		return
+	}
+	if cfg.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			fatal("Failed to apply migrations", err)
+		}
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		fatal("Database schema is not usable", err)
+	}
+
 	// Create repositories
 	customerRepo := db.NewPostgresCustomerRepo(dbConn)
 	pointRepo := db.NewPostgresPointsRepo(dbConn)
 	coinRepo := db.NewPostgresCoinsRepo(dbConn)
 	purchaseRepo := db.NewPostgresPurchasesRepo(dbConn)
-	redeemedRepo := db.NewPostgresRedeemedRepo(dbConn)
+	referralRepo := db.NewPostgresReferralRepo(dbConn)
+	transferRepo := db.NewPostgresTransferRepo(dbConn)
+	brandSettingsRepo := db.NewPostgresBrandSettingsRepo(dbConn)
+	householdRepo := db.NewPostgresHouseholdRepo(dbConn)
+	idempotencyRepo := db.NewPostgresIdempotencyRepo(dbConn)
+	unitOfWork := db.NewPostgresUnitOfWork(dbConn)
+
+	// Business metrics of purchases and redemptions
+	businessMetrics := metrics.NewPrometheusBusinessMetrics()
 
 	// Create app services
-	customerService := application.NewCustomerService(customerRepo)
-	pointService := application.NewPointsService(pointRepo)
+	customerService := application.NewCustomerService(customerRepo, unitOfWork)
+	pointService := application.NewPointsService(pointRepo, unitOfWork)
 	coinService := application.NewCoinService(coinRepo)
+	referralService := application.NewReferralService(referralRepo)
+	transferService := application.NewTransferService(transferRepo, customerRepo, brandSettingsRepo)
+	householdService := application.NewHouseholdService(householdRepo, customerRepo, unitOfWork)
+	exchangeService := application.NewExchangeService(unitOfWork, brandSettingsRepo)
 
-	redeemService := application.NewRedeemService(redeemedRepo, pointRepo, customerRepo)
+	redeemService := application.NewRedeemService(unitOfWork, householdService, businessMetrics)
+	purchaseService := application.NewPurchaseService(purchaseRepo, unitOfWork, businessMetrics)
 
-	// Kafka KafkaProducer initialization
-	eventProducer, err := msgBroker.NewKafkaProducer()
+	// Message broker initialization (kafka, memory or postgres)
+	broker, err := msgBroker.NewBroker()
 	if err != nil {
-		log.Fatalf("Failed to initialize Kafka producer: %v", err)
+		fatal("Failed to initialize message broker", err, "broker", cfg.MsgBrokerType)
 	}
-	defer eventProducer.(*msgBroker.KafkaProducer).Producer.Close()
+	defer broker.Close()
 
-	appService := application.NewAppService(pointRepo, customerRepo, coinRepo, eventProducer)
-	purchaseService := application.NewPurchaseService(purchaseRepo, customerRepo, coinRepo, appService)
+	appService := application.NewAppService(brandSettingsRepo, unitOfWork)
 
-	// Initialize Kafka listener
-	kafkaListener, err := msgBroker.NewKafkaListener(appService)
+	// Relay of the events stored in the outbox to the broker
+	outboxRelay := msgBroker.NewOutboxRelay(unitOfWork, broker.Producer(), cfg.OutboxPollInterval)
+
+	// Initialize event listener
+	eventListener, err := broker.Listener(appService, []string{cfg.MsgApplyPointsTopic, cfg.MsgBrandSettings, cfg.MsgPurchaseRejected})
 	if err != nil {
-		log.Fatalf("Error initializing Kafka listener: %v", err)
+		fatal("Error initializing event listener", err)
 	}
 
-	// Context for graceful shutdown
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Context cancelled by SIGINT or SIGTERM, for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Execute Kafka listener
+	// Execute event listener
+	listenerDone := make(chan struct{})
 	go func() {
-		log.Println("Initializing Kafka listener...")
-		if err := kafkaListener.Listen(); err != nil {
-			log.Fatalf("Error executing Kafka listener: %v", err)
+		defer close(listenerDone)
+		slog.Info("Initializing event listener", "broker", cfg.MsgBrokerType)
+		if err := eventListener.Listen(ctx); err != nil {
+			fatal("Error executing event listener", err)
 		}
 	}()
 
-	// Configure signal handling
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-
+	// Execute outbox relay
+	relayDone := make(chan struct{})
 	go func() {
-		<-sig
-		log.Println("Signal received, shutting down...")
-		cancel()
+		defer close(relayDone)
+		slog.Info("Initializing outbox relay", "broker", cfg.MsgBrokerType)
+		outboxRelay.Run(ctx)
 	}()
 
 	// Create http handlers
-	httpHandler := http.NewHandler(customerService, pointService, coinService, purchaseService, redeemService)
+	httpHandler := http.NewHandler(customerService, pointService, coinService, purchaseService, redeemService, referralService, transferService, householdService, exchangeService)
+
+	// Create health checks of the database and the message broker
+	health := http.NewHealthHandler(cfg.HealthCheckTimeout,
+		http.HealthCheck{Name: "database", Check: func(ctx context.Context) (map[string]any, error) {
+			return nil, dbConn.PingContext(ctx)
+		}},
+		http.HealthCheck{Name: "producer", Check: broker.Health},
+		http.HealthCheck{Name: "consumer", Check: eventListener.Health},
+	)
+
+	// Create the validation of the requests against the OpenAPI document
+	validation, err := http.ValidationMiddleware()
+	if err != nil {
+		fatal("Error loading OpenAPI document", err)
+	}
+
+	// Create the authentication of customers and other services
+	auth := http.AuthMiddleware(customerService, cfg.ServiceTokens)
 
 	// Create hhtp router
-	router := http.NewRouter(httpHandler)
+	router := http.NewRouter(httpHandler, health, auth, http.IdempotencyMiddleware(idempotencyRepo, cfg.IdempotencyKeyTTL), metrics.HTTPMiddleware(), tracing.HTTPMiddleware(serviceName), logging.HTTPMiddleware(), validation)
 
 	// Init http server
-	log.Printf("Starting HTTP server on port %s", cfg.HTTPServerPort)
-	if err := router.Run(":" + cfg.HTTPServerPort); err != nil {
-		log.Fatalf("Failed to run HTTP server: %v", err)
+	server := &nethttp.Server{Addr: ":" + cfg.HTTPServerPort, Handler: router}
+	go func() {
+		slog.Info("Starting HTTP server", "port", cfg.HTTPServerPort)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, nethttp.ErrServerClosed) {
+			fatal("Failed to run HTTP server", err)
+		}
+	}()
+
+	// Graceful shutdown: stop accepting requests, drain the in-flight ones, let the
+	// listener finish the events it is handling and commit its offsets, and let the relay
+	// finish the batch it is sending.
+	<-ctx.Done()
+	slog.Info("Signal received, shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down HTTP server", "error", err)
+	}
+	select {
+	case <-listenerDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Timed out waiting for the event listener")
 	}
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Timed out waiting for the outbox relay")
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Error flushing spans", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// fatal logs err, along with the key-value pairs of args, and exits.
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"error", err}, args...)...)
+	os.Exit(1)
 }
@@ -0,0 +1,179 @@
+// Package harness runs the customer service in process, for end-to-end tests with the
+// brand service: its application services, PostgreSQL repositories, event listener and
+// outbox relay work as in production, on a database the test provides and on a memory
+// broker of a bus the brand service shares. Like the service, it reads its configuration
+// from the environment, so the topics must be set before the harness is created.
+package harness
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/application"
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db/migrations"
+	msgBroker "github.com/degarzonm/customer_leal_service/internal/infrastructure/msg_broker"
+	"github.com/degarzonm/leal_contracts/bus"
+)
+
+// Exchange directions and purchase statuses.
+const (
+	ExchangeCoinsToPoints = domain.ExchangeCoinsToPoints
+	ExchangePointsToCoins = domain.ExchangePointsToCoins
+
+	PurchasePending  = domain.PurchasePending
+	PurchaseCredited = domain.PurchaseCredited
+	PurchaseRejected = domain.PurchaseRejected
+)
+
+// Purchase is a purchase as the customer sees it.
+type Purchase struct {
+	ID              int
+	Status          string
+	RejectionReason string
+	PointsEarned    int
+	CoinsEarned     int
+}
+
+// Customer is the customer service running on a test database.
+type Customer struct {
+	customers     domain.CustomerRepository
+	coins         domain.CoinsRepository
+	points        domain.PointsRepository
+	brandSettings domain.BrandSettingsRepository
+	purchases     domain.PurchaseService
+	exchanges     domain.ExchangeService
+	listener      msgBroker.Listener
+	relay         *msgBroker.OutboxRelay
+}
+
+// NewCustomer creates the customer service on conn, which it migrates to the latest
+// version, sending and consuming its events on b. It returns an error if the
+// configuration cannot be loaded or the database cannot be migrated.
+func NewCustomer(conn *sql.DB, b *bus.Bus) (*Customer, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := migrations.New(conn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return nil, err
+	}
+
+	unitOfWork := db.NewPostgresUnitOfWork(conn)
+	brandSettingsRepo := db.NewPostgresBrandSettingsRepo(conn)
+	broker := msgBroker.NewMemoryBrokerOn(b)
+	appService := application.NewAppService(brandSettingsRepo, unitOfWork)
+	return &Customer{
+		customers:     db.NewPostgresCustomerRepo(conn),
+		coins:         db.NewPostgresCoinsRepo(conn),
+		points:        db.NewPostgresPointsRepo(conn),
+		brandSettings: brandSettingsRepo,
+		purchases:     application.NewPurchaseService(db.NewPostgresPurchasesRepo(conn), unitOfWork, noMetrics{}),
+		exchanges:     application.NewExchangeService(unitOfWork, brandSettingsRepo),
+		listener:      msgBroker.NewMemoryListener(broker, appService, []string{cfg.MsgApplyPointsTopic, cfg.MsgBrandSettings, cfg.MsgPurchaseRejected}),
+		relay:         msgBroker.NewOutboxRelay(unitOfWork, broker, cfg.OutboxPollInterval),
+	}, nil
+}
+
+// Run consumes the events of the service and relays its outbox until ctx is cancelled.
+func (c *Customer) Run(ctx context.Context) error {
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		c.relay.Run(ctx)
+	}()
+	err := c.listener.Listen(ctx)
+	<-relayDone
+	return err
+}
+
+// AddCustomer creates a customer with the given coins and returns their ID.
+func (c *Customer) AddCustomer(ctx context.Context, coins int) (int, error) {
+	unique := fmt.Sprint(time.Now().UnixNano())
+	customer, err := c.customers.CreateCustomer(ctx, "Customer", unique+"@example.com", unique, "", "", "E2E"+unique)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.coins.UpdateCustomerCoins(ctx, customer.ID, coins, "opening balance"); err != nil {
+		return 0, err
+	}
+	return customer.ID, nil
+}
+
+// Purchase records a purchase of the customer at a branch of a brand, paid in part with
+// coins, and returns its ID. The purchase stays pending until the brand service rewards or
+// rejects it.
+func (c *Customer) Purchase(ctx context.Context, customerID, brandID, branchID int, amount float64, coinsUsed int) (int, error) {
+	purchase, err := c.purchases.ProcessPurchase(ctx, &domain.Purchase{
+		CustomerID: customerID, BrandID: brandID, BranchID: branchID, Amount: amount, CoinsUsed: coinsUsed,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purchase.ID, nil
+}
+
+// GetPurchase returns a purchase of the customer.
+func (c *Customer) GetPurchase(ctx context.Context, customerID, purchaseID int) (Purchase, error) {
+	purchase, err := c.purchases.GetPurchase(ctx, customerID, purchaseID)
+	if err != nil {
+		return Purchase{}, err
+	}
+	return Purchase{
+		ID:              purchase.ID,
+		Status:          purchase.Status,
+		RejectionReason: purchase.RejectionReason,
+		PointsEarned:    purchase.PointsEarned,
+		CoinsEarned:     purchase.CoinsEarned,
+	}, nil
+}
+
+// Exchange exchanges coins of the customer for points of a brand, or points for coins, at
+// the rates the brand published, and returns the ID of the exchange.
+func (c *Customer) Exchange(ctx context.Context, customerID, brandID int, direction string, amount int) (int, error) {
+	exchange, err := c.exchanges.Exchange(ctx, customerID, brandID, direction, amount)
+	if err != nil {
+		return 0, err
+	}
+	return exchange.ID, nil
+}
+
+// ExchangeRates returns the rates of the brand the service received, both 0 until the
+// brand publishes its settings.
+func (c *Customer) ExchangeRates(ctx context.Context, brandID int) (coinsToPoints float64, pointsToCoins float64, err error) {
+	settings, err := c.brandSettings.GetBrandSettings(ctx, brandID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return settings.CoinsToPointsRate, settings.PointsToCoinsRate, nil
+}
+
+// Balance returns the coins of the customer and their points of the brand.
+func (c *Customer) Balance(ctx context.Context, customerID, brandID int) (coins int, points int, err error) {
+	if coins, err = c.coins.GetCoinsByCustomerID(ctx, customerID); err != nil {
+		return 0, 0, err
+	}
+	balances, err := c.points.GetPointsByCustomerID(ctx, customerID)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, balance := range balances {
+		if balance.BrandID == brandID {
+			points = balance.Points
+		}
+	}
+	return coins, points, nil
+}
+
+type noMetrics struct{}
+
+func (noMetrics) PurchaseRecorded(int, int)     {}
+func (noMetrics) RewardRedeemed(int, int, bool) {}
@@ -1,6 +1,7 @@
 package application
 
 import (
+	"context"
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
@@ -13,14 +14,20 @@ func NewCoinService(p domain.CoinsRepository) domain.CoinService {
 }
 
 // GetCustomerCoins retrieves the amount of coins a customer has
-func (s *coinService) GetCustomerCoins(customerID int) (int, error) {
-	return s.coinsRepo.GetCoinsByCustomerID(customerID)
+func (s *coinService) GetCustomerCoins(ctx context.Context, customerID int) (int, error) {
+	return s.coinsRepo.GetCoinsByCustomerID(ctx, customerID)
 }
 
-// UpdateCustomerCoins updates the amount of coins a customer has.
+// UpdateCustomerCoins updates the amount of coins a customer has, recording the change
+// with its reason in the coins ledger.
 //
 // If the amount of coins given is negative, it will subtract from the customer's current amount.
 // If the amount of coins given is positive, it will add to the customer's current amount.
-func (s *coinService) UpdateCustomerCoins(customerID int, coins int) error {
-	return s.coinsRepo.UpdateCustomerCoins(customerID, coins)
+func (s *coinService) UpdateCustomerCoins(ctx context.Context, customerID int, coins int, reason string) error {
+	return s.coinsRepo.UpdateCustomerCoins(ctx, customerID, coins, reason)
+}
+
+// GetCoinsHistory retrieves the coins ledger of a customer, newest first.
+func (s *coinService) GetCoinsHistory(ctx context.Context, customerID int) ([]domain.LealCoinsTransaction, error) {
+	return s.coinsRepo.GetCoinsTransactionsByCustomerID(ctx, customerID)
 }
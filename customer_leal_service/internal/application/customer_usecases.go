@@ -1,6 +1,7 @@
 package application
 
 import (
+	"context"
 	"errors"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
@@ -9,28 +10,71 @@ import (
 
 type customerService struct {
 	customerRepo domain.CustomerRepository
+	uow          domain.UnitOfWork
 }
 
-func NewCustomerService(p domain.CustomerRepository) domain.CustomerService {
-	return &customerService{customerRepo: p}
+func NewCustomerService(p domain.CustomerRepository, uow domain.UnitOfWork) domain.CustomerService {
+	return &customerService{customerRepo: p, uow: uow}
 }
 
 // CreateCustomer creates a new customer and returns the customer if successful.
 // The customer name, email, phone and password are required.
 // An error is returned if any of the required fields are not provided.
 // The customer's password is hashed before being stored.
-func (c *customerService) CreateCustomer(name string, email string, phone string, pass string) (*domain.Customer, error) {
+//
+// Every customer gets a personal referral code. If referralCode is not empty, it must
+// belong to an existing customer whose email and phone do not match the new customer's
+// (after normalization), and a pending referral is recorded for the pair in the same
+// transaction as the customer.
+func (c *customerService) CreateCustomer(ctx context.Context, name string, email string, phone string, pass string, referralCode string) (*domain.Customer, error) {
 
 	if name == "" || pass == "" || email == "" || phone == "" {
-		return nil, errors.New("name, email, phone and password are required")
+		return nil, domain.ErrMissingCustomerFields
 	}
+
+	var referrer *domain.Customer
+	if referralCode != "" {
+		var err error
+		referrer, err = c.customerRepo.GetCustomerByReferralCode(ctx, referralCode)
+		if err != nil {
+			return nil, err
+		}
+		if referrer == nil {
+			return nil, domain.ErrInvalidReferralCode
+		}
+		if util.NormalizeEmail(referrer.Email) == util.NormalizeEmail(email) ||
+			util.NormalizePhone(referrer.Phone) == util.NormalizePhone(phone) {
+			return nil, domain.ErrSelfReferral
+		}
+	}
+
 	passHash := util.HashPassword(pass)
 	token, err := util.GenerateToken()
 
 	if err != nil {
 		return nil, errors.New("error generating token")
 	}
-	return c.customerRepo.CreateCustomer(name, email, phone, passHash, token)
+	ownCode, err := util.GenerateReferralCode()
+	if err != nil {
+		return nil, errors.New("error generating referral code")
+	}
+
+	var customer *domain.Customer
+	err = c.uow.Do(ctx, func(repos domain.Repositories) error {
+		var err error
+		customer, err = repos.Customers.CreateCustomer(ctx, name, email, phone, passHash, token, ownCode)
+		if err != nil {
+			return err
+		}
+		if referrer != nil {
+			_, err = repos.Referrals.CreateReferral(ctx, referrer.ID, customer.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
 }
 
 // LoginCustomer authenticates a customer using their email and password.
@@ -38,17 +82,13 @@ func (c *customerService) CreateCustomer(name string, email string, phone string
 // An error is returned if the customer is not found, the password is invalid,
 // or if there is an error generating or updating the token.
 
-func (c *customerService) LoginCustomer(email string, pass string) (*domain.Customer, error) {
-	b, err := c.customerRepo.GetCustomerByEmail(email)
+func (c *customerService) LoginCustomer(ctx context.Context, email string, pass string) (*domain.Customer, error) {
+	b, err := c.customerRepo.GetCustomerByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
-	if b == nil {
-		return nil, errors.New("brand not found")
-	}
-
-	if !util.CheckPassHash(pass, b.PassHash) {
-		return nil, errors.New("invalid password")
+	if b == nil || !util.CheckPassHash(pass, b.PassHash) {
+		return nil, domain.ErrInvalidCredentials
 	}
 	// update token
 	newToken, err := util.GenerateToken()
@@ -56,7 +96,7 @@ func (c *customerService) LoginCustomer(email string, pass string) (*domain.Cust
 		return nil, errors.New("failed generating token")
 	}
 
-	err = c.customerRepo.UpdateCustomerToken(b.ID, newToken)
+	err = c.customerRepo.UpdateCustomerToken(ctx, b.ID, newToken)
 	if err != nil {
 		return nil, err
 	}
@@ -66,22 +106,52 @@ func (c *customerService) LoginCustomer(email string, pass string) (*domain.Cust
 
 // GetCustomerByID retrieves a customer by ID.
 // It returns the customer if found, or an error if the customer is not found.
-func (c *customerService) GetCustomerByID(id int) (*domain.Customer, error) {
-	return c.customerRepo.GetCustomerByID(id)
+func (c *customerService) GetCustomerByID(ctx context.Context, id int) (*domain.Customer, error) {
+	customer, err := c.customerRepo.GetCustomerByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, domain.ErrCustomerNotFound
+	}
+	return customer, nil
 }
 
 // ValidateToken checks if the provided token matches the stored token for the customer with the given customerID.
 // It returns an error if the customer is not found or if the token is invalid.
-func (c *customerService) ValidateToken(customerID int, token string) error {
-	b, err := c.customerRepo.GetCustomerByID(customerID)
+func (c *customerService) ValidateToken(ctx context.Context, customerID int, token string) error {
+	b, err := c.customerRepo.GetCustomerByID(ctx, customerID)
 	if err != nil {
 		return err
 	}
-	if b == nil {
-		return errors.New("customer not found")
-	}
-	if b.Token != token {
-		return errors.New("invalid token")
+	if b == nil || b.Token != token {
+		return domain.ErrInvalidToken
 	}
 	return nil
 }
+
+// findCustomerByContact looks up another customer by email, or by phone when no email
+// is given. It returns an error if neither is given or no customer matches.
+func findCustomerByContact(ctx context.Context, repo domain.CustomerRepository, email string, phone string) (*domain.Customer, error) {
+	if email != "" {
+		customer, err := repo.GetCustomerByEmail(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+		if customer == nil {
+			return nil, domain.ErrCustomerNotFound
+		}
+		return customer, nil
+	}
+	if phone != "" {
+		customer, err := repo.GetCustomerByPhone(ctx, phone)
+		if err != nil {
+			return nil, err
+		}
+		if customer == nil {
+			return nil, domain.ErrCustomerNotFound
+		}
+		return customer, nil
+	}
+	return nil, domain.ErrMissingContact
+}
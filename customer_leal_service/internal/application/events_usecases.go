@@ -1,61 +1,147 @@
 package application
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"strconv"
 
 	"github.com/degarzonm/customer_leal_service/internal/config"
 	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/util"
 )
 
 type AppService struct {
-	pointRepo     domain.PointsRepository
-	customerRepo  domain.CustomerRepository
-	coinRepo      domain.CoinsRepository
-	eventProducer domain.EventProducer
+	brandSettingsRepo domain.BrandSettingsRepository
+	uow               domain.UnitOfWork
 }
 
 // NewAppService creates a new application service
-func NewAppService(pointRepo domain.PointsRepository, customerRepo domain.CustomerRepository, coinRepo domain.CoinsRepository, producer domain.EventProducer) *AppService {
+func NewAppService(brandSettingsRepo domain.BrandSettingsRepository, uow domain.UnitOfWork) *AppService {
 	return &AppService{
-		pointRepo:     pointRepo,
-		customerRepo:  customerRepo,
-		coinRepo:      coinRepo,
-		eventProducer: producer,
+		brandSettingsRepo: brandSettingsRepo,
+		uow:               uow,
 	}
 }
 
 // ProcessApplyPointsEvent processes a new points application event, by recording the transaction,
-// updating the customer points and updating the customer coins.
-func (s *AppService) ProcessApplyPointsEvent(pointsEvent domain.LealPointsApply) error {
-	log.Println("Service: ProcessApplyPointsEvent, with points: ", pointsEvent)
-	//Record transaction
-	err := s.pointRepo.RecordPointsTransaction(&domain.LealPointsTransaction{CustomerID: pointsEvent.CustomerID,
-		BrandID: pointsEvent.BrandID, Change: pointsEvent.Points, Reason: pointsEvent.Reason})
-	if err != nil {
-		return err
-	}
+// updating the customer points and updating the customer coins. If the customer belongs to a
+// household, their contribution share of the points is then moved into the household pool.
+// Points of a purchase first credit the purchase with them, and are skipped if the purchase
+// is no longer pending, so that the same event never applies them twice. Crediting the
+// purchase also rewards the referral of the customer, if it is their first qualifying
+// purchase, so purchases the brand service rejects never earn referral bonuses.
+// All the writes happen in a single transaction, so a failed event leaves no partial update
+// behind and can be safely processed again.
+func (s *AppService) ProcessApplyPointsEvent(ctx context.Context, pointsEvent domain.LealPointsApply) error {
+	slog.InfoContext(ctx, "Applying points", "purchase_id", pointsEvent.PurchaseID, "customer_id", pointsEvent.CustomerID, "brand_id", pointsEvent.BrandID, "points", pointsEvent.Points, "coins", pointsEvent.Coins, "reason", pointsEvent.Reason)
+	return s.uow.Do(ctx, func(repos domain.Repositories) error {
+		//Credit purchase
+		if pointsEvent.PurchaseID != 0 {
+			purchase, err := repos.Purchases.CreditPurchase(ctx, pointsEvent.PurchaseID, pointsEvent.Points, pointsEvent.Coins, pointsEvent.Breakdown)
+			if err != nil {
+				return err
+			}
+			if purchase == nil {
+				slog.WarnContext(ctx, "No pending purchase to credit", "purchase_id", pointsEvent.PurchaseID)
+				return nil
+			}
+			if err := rewardQualifyingPurchase(ctx, repos, purchase); err != nil {
+				return err
+			}
+		}
 
-	//Update points
-	err = s.pointRepo.UpdatePoints(pointsEvent.CustomerID, pointsEvent.BrandID, pointsEvent.Points)
-	if err != nil {
-		return err
-	}
+		//Record transaction
+		err := repos.Points.RecordPointsTransaction(ctx, &domain.LealPointsTransaction{CustomerID: pointsEvent.CustomerID,
+			BrandID: pointsEvent.BrandID, Change: pointsEvent.Points, Reason: pointsEvent.Reason})
+		if err != nil {
+			return err
+		}
+
+		//Update points
+		err = repos.Points.UpdatePoints(ctx, pointsEvent.CustomerID, pointsEvent.BrandID, pointsEvent.Points)
+		if err != nil {
+			return err
+		}
+
+		//Contribute to household pool
+		_, err = contributeEarnedPoints(ctx, repos, pointsEvent.CustomerID, pointsEvent.BrandID, pointsEvent.Points)
+		if err != nil {
+			return err
+		}
+
+		//update coins
+		if pointsEvent.Coins == 0 {
+			return nil
+		}
+		return repos.Coins.UpdateCustomerCoins(ctx, pointsEvent.CustomerID, pointsEvent.Coins, pointsEvent.Reason)
+	})
+}
 
-	//update coins
-	err = s.coinRepo.UpdateCustomerCoins(pointsEvent.CustomerID, pointsEvent.Coins)
+// ProcessPurchaseRejectedEvent rejects a purchase the brand service could not reward and
+// gives the customer back the coins used on it, in a single transaction. Only pending
+// purchases are rejected, so processing the same event again refunds nothing.
+func (s *AppService) ProcessPurchaseRejectedEvent(ctx context.Context, rejection domain.PurchaseRejection) error {
+	slog.InfoContext(ctx, "Rejecting purchase", "purchase_id", rejection.PurchaseID, "customer_id", rejection.CustomerID, "brand_id", rejection.BrandID, "branch_id", rejection.BranchID, "reason", rejection.Reason)
+	return s.uow.Do(ctx, func(repos domain.Repositories) error {
+		purchase, err := repos.Purchases.RejectPurchase(ctx, rejection.PurchaseID, rejection.Reason)
+		if err != nil {
+			return err
+		}
+		if purchase == nil {
+			slog.WarnContext(ctx, "No pending purchase to reject", "purchase_id", rejection.PurchaseID)
+			return nil
+		}
+		if purchase.CoinsUsed <= 0 {
+			return nil
+		}
+		return repos.Coins.UpdateCustomerCoins(ctx, purchase.CustomerID, purchase.CoinsUsed, "purchase refund")
+	})
+}
+
+// ProcessBrandSettingsEvent stores the settings published by the brand service,
+// replacing any previous settings of the brand.
+func (s *AppService) ProcessBrandSettingsEvent(ctx context.Context, settings domain.BrandSettings) error {
+	slog.InfoContext(ctx, "Storing brand settings", "brand_id", settings.BrandID)
+	return s.brandSettingsRepo.SaveBrandSettings(ctx, &settings)
+}
+
+// queuePurchaseEvent stores the purchase event in the outbox of the transaction that
+// records the purchase, to be sent to the purchase topic once it commits. The event is
+// keyed by the customer and has a new correlation ID that the brand service carries over
+// to the apply points event.
+func queuePurchaseEvent(ctx context.Context, repos domain.Repositories, purchase domain.Purchase) error {
+	cfg := config.GetConfig()
+	correlationID, err := util.GenerateToken()
 	if err != nil {
 		return err
 	}
-	return nil
+	return repos.Outbox.AddEvent(ctx, cfg.MsgPurchaseTopic, domain.Event{
+		Type:          domain.EventPurchaseCreated,
+		CorrelationID: correlationID,
+		Keys: map[string]string{
+			domain.KeyCustomerID: strconv.Itoa(purchase.CustomerID),
+			domain.KeyBrandID:    strconv.Itoa(purchase.BrandID),
+		},
+		Payload: purchase,
+	})
 }
 
-// SendPurchaseEvent sends a purchase message to a configured Kafka topic.
-// The method retrieves the topic name from the global configuration and sends
-// the raw purchase object without marshaling it. It returns an error if the
-// message could not be sent.
-
-func (s *AppService) SendPurchaseEvent(purchase domain.Purchase) error {
-
+// queueExchangeEvent stores the exchange event in the outbox of the transaction that
+// records the exchange, to be sent to the exchange topic once it commits, so the brand
+// service settles the coins exchanged with the brand.
+func queueExchangeEvent(ctx context.Context, repos domain.Repositories, exchange domain.Exchange) error {
 	cfg := config.GetConfig()
-	return s.eventProducer.SendMessage(cfg.MsgPurchaseTopic, purchase)
+	correlationID, err := util.GenerateToken()
+	if err != nil {
+		return err
+	}
+	return repos.Outbox.AddEvent(ctx, cfg.MsgExchange, domain.Event{
+		Type:          domain.EventExchangeCompleted,
+		CorrelationID: correlationID,
+		Keys: map[string]string{
+			domain.KeyCustomerID: strconv.Itoa(exchange.CustomerID),
+			domain.KeyBrandID:    strconv.Itoa(exchange.BrandID),
+		},
+		Payload: exchange,
+	})
 }
@@ -0,0 +1,126 @@
+package application
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+// TestMain loads the configuration the application services read, with the topics the
+// events are queued to.
+func TestMain(m *testing.M) {
+	for key, value := range map[string]string{
+		"DB_HOST": "localhost", "DB_PORT": "5432", "DB_USER": "test", "DB_NAME": "test",
+		"HTTP_SERVER_PORT": "0", "MSG_BROKER_TYPE": "memory",
+		"MSG_PURCHASE": "purchase-topic", "MSG_APPLY_POINTS": "apply-points-topic",
+		"MSG_BRAND_SETTINGS": "brand-settings-topic",
+	} {
+		os.Setenv(key, value)
+	}
+	if _, err := config.LoadConfig(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newPurchase records a purchase of a new customer with 50 coins, paid in part with 20 of
+// them, and returns the store and the purchase.
+func newPurchase(t *testing.T) (*store, *domain.Purchase) {
+	t.Helper()
+	s := newStore()
+	s.st.lastCustomerID++
+	customerID := s.st.lastCustomerID
+	s.st.coins[customerID] = 0
+	if err := (coinsRepo{st: s.st}).UpdateCustomerCoins(context.Background(), customerID, 50, "opening balance"); err != nil {
+		t.Fatal(err)
+	}
+
+	purchases := NewPurchaseService(committedPurchases{s: s}, s, noMetrics{})
+	purchase, err := purchases.ProcessPurchase(context.Background(), &domain.Purchase{
+		CustomerID: customerID, BrandID: 1, BranchID: 1, Amount: 200, CoinsUsed: 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, purchase
+}
+
+// checkCoinsLedger fails the test if the coins ledger of the customer does not add up to
+// their balance.
+func checkCoinsLedger(t *testing.T, s *store, customerID int) {
+	t.Helper()
+	var sum int
+	for _, transaction := range s.st.coinsTransactions {
+		if transaction.CustomerID == customerID {
+			sum += transaction.Change
+		}
+	}
+	if balance := s.st.coins[customerID]; sum != balance {
+		t.Errorf("coins ledger adds up to %d, want the balance of %d", sum, balance)
+	}
+}
+
+func TestPurchaseDebitsCoinsAndQueuesItsEvent(t *testing.T) {
+	s, purchase := newPurchase(t)
+
+	if coins := s.st.coins[purchase.CustomerID]; coins != 30 {
+		t.Errorf("%d coins left, want 30", coins)
+	}
+	checkCoinsLedger(t, s, purchase.CustomerID)
+	if len(s.st.outbox) != 1 || s.st.outbox[0].Topic != "purchase-topic" || s.st.outbox[0].Event.Type != domain.EventPurchaseCreated {
+		t.Fatalf("outbox = %+v, want the purchase event", s.st.outbox)
+	}
+	if got := s.st.purchases[purchase.ID].Status; got != domain.PurchasePending {
+		t.Errorf("purchase is %s, want pending", got)
+	}
+}
+
+func TestApplyPointsCreditsPurchaseOnce(t *testing.T) {
+	s, purchase := newPurchase(t)
+	app := NewAppService(committedSettings{s}, s)
+	event := domain.LealPointsApply{
+		PurchaseID: purchase.ID, CustomerID: purchase.CustomerID, BrandID: purchase.BrandID,
+		Points: 200, Coins: 20, Reason: "purchase",
+	}
+
+	for range 2 {
+		if err := app.ProcessApplyPointsEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.st.purchases[purchase.ID]; got.Status != domain.PurchaseCredited || got.PointsEarned != 200 || got.CoinsEarned != 20 {
+		t.Errorf("purchase %+v, want credited with 200 points and 20 coins", got)
+	}
+	if points := s.st.points[balanceKey{purchase.CustomerID, purchase.BrandID}]; points != 200 {
+		t.Errorf("%d points, want 200 applied once", points)
+	}
+	if coins := s.st.coins[purchase.CustomerID]; coins != 50 {
+		t.Errorf("%d coins, want 50 after earning 20 once", coins)
+	}
+	checkCoinsLedger(t, s, purchase.CustomerID)
+}
+
+func TestPurchaseRejectedRefundsCoinsOnce(t *testing.T) {
+	s, purchase := newPurchase(t)
+	app := NewAppService(committedSettings{s}, s)
+	rejection := domain.PurchaseRejection{
+		PurchaseID: purchase.ID, CustomerID: purchase.CustomerID, BrandID: purchase.BrandID,
+		BranchID: purchase.BranchID, Reason: "branch_closed",
+	}
+
+	for range 2 {
+		if err := app.ProcessPurchaseRejectedEvent(context.Background(), rejection); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.st.purchases[purchase.ID]; got.Status != domain.PurchaseRejected || got.RejectionReason != "branch_closed" {
+		t.Errorf("purchase %+v, want rejected because the branch is closed", got)
+	}
+	if coins := s.st.coins[purchase.CustomerID]; coins != 50 {
+		t.Errorf("%d coins, want the 20 coins used refunded once", coins)
+	}
+	checkCoinsLedger(t, s, purchase.CustomerID)
+}
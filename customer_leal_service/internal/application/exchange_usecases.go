@@ -0,0 +1,74 @@
+package application
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type exchangeService struct {
+	uow               domain.UnitOfWork
+	brandSettingsRepo domain.BrandSettingsRepository
+}
+
+func NewExchangeService(uow domain.UnitOfWork, bs domain.BrandSettingsRepository) domain.ExchangeService {
+	return &exchangeService{uow: uow, brandSettingsRepo: bs}
+}
+
+// Exchange converts the given amount of coins into points of a brand (coins_to_points), or
+// the given amount of points of a brand into coins (points_to_coins), at the rate set by the
+// brand. The converted amount is rounded down and must be at least one unit.
+//
+// The exchange is rejected if the brand has not enabled that direction, or if it would take
+// the coins exchanged with the brand today beyond the brand's daily limit. The limit is
+// checked and the balance moved atomically, recorded in both ledgers, by the repository, and
+// the exchange event is stored in the outbox in the same transaction, for the brand service
+// to settle the coins with the brand.
+func (s *exchangeService) Exchange(ctx context.Context, customerID int, brandID int, direction string, amount int) (*domain.Exchange, error) {
+	if brandID == 0 {
+		return nil, domain.ErrBrandRequired
+	}
+	if amount <= 0 {
+		return nil, domain.ErrInvalidAmount
+	}
+
+	settings, err := s.brandSettingsRepo.GetBrandSettings(ctx, brandID)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange := &domain.Exchange{CustomerID: customerID, BrandID: brandID, Direction: direction}
+	switch direction {
+	case domain.ExchangeCoinsToPoints:
+		exchange.Rate = settings.CoinsToPointsRate
+		exchange.Coins = amount
+		exchange.Points = int(math.Floor(float64(amount) * exchange.Rate))
+	case domain.ExchangePointsToCoins:
+		exchange.Rate = settings.PointsToCoinsRate
+		exchange.Points = amount
+		exchange.Coins = int(math.Floor(float64(amount) * exchange.Rate))
+	default:
+		return nil, domain.ErrInvalidDirection
+	}
+	if exchange.Rate <= 0 {
+		return nil, domain.ErrExchangeDisabled
+	}
+	if exchange.Coins <= 0 || exchange.Points <= 0 {
+		return nil, domain.ErrAmountTooSmall
+	}
+
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	err = s.uow.Do(ctx, func(repos domain.Repositories) error {
+		if _, err := repos.Exchanges.Exchange(ctx, exchange, startOfDay, settings.ExchangeDailyLimit); err != nil {
+			return err
+		}
+		return queueExchangeEvent(ctx, repos, *exchange)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
@@ -0,0 +1,41 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+func TestExchangeMovesBalanceAndQueuesItsEvent(t *testing.T) {
+	s := newStore()
+	s.st.lastCustomerID++
+	customerID := s.st.lastCustomerID
+	s.st.coins[customerID] = 100
+	s.st.settings[1] = domain.BrandSettings{BrandID: 1, CoinsToPointsRate: 10, ExchangeDailyLimit: 50}
+	exchanges := NewExchangeService(s, committedSettings{s})
+	ctx := context.Background()
+
+	exchange, err := exchanges.Exchange(ctx, customerID, 1, domain.ExchangeCoinsToPoints, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exchange.Coins != 30 || exchange.Points != 300 {
+		t.Errorf("exchange %+v, want 30 coins for 300 points", exchange)
+	}
+	if coins, points := s.st.coins[customerID], s.st.points[balanceKey{customerID, 1}]; coins != 70 || points != 300 {
+		t.Errorf("balance of %d coins and %d points, want 70 coins and 300 points", coins, points)
+	}
+	if len(s.st.outbox) != 1 || s.st.outbox[0].Topic != "exchange-topic" || s.st.outbox[0].Event.Type != domain.EventExchangeCompleted {
+		t.Fatalf("outbox = %+v, want the exchange event", s.st.outbox)
+	}
+
+	// 30 more coins would take the coins exchanged today beyond the limit of 50.
+	if _, err := exchanges.Exchange(ctx, customerID, 1, domain.ExchangeCoinsToPoints, 30); !errors.Is(err, domain.ErrExchangeLimit) {
+		t.Errorf("second exchange error = %v, want ErrExchangeLimit", err)
+	}
+	if len(s.st.outbox) != 1 {
+		t.Errorf("%d events in the outbox, want only the first exchange", len(s.st.outbox))
+	}
+}
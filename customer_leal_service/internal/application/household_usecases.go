@@ -0,0 +1,298 @@
+package application
+
+import (
+	"context"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type householdService struct {
+	householdRepo domain.HouseholdRepository
+	customerRepo  domain.CustomerRepository
+	uow           domain.UnitOfWork
+}
+
+func NewHouseholdService(h domain.HouseholdRepository, c domain.CustomerRepository, uow domain.UnitOfWork) domain.HouseholdService {
+	return &householdService{householdRepo: h, customerRepo: c, uow: uow}
+}
+
+// CreateHousehold creates a household owned by the given customer, who becomes its first member.
+// The contribution percent is the default share of earned points new members put into the pool.
+// It returns an error if the name is empty, the percent is out of range, or the customer
+// already belongs to a household.
+func (s *householdService) CreateHousehold(ctx context.Context, ownerID int, name string, contributionPercent int) (*domain.Household, error) {
+	if name == "" {
+		return nil, domain.ErrHouseholdNameRequired
+	}
+	if contributionPercent < 0 || contributionPercent > 100 {
+		return nil, domain.ErrInvalidContribution
+	}
+	member, err := s.householdRepo.GetMember(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if member != nil {
+		return nil, domain.ErrAlreadyInHousehold
+	}
+	return s.householdRepo.CreateHousehold(ctx, name, ownerID, contributionPercent)
+}
+
+// GetHousehold retrieves the household of the given customer, including its members and
+// pooled points. It returns an error if the customer does not belong to a household.
+func (s *householdService) GetHousehold(ctx context.Context, customerID int) (*domain.Household, error) {
+	member, err := s.householdRepo.GetMember(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, domain.ErrNotInHousehold
+	}
+	return s.loadHousehold(ctx, member.HouseholdID)
+}
+
+// InviteMember invites the customer identified by email or phone to the owner's household.
+// Only the household owner can invite, and customers that already belong to a household
+// cannot be invited.
+func (s *householdService) InviteMember(ctx context.Context, ownerID int, email string, phone string) (*domain.HouseholdInvitation, error) {
+	household, err := s.ownedHousehold(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	invitee, err := findCustomerByContact(ctx, s.customerRepo, email, phone)
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.householdRepo.GetMember(ctx, invitee.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member != nil {
+		return nil, domain.ErrAlreadyInHousehold
+	}
+	return s.householdRepo.CreateInvitation(ctx, household.ID, invitee.ID)
+}
+
+// GetInvitations retrieves the pending household invitations of a customer.
+func (s *householdService) GetInvitations(ctx context.Context, customerID int) ([]domain.HouseholdInvitation, error) {
+	return s.householdRepo.GetPendingInvitationsByCustomerID(ctx, customerID)
+}
+
+// AcceptInvitation adds the customer to the household of a pending invitation addressed to
+// them, using the household's default contribution percent, and marks the invitation as
+// accepted in the same transaction. It returns the joined household.
+func (s *householdService) AcceptInvitation(ctx context.Context, customerID int, invitationID int) (*domain.Household, error) {
+	inv, err := s.householdRepo.GetInvitationByID(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil || inv.CustomerID != customerID {
+		return nil, domain.ErrInvitationNotFound
+	}
+	if inv.Status != "pending" {
+		return nil, domain.ErrInvitationNotPending
+	}
+	member, err := s.householdRepo.GetMember(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if member != nil {
+		return nil, domain.ErrAlreadyInHousehold
+	}
+
+	household, err := s.householdRepo.GetHouseholdByID(ctx, inv.HouseholdID)
+	if err != nil {
+		return nil, err
+	}
+	if household == nil {
+		return nil, domain.ErrHouseholdNotFound
+	}
+	err = s.uow.Do(ctx, func(repos domain.Repositories) error {
+		if err := repos.Households.AddMember(ctx, household.ID, customerID, household.ContributionPercent); err != nil {
+			return err
+		}
+		return repos.Households.UpdateInvitationStatus(ctx, inv.ID, "accepted")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.loadHousehold(ctx, household.ID)
+}
+
+// RemoveMember removes a customer from the requester's household. The owner can remove any
+// other member, and any member can remove themselves. The owner cannot leave the household.
+// The pooled points stay with the household.
+func (s *householdService) RemoveMember(ctx context.Context, requesterID int, customerID int) error {
+	requester, err := s.householdRepo.GetMember(ctx, requesterID)
+	if err != nil {
+		return err
+	}
+	if requester == nil {
+		return domain.ErrNotInHousehold
+	}
+	household, err := s.householdRepo.GetHouseholdByID(ctx, requester.HouseholdID)
+	if err != nil {
+		return err
+	}
+	if household == nil {
+		return domain.ErrNotInHousehold
+	}
+	if customerID == household.OwnerID {
+		return domain.ErrHouseholdOwnerRemoval
+	}
+	if requesterID != household.OwnerID && requesterID != customerID {
+		return domain.ErrNotHouseholdOwner
+	}
+
+	member, err := s.householdRepo.GetMember(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	if member == nil || member.HouseholdID != household.ID {
+		return domain.ErrHouseholdMemberNotFound
+	}
+	return s.householdRepo.RemoveMember(ctx, household.ID, customerID)
+}
+
+// SetContribution changes the share of earned points a member of the owner's household
+// puts into the pool. Only the household owner can change contributions.
+func (s *householdService) SetContribution(ctx context.Context, ownerID int, customerID int, contributionPercent int) error {
+	if contributionPercent < 0 || contributionPercent > 100 {
+		return domain.ErrInvalidContribution
+	}
+	household, err := s.ownedHousehold(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	member, err := s.householdRepo.GetMember(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	if member == nil || member.HouseholdID != household.ID {
+		return domain.ErrHouseholdMemberNotFound
+	}
+	return s.householdRepo.UpdateMemberContribution(ctx, household.ID, customerID, contributionPercent)
+}
+
+// SelectPool decides whether a redemption is paid with the household pool of the redeeming
+// member and, if so, marks it with the household ID so RedeemReward debits the pool, and
+// records the debit in the household ledger, instead of the member's own balance. It
+// returns false, without error, when the customer has no household or the pool does not
+// hold enough points of the brand, so the individual balance is used instead. The pool is
+// read before the redemption's transaction, so the debit still fails with
+// domain.ErrInsufficientHouseholdPoints if the pool is drawn down in between.
+func (s *householdService) SelectPool(ctx context.Context, redeem *domain.Redeemed) (bool, error) {
+	member, err := s.householdRepo.GetMember(ctx, redeem.CustomerID)
+	if err != nil {
+		return false, err
+	}
+	if member == nil {
+		return false, nil
+	}
+
+	pool, err := s.householdRepo.GetPoints(ctx, member.HouseholdID)
+	if err != nil {
+		return false, err
+	}
+	available := 0
+	for _, p := range pool {
+		if p.BrandID == redeem.BrandID {
+			available = p.Points
+		}
+	}
+	if available < redeem.PointsSpend {
+		return false, nil
+	}
+	redeem.HouseholdID = member.HouseholdID
+	return true, nil
+}
+
+// ownedHousehold returns the household owned by the given customer, or an error if the
+// customer does not own one.
+func (s *householdService) ownedHousehold(ctx context.Context, ownerID int) (*domain.Household, error) {
+	member, err := s.householdRepo.GetMember(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, domain.ErrNotInHousehold
+	}
+	household, err := s.householdRepo.GetHouseholdByID(ctx, member.HouseholdID)
+	if err != nil {
+		return nil, err
+	}
+	if household == nil || household.OwnerID != ownerID {
+		return nil, domain.ErrNotHouseholdOwner
+	}
+	return household, nil
+}
+
+// loadHousehold retrieves a household with its members and pooled points.
+func (s *householdService) loadHousehold(ctx context.Context, householdID int) (*domain.Household, error) {
+	household, err := s.householdRepo.GetHouseholdByID(ctx, householdID)
+	if err != nil {
+		return nil, err
+	}
+	if household == nil {
+		return nil, domain.ErrHouseholdNotFound
+	}
+	if household.Members, err = s.householdRepo.GetMembers(ctx, householdID); err != nil {
+		return nil, err
+	}
+	if household.Points, err = s.householdRepo.GetPoints(ctx, householdID); err != nil {
+		return nil, err
+	}
+	return household, nil
+}
+
+// contributeEarnedPoints moves the member's share of freshly earned points of a brand from
+// their individual balance into the household pool, and returns the pooled amount. It runs
+// on the repositories of the caller's unit of work, so the contribution is only kept if the
+// earning is.
+//
+// The earning itself stays in the member's ledger; the contribution is recorded as a debit
+// in the member's ledger and a credit in the household ledger. Customers without a household
+// contribute nothing.
+func contributeEarnedPoints(ctx context.Context, repos domain.Repositories, customerID int, brandID int, points int) (int, error) {
+	if points <= 0 {
+		return 0, nil
+	}
+	member, err := repos.Households.GetMember(ctx, customerID)
+	if err != nil {
+		return 0, err
+	}
+	if member == nil {
+		return 0, nil
+	}
+	pooled := points * member.ContributionPercent / 100
+	if pooled == 0 {
+		return 0, nil
+	}
+
+	err = repos.Points.RecordPointsTransaction(ctx, &domain.LealPointsTransaction{
+		CustomerID: customerID,
+		BrandID:    brandID,
+		Change:     -pooled,
+		Reason:     "household contribution",
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := repos.Points.UpdatePoints(ctx, customerID, brandID, -pooled); err != nil {
+		return 0, err
+	}
+
+	err = repos.Households.RecordPointsTransaction(ctx, &domain.HouseholdPointsTransaction{
+		HouseholdID: member.HouseholdID,
+		CustomerID:  customerID,
+		BrandID:     brandID,
+		Change:      pooled,
+		Reason:      "member contribution",
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := repos.Households.UpdatePoints(ctx, member.HouseholdID, brandID, pooled); err != nil {
+		return 0, err
+	}
+	return pooled, nil
+}
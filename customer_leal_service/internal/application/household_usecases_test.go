@@ -0,0 +1,32 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+// orphanMember is a household repository whose only member belongs to a household that no
+// longer exists, as when the household is deleted between the two reads of RemoveMember.
+type orphanMember struct {
+	domain.HouseholdRepository
+}
+
+func (orphanMember) GetMember(_ context.Context, customerID int) (*domain.HouseholdMember, error) {
+	return &domain.HouseholdMember{HouseholdID: 1, CustomerID: customerID}, nil
+}
+
+func (orphanMember) GetHouseholdByID(context.Context, int) (*domain.Household, error) {
+	return nil, nil
+}
+
+func TestRemoveMemberOfMissingHousehold(t *testing.T) {
+	households := NewHouseholdService(orphanMember{}, nil, nil)
+
+	err := households.RemoveMember(context.Background(), 1, 2)
+	if !errors.Is(err, domain.ErrNotInHousehold) {
+		t.Errorf("RemoveMember() error = %v, want %v", err, domain.ErrNotInHousehold)
+	}
+}
@@ -1,52 +1,57 @@
 package application
 
 import (
+	"context"
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
 type pointService struct {
 	pointRepo domain.PointsRepository
+	uow       domain.UnitOfWork
 }
 
-func NewPointsService(p domain.PointsRepository) domain.PointService {
-	return &pointService{pointRepo: p}
+func NewPointsService(p domain.PointsRepository, uow domain.UnitOfWork) domain.PointService {
+	return &pointService{pointRepo: p, uow: uow}
 }
 
 // GetCustomerPoints fetches all points for a given customer ID
 // from the PointsRepository, returning an array of LealPoints
 // and an error if any.
-func (s *pointService) GetCustomerPoints(customerID int) ([]domain.LealPoints, error) {
-	return s.pointRepo.GetPointsByCustomerID(customerID)
+func (s *pointService) GetCustomerPoints(ctx context.Context, customerID int) ([]domain.LealPoints, error) {
+	return s.pointRepo.GetPointsByCustomerID(ctx, customerID)
 }
 
 // UpdatePoints updates a customer's points balance for a given brand, updating the
-// customer's points and recording the transaction. This method returns an error if
-// any of the operations fail.
-func (s *pointService) UpdatePoints(customerID int, brandID int, pointsDelta int, reason string) error {
-	//update points transactions
-
-	var transaction = &domain.LealPointsTransaction{
-		CustomerID: customerID,
-		BrandID:    brandID,
-		Change:     pointsDelta,
-		Reason:     reason,
-	}
-
-	err := s.pointRepo.RecordPointsTransaction(transaction)
-	if err != nil {
-		return err
-	}
-	err = s.pointRepo.UpdatePoints(customerID, brandID, pointsDelta)
-	if err != nil {
-		return err
-	}
-
-	//update coins
-
-	err = s.pointRepo.RecordCoins(customerID, pointsDelta)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// customer's points and coins and recording both changes in their ledgers in a single
+// transaction. This method
+// returns an error if any of the operations fail, in which case nothing is changed.
+func (s *pointService) UpdatePoints(ctx context.Context, customerID int, brandID int, pointsDelta int, reason string) error {
+	return s.uow.Do(ctx, func(repos domain.Repositories) error {
+		//update points transactions
+
+		var transaction = &domain.LealPointsTransaction{
+			CustomerID: customerID,
+			BrandID:    brandID,
+			Change:     pointsDelta,
+			Reason:     reason,
+		}
+
+		err := repos.Points.RecordPointsTransaction(ctx, transaction)
+		if err != nil {
+			return err
+		}
+		err = repos.Points.UpdatePoints(ctx, customerID, brandID, pointsDelta)
+		if err != nil {
+			return err
+		}
+
+		//update coins
+
+		return repos.Coins.UpdateCustomerCoins(ctx, customerID, pointsDelta, reason)
+	})
+}
+
+// GetPointsHistory fetches the points ledger of a customer, newest first.
+func (s *pointService) GetPointsHistory(ctx context.Context, customerID int) ([]domain.LealPointsTransaction, error) {
+	return s.pointRepo.GetPointsTransactionsByCustomerID(ctx, customerID)
 }
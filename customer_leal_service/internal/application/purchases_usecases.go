@@ -1,53 +1,66 @@
 package application
 
 import (
-	"errors"
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
 type purchaseService struct {
 	purchaseRepo domain.PurchasesRepository
-	customerRepo domain.CustomerRepository
-	coinRepo     domain.CoinsRepository
-	appService   *AppService // Referencia a AppService
+	uow          domain.UnitOfWork
+	metrics      domain.BusinessMetrics
 }
 
-func NewPurchaseService(p domain.PurchasesRepository, c domain.CustomerRepository, cr domain.CoinsRepository, app *AppService) domain.PurchaseService {
-	return &purchaseService{purchaseRepo: p, customerRepo: c, coinRepo: cr, appService: app}
+func NewPurchaseService(pr domain.PurchasesRepository, uow domain.UnitOfWork, m domain.BusinessMetrics) domain.PurchaseService {
+	return &purchaseService{purchaseRepo: pr, uow: uow, metrics: m}
 }
 
-// ProcessPurchase process a purchase, verifing if the customer has enough coins to do the purchase,
-// if yes, it updates the coins, records the purchase and send a purchase event to kafka
-func (s *purchaseService) ProcessPurchase(attempPurchase *domain.Purchase) (*domain.Purchase, error) {
-	// Verify if coins are enough
-	log.Println("Processing purchase: ", attempPurchase)
-	customer, err := s.customerRepo.GetCustomerByID(attempPurchase.CustomerID)
-	if err != nil {
-		return nil, err
-	}
-	if customer.LealCoins < attempPurchase.CoinsUsed {
-		return nil, errors.New("not enough coins")
+// ProcessPurchase process a purchase, debiting the coins used, recording the purchase and
+// storing its purchase event in the outbox in a single transaction that fails if the
+// customer does not have enough coins. The outbox relay sends the event once the
+// transaction commits, so a recorded purchase is never left without its event.
+func (s *purchaseService) ProcessPurchase(ctx context.Context, attempPurchase *domain.Purchase) (*domain.Purchase, error) {
+	slog.InfoContext(ctx, "Processing purchase", "customer_id", attempPurchase.CustomerID, "brand_id", attempPurchase.BrandID, "branch_id", attempPurchase.BranchID, "amount", attempPurchase.Amount, "coins_used", attempPurchase.CoinsUsed)
+	if attempPurchase.CoinsUsed < 0 {
+		return nil, domain.ErrInvalidCoinsUsed
 	}
 
-	// Update coins
-	log.Println("Update coins: ", attempPurchase.CoinsUsed, " for customer: ", attempPurchase.CustomerID)
-	err = s.coinRepo.UpdateCustomerCoins(attempPurchase.CustomerID, -attempPurchase.CoinsUsed)
+	// Debit coins, record purchase and queue its event
+	err := s.uow.Do(ctx, func(repos domain.Repositories) error {
+		if attempPurchase.CoinsUsed > 0 {
+			if err := repos.Coins.UpdateCustomerCoins(ctx, attempPurchase.CustomerID, -attempPurchase.CoinsUsed, "purchase payment"); err != nil {
+				return err
+			}
+		}
+		if _, err := repos.Purchases.RecordPurchase(ctx, attempPurchase); err != nil {
+			return err
+		}
+		return queuePurchaseEvent(ctx, repos, *attempPurchase)
+	})
 	if err != nil {
 		return nil, err
 	}
+	s.metrics.PurchaseRecorded(attempPurchase.BrandID, attempPurchase.CoinsUsed)
 
-	// Record purchase
-	attempPurchase, err = s.purchaseRepo.RecordPurchase(attempPurchase)
+	return attempPurchase, nil
+}
+
+// GetPurchase returns a purchase of a customer, with its status and, once credited, the
+// points and coins it earned. Purchases of other customers are not found.
+func (s *purchaseService) GetPurchase(ctx context.Context, customerID int, purchaseID int) (*domain.Purchase, error) {
+	purchase, err := s.purchaseRepo.GetPurchaseByID(ctx, purchaseID)
 	if err != nil {
 		return nil, err
 	}
-
-	// Call SendPurchaseEvent through AppService
-	if err := s.appService.SendPurchaseEvent(*attempPurchase); err != nil {
-		return nil, errors.New("failed to send apply points event")
+	if purchase == nil || purchase.CustomerID != customerID {
+		return nil, domain.ErrPurchaseNotFound
 	}
+	return purchase, nil
+}
 
-	return attempPurchase, nil
+// GetPurchases returns the purchases of a customer, newest first.
+func (s *purchaseService) GetPurchases(ctx context.Context, customerID int) ([]domain.Purchase, error) {
+	return s.purchaseRepo.GetPurchasesByCustomerID(ctx, customerID)
 }
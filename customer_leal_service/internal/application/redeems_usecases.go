@@ -1,66 +1,83 @@
 package application
 
 import (
-	"errors"
+	"context"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
 type redeemService struct {
-	redeemRepo   domain.RedeemedRepository
-	pointRepo    domain.PointsRepository
-	customerRepo domain.CustomerRepository
+	uow              domain.UnitOfWork
+	householdService domain.HouseholdService
+	metrics          domain.BusinessMetrics
 }
 
-func NewRedeemService(p domain.RedeemedRepository, pr domain.PointsRepository, cr domain.CustomerRepository) domain.RedeemService {
-	return &redeemService{redeemRepo: p, pointRepo: pr, customerRepo: cr}
+func NewRedeemService(uow domain.UnitOfWork, hs domain.HouseholdService, m domain.BusinessMetrics) domain.RedeemService {
+	return &redeemService{uow: uow, householdService: hs, metrics: m}
 }
 
 // RedeemReward executes a redeem operation for a given customer and brand
 //
-// It will first verify if the customer has enough points to redeem the reward,
-// then it will update the customer points, create a transaction for the points
-// modification, and finally record the redeem in the database.
+// If the customer belongs to a household whose pool holds enough points of the brand,
+// the points are drawn from the pool; otherwise from the customer's own balance. The
+// points are debited, the ledger transaction is created and the redeem is recorded in a
+// single transaction, and the debit fails if the balance does not cover it.
 //
 // If any of the steps fail, it will return an error.
-func (s *redeemService) RedeemReward(redeem *domain.Redeemed) (*domain.Redeemed, error) {
-	//get customer points given the customer id and brand id
-	points, err := s.pointRepo.GetPoinysByCustomerIDAndBrandID(redeem.CustomerID, redeem.BrandID)
-	if err != nil {
-		return nil, err
-	}
-
-	if points.Points < redeem.PointsSpend {
-		return nil, errors.New("not enough points")
+func (s *redeemService) RedeemReward(ctx context.Context, redeem *domain.Redeemed) (*domain.Redeemed, error) {
+	if redeem.PointsSpend <= 0 {
+		return nil, domain.ErrInvalidPointsSpend
 	}
 
-	//update customer points
-	err = s.pointRepo.UpdatePoints(redeem.CustomerID, redeem.BrandID, -redeem.PointsSpend)
+	//draw from the household pool when possible
+	pooled, err := s.householdService.SelectPool(ctx, redeem)
 	if err != nil {
 		return nil, err
 	}
 
-	//update points transactions
+	err = s.uow.Do(ctx, func(repos domain.Repositories) error {
+		if pooled {
+			err := repos.Households.UpdatePoints(ctx, redeem.HouseholdID, redeem.BrandID, -redeem.PointsSpend)
+			if err != nil {
+				return err
+			}
+			err = repos.Households.RecordPointsTransaction(ctx, &domain.HouseholdPointsTransaction{
+				HouseholdID: redeem.HouseholdID,
+				CustomerID:  redeem.CustomerID,
+				BrandID:     redeem.BrandID,
+				Change:      -redeem.PointsSpend,
+				Reason:      "Redeem reward",
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			//update customer points
+			err := repos.Points.UpdatePoints(ctx, redeem.CustomerID, redeem.BrandID, -redeem.PointsSpend)
+			if err != nil {
+				return err
+			}
 
-	var transaction = &domain.LealPointsTransaction{
-		CustomerID: redeem.CustomerID,
-		BrandID:    redeem.BrandID,
-		Change:     -redeem.PointsSpend,
-		Reason:     "Redeem reward",
-	}
+			//update points transactions
+			err = repos.Points.RecordPointsTransaction(ctx, &domain.LealPointsTransaction{
+				CustomerID: redeem.CustomerID,
+				BrandID:    redeem.BrandID,
+				Change:     -redeem.PointsSpend,
+				Reason:     "Redeem reward",
+			})
+			if err != nil {
+				return err
+			}
+		}
 
-	err = s.pointRepo.RecordPointsTransaction(transaction)
-	if err != nil {
-		return nil, err
-	}
-
-	// record redeem
-
-	redeem, err = s.redeemRepo.RedeemReward(redeem)
+		// record redeem
+		_, err := repos.Redeemed.RedeemReward(ctx, redeem)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	s.metrics.RewardRedeemed(redeem.BrandID, redeem.PointsSpend, pooled)
 
 	return redeem, nil
-
 }
@@ -0,0 +1,78 @@
+package application
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type referralService struct {
+	referralRepo domain.ReferralRepository
+}
+
+func NewReferralService(r domain.ReferralRepository) domain.ReferralService {
+	return &referralService{referralRepo: r}
+}
+
+// GetReferrals retrieves the referrals made with the customer's referral code.
+func (s *referralService) GetReferrals(ctx context.Context, customerID int) ([]domain.Referral, error) {
+	return s.referralRepo.GetReferralsByReferrerID(ctx, customerID)
+}
+
+// rewardQualifyingPurchase credits the referral bonus to both the referrer and the referee
+// when a purchase of the referee of at least the configured minimum amount is credited,
+// in the transaction of repos.
+//
+// The referral is moved from "pending" to "rewarded" before crediting, so the bonus is
+// granted only once even if several purchases are credited at the same time. Depending
+// on the configured reward type, the bonus is credited in global Leal coins or in points
+// of the configured brand (or of the purchase brand when none is configured).
+func rewardQualifyingPurchase(ctx context.Context, repos domain.Repositories, purchase *domain.Purchase) error {
+	cfg := config.GetConfig()
+	if purchase.Amount < cfg.ReferralMinPurchase {
+		return nil
+	}
+
+	referral, err := repos.Referrals.MarkReferralRewarded(ctx, purchase.CustomerID, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if referral == nil {
+		return nil
+	}
+	slog.InfoContext(ctx, "Referral rewarded", "referral_id", referral.ID, "referrer_id", referral.ReferrerID, "referee_id", referral.RefereeID)
+
+	if err := creditReferralBonus(ctx, repos, referral.ReferrerID, purchase.BrandID, cfg.ReferrerReward, "referral bonus (referrer)"); err != nil {
+		return err
+	}
+	return creditReferralBonus(ctx, repos, referral.RefereeID, purchase.BrandID, cfg.RefereeReward, "referral bonus (referee)")
+}
+
+// creditReferralBonus grants a referral bonus to a customer, in coins or in points of a brand
+// depending on the configured reward type.
+func creditReferralBonus(ctx context.Context, repos domain.Repositories, customerID int, purchaseBrandID int, amount int, reason string) error {
+	cfg := config.GetConfig()
+	if amount <= 0 {
+		return nil
+	}
+	if cfg.ReferralRewardType != "points" {
+		return repos.Coins.UpdateCustomerCoins(ctx, customerID, amount, reason)
+	}
+
+	brandID := cfg.ReferralBrandID
+	if brandID == 0 {
+		brandID = purchaseBrandID
+	}
+	err := repos.Points.RecordPointsTransaction(ctx, &domain.LealPointsTransaction{
+		CustomerID: customerID,
+		BrandID:    brandID,
+		Change:     amount,
+		Reason:     reason,
+	})
+	if err != nil {
+		return err
+	}
+	return repos.Points.UpdatePoints(ctx, customerID, brandID, amount)
+}
@@ -0,0 +1,308 @@
+package application
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/tracing"
+)
+
+// state is the data of the service that the database keeps in production: the balances,
+// ledgers, purchases, exchanges, brand settings and the event outbox.
+type state struct {
+	coins              map[int]int // by customer
+	coinsTransactions  []domain.LealCoinsTransaction
+	points             map[balanceKey]int
+	pointsTransactions []domain.LealPointsTransaction
+	purchases          map[int]domain.Purchase
+	exchanges          []domain.Exchange
+	settings           map[int]domain.BrandSettings
+	outbox             []domain.OutboxEvent
+
+	lastCustomerID, lastPurchaseID, lastExchangeID int
+	lastOutboxID                                   int64
+}
+
+type balanceKey struct {
+	customerID int
+	brandID    int
+}
+
+func (st *state) clone() *state {
+	c := *st
+	c.coins = maps.Clone(st.coins)
+	c.coinsTransactions = slices.Clone(st.coinsTransactions)
+	c.points = maps.Clone(st.points)
+	c.pointsTransactions = slices.Clone(st.pointsTransactions)
+	c.purchases = maps.Clone(st.purchases)
+	c.exchanges = slices.Clone(st.exchanges)
+	c.settings = maps.Clone(st.settings)
+	c.outbox = slices.Clone(st.outbox)
+	return &c
+}
+
+// store is the in-memory database of the tests. It is also its unit of work: Do runs
+// one unit at a time on a copy of the state, which replaces the state once fn succeeds.
+type store struct {
+	mu sync.Mutex
+	st *state
+}
+
+func newStore() *store {
+	return &store{st: &state{
+		coins:     map[int]int{},
+		points:    map[balanceKey]int{},
+		purchases: map[int]domain.Purchase{},
+		settings:  map[int]domain.BrandSettings{},
+	}}
+}
+
+func (s *store) Do(ctx context.Context, fn func(repos domain.Repositories) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tx := s.st.clone()
+	if err := fn(tx.repositories()); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.st = tx
+	return nil
+}
+
+// repositories returns the repositories of the state. Those the tests never use are
+// left nil, and the methods of the others that they never call panic.
+func (st *state) repositories() domain.Repositories {
+	return domain.Repositories{
+		Points:        pointsRepo{st: st},
+		Coins:         coinsRepo{st: st},
+		Purchases:     purchasesRepo{st: st},
+		Referrals:     referralsRepo{},
+		BrandSettings: settingsRepo{st: st},
+		Households:    householdsRepo{},
+		Exchanges:     exchangesRepo{st: st},
+		Outbox:        outboxRepo{st: st},
+	}
+}
+
+// committedSettings and committedPurchases are the repositories used outside units of
+// work, on the committed state.
+type committedSettings struct{ s *store }
+
+func (r committedSettings) GetBrandSettings(ctx context.Context, brandID int) (*domain.BrandSettings, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return settingsRepo{st: r.s.st}.GetBrandSettings(ctx, brandID)
+}
+
+func (r committedSettings) SaveBrandSettings(ctx context.Context, settings *domain.BrandSettings) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return settingsRepo{st: r.s.st}.SaveBrandSettings(ctx, settings)
+}
+
+type committedPurchases struct {
+	domain.PurchasesRepository
+	s *store
+}
+
+func (r committedPurchases) GetPurchaseByID(ctx context.Context, purchaseID int) (*domain.Purchase, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return purchasesRepo{st: r.s.st}.GetPurchaseByID(ctx, purchaseID)
+}
+
+type pointsRepo struct {
+	domain.PointsRepository
+	st *state
+}
+
+func (r pointsRepo) UpdatePoints(_ context.Context, customerID int, brandID int, delta int) error {
+	key := balanceKey{customerID, brandID}
+	if r.st.points[key]+delta < 0 {
+		return domain.ErrInsufficientPoints
+	}
+	r.st.points[key] += delta
+	return nil
+}
+
+func (r pointsRepo) RecordPointsTransaction(_ context.Context, transaction *domain.LealPointsTransaction) error {
+	transaction.Date = time.Now()
+	r.st.pointsTransactions = append(r.st.pointsTransactions, *transaction)
+	return nil
+}
+
+type coinsRepo struct {
+	domain.CoinsRepository
+	st *state
+}
+
+func (r coinsRepo) UpdateCustomerCoins(_ context.Context, customerID int, delta int, reason string) error {
+	balance, ok := r.st.coins[customerID]
+	if !ok {
+		return domain.ErrCustomerNotFound
+	}
+	if balance+delta < 0 {
+		return domain.ErrInsufficientCoins
+	}
+	r.st.coins[customerID] = balance + delta
+	r.st.coinsTransactions = append(r.st.coinsTransactions, domain.LealCoinsTransaction{
+		CustomerID: customerID, Change: delta, Reason: reason, Date: time.Now(),
+	})
+	return nil
+}
+
+type purchasesRepo struct {
+	domain.PurchasesRepository
+	st *state
+}
+
+func (r purchasesRepo) RecordPurchase(_ context.Context, purchase *domain.Purchase) (*domain.Purchase, error) {
+	r.st.lastPurchaseID++
+	purchase.ID = r.st.lastPurchaseID
+	purchase.PurchaseDate = time.Now()
+	purchase.Status = domain.PurchasePending
+	r.st.purchases[purchase.ID] = *purchase
+	return purchase, nil
+}
+
+func (r purchasesRepo) RejectPurchase(_ context.Context, purchaseID int, reason string) (*domain.Purchase, error) {
+	purchase, ok := r.st.purchases[purchaseID]
+	if !ok || purchase.Status != domain.PurchasePending {
+		return nil, nil
+	}
+	purchase.Status = domain.PurchaseRejected
+	purchase.RejectionReason = reason
+	r.st.purchases[purchaseID] = purchase
+	return &purchase, nil
+}
+
+func (r purchasesRepo) CreditPurchase(_ context.Context, purchaseID int, points int, coins int, breakdown []domain.RewardBreakdown) (*domain.Purchase, error) {
+	purchase, ok := r.st.purchases[purchaseID]
+	if !ok || purchase.Status != domain.PurchasePending {
+		return nil, nil
+	}
+	now := time.Now()
+	purchase.Status = domain.PurchaseCredited
+	purchase.PointsEarned = points
+	purchase.CoinsEarned = coins
+	purchase.Breakdown = breakdown
+	purchase.CreditedDate = &now
+	r.st.purchases[purchaseID] = purchase
+	return &purchase, nil
+}
+
+func (r purchasesRepo) GetPurchaseByID(_ context.Context, purchaseID int) (*domain.Purchase, error) {
+	purchase, ok := r.st.purchases[purchaseID]
+	if !ok {
+		return nil, nil
+	}
+	return &purchase, nil
+}
+
+// referralsRepo and householdsRepo find no referrals and no households.
+type referralsRepo struct{ domain.ReferralRepository }
+
+func (referralsRepo) MarkReferralRewarded(context.Context, int, int) (*domain.Referral, error) {
+	return nil, nil
+}
+
+type householdsRepo struct{ domain.HouseholdRepository }
+
+func (householdsRepo) GetMember(context.Context, int) (*domain.HouseholdMember, error) {
+	return nil, nil
+}
+
+type settingsRepo struct{ st *state }
+
+// GetBrandSettings returns the default settings for brands whose settings were not
+// received, like the database repository.
+func (r settingsRepo) GetBrandSettings(_ context.Context, brandID int) (*domain.BrandSettings, error) {
+	settings, ok := r.st.settings[brandID]
+	if !ok {
+		return &domain.BrandSettings{BrandID: brandID, AllowPointsTransfer: true}, nil
+	}
+	return &settings, nil
+}
+
+func (r settingsRepo) SaveBrandSettings(_ context.Context, settings *domain.BrandSettings) error {
+	r.st.settings[settings.BrandID] = *settings
+	return nil
+}
+
+type exchangesRepo struct {
+	domain.ExchangeRepository
+	st *state
+}
+
+// Exchange checks the daily limit and the balance, and moves it, like the database
+// repository.
+func (r exchangesRepo) Exchange(_ context.Context, exchange *domain.Exchange, since time.Time, dailyLimit int) (*domain.Exchange, error) {
+	if dailyLimit > 0 {
+		coinsToday := 0
+		for _, e := range r.st.exchanges {
+			if e.CustomerID == exchange.CustomerID && e.BrandID == exchange.BrandID && !e.Date.Before(since) {
+				coinsToday += e.Coins
+			}
+		}
+		if coinsToday+exchange.Coins > dailyLimit {
+			return nil, domain.ErrExchangeLimit
+		}
+	}
+
+	key := balanceKey{exchange.CustomerID, exchange.BrandID}
+	coinsDelta, pointsDelta := -exchange.Coins, exchange.Points
+	if exchange.Direction == domain.ExchangePointsToCoins {
+		coinsDelta, pointsDelta = exchange.Coins, -exchange.Points
+	}
+	if r.st.coins[exchange.CustomerID]+coinsDelta < 0 {
+		return nil, domain.ErrInsufficientCoins
+	}
+	if r.st.points[key]+pointsDelta < 0 {
+		return nil, domain.ErrInsufficientPoints
+	}
+	r.st.coins[exchange.CustomerID] += coinsDelta
+	r.st.points[key] += pointsDelta
+
+	r.st.lastExchangeID++
+	exchange.ID = r.st.lastExchangeID
+	exchange.Date = time.Now()
+	r.st.exchanges = append(r.st.exchanges, *exchange)
+	return exchange, nil
+}
+
+type outboxRepo struct{ st *state }
+
+func (r outboxRepo) AddEvent(ctx context.Context, topic string, event domain.Event) error {
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+	r.st.lastOutboxID++
+	r.st.outbox = append(r.st.outbox, domain.OutboxEvent{ID: r.st.lastOutboxID, Topic: topic, Event: event, TraceHeaders: headers})
+	return nil
+}
+
+func (r outboxRepo) GetPendingEvents(_ context.Context, limit int) ([]domain.OutboxEvent, error) {
+	return slices.Clone(r.st.outbox[:min(limit, len(r.st.outbox))]), nil
+}
+
+func (r outboxRepo) RecordFailure(context.Context, int64, string) error {
+	return nil
+}
+
+func (r outboxRepo) DeleteEvent(_ context.Context, id int64) error {
+	r.st.outbox = slices.DeleteFunc(r.st.outbox, func(e domain.OutboxEvent) bool { return e.ID == id })
+	return nil
+}
+
+type noMetrics struct{}
+
+func (noMetrics) PurchaseRecorded(int, int)     {}
+func (noMetrics) RewardRedeemed(int, int, bool) {}
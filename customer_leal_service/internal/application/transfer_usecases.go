@@ -0,0 +1,65 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type transferService struct {
+	transferRepo      domain.TransferRepository
+	customerRepo      domain.CustomerRepository
+	brandSettingsRepo domain.BrandSettingsRepository
+}
+
+func NewTransferService(t domain.TransferRepository, c domain.CustomerRepository, bs domain.BrandSettingsRepository) domain.TransferService {
+	return &transferService{transferRepo: t, customerRepo: c, brandSettingsRepo: bs}
+}
+
+// TransferBalance gives points of a brand, or coins, from the sender to another customer
+// identified by email or phone.
+//
+// Exactly one of points or coins must be positive, and points require a brand. Transfers to
+// oneself, to unknown customers, of points of brands that opted out of transfers, or beyond
+// the configured daily limits are rejected. The limits are checked and the balance moved
+// atomically, with paired ledger entries, by the repository.
+func (s *transferService) TransferBalance(ctx context.Context, transfer *domain.Transfer, recipientEmail string, recipientPhone string) (*domain.Transfer, error) {
+	if transfer.Points < 0 || transfer.Coins < 0 {
+		return nil, domain.ErrNegativeTransfer
+	}
+	if (transfer.Points > 0) == (transfer.Coins > 0) {
+		return nil, domain.ErrEmptyTransfer
+	}
+	if transfer.Points > 0 && transfer.BrandID == 0 {
+		return nil, domain.ErrBrandRequired
+	}
+	if transfer.Coins > 0 {
+		transfer.BrandID = 0
+	}
+
+	recipient, err := findCustomerByContact(ctx, s.customerRepo, recipientEmail, recipientPhone)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.ID == transfer.SenderID {
+		return nil, domain.ErrSelfTransfer
+	}
+	transfer.RecipientID = recipient.ID
+
+	if transfer.Points > 0 {
+		settings, err := s.brandSettingsRepo.GetBrandSettings(ctx, transfer.BrandID)
+		if err != nil {
+			return nil, err
+		}
+		if !settings.AllowPointsTransfer {
+			return nil, domain.ErrPointsTransferDisabled
+		}
+	}
+
+	cfg := config.GetConfig()
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return s.transferRepo.TransferBalance(ctx, transfer, startOfDay, cfg.TransferDailyPointsLimit, cfg.TransferDailyCoinsLimit)
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
-	"os"
-	"strconv"
+	"fmt"
 	"sync"
+	"time"
+
+	"github.com/degarzonm/leal_contracts/envconfig"
 )
 
 type Config struct {
@@ -12,11 +14,67 @@ type Config struct {
 	DBUser              string
 	DBPassword          string
 	DBName              string
+	MsgBrokerType       string // kafka, memory or postgres
 	KafkaBrokers        []string
 	MsgPurchaseTopic    string
 	MsgApplyPointsTopic string
+	MsgBrandSettings    string
+	MsgPurchaseRejected string
+	MsgExchange         string
+	MsgKeyFields        map[string]string // topic -> partition key field
 	CustomerGroup       string
 	HTTPServerPort      string
+
+	// Connection pool of the service database, and how long connecting and each
+	// statement can take (0 means no limit).
+	DBMaxOpenConns     int
+	DBMaxIdleConns     int
+	DBConnMaxLifetime  time.Duration
+	DBConnectTimeout   time.Duration
+	DBStatementTimeout time.Duration
+
+	// Queue of the postgres broker: its database, shared by both services, and how
+	// often it is polled when empty.
+	MsgQueueDSN          string
+	MsgQueuePollInterval time.Duration
+
+	// How often the outbox relay looks for events to send when the outbox is empty.
+	OutboxPollInterval time.Duration
+
+	// Referral program: rewards are granted as "coins" or as "points" of
+	// ReferralBrandID (0 means the brand of the qualifying purchase).
+	ReferralRewardType  string
+	ReferralBrandID     int
+	ReferrerReward      int
+	RefereeReward       int
+	ReferralMinPurchase float64
+
+	// Daily limits for balances a customer can transfer to other customers.
+	TransferDailyPointsLimit int
+	TransferDailyCoinsLimit  int
+
+	// How long a stored Idempotency-Key response is replayed.
+	IdempotencyKeyTTL time.Duration
+
+	// How long a shutdown waits for in-flight requests and events.
+	ShutdownTimeout time.Duration
+
+	// How long each readiness check can take.
+	HealthCheckTimeout time.Duration
+
+	// Where spans are exported (none, stdout or otlp) and the OTLP/HTTP endpoint of
+	// the collector.
+	TracingExporter     string
+	TracingOTLPEndpoint string
+
+	// Lowest level written to the log: debug, info, warn or error.
+	LogLevel string
+
+	// Whether pending migrations are applied on start.
+	MigrateOnStart bool
+
+	// Token of each service allowed to call this one, by service name.
+	ServiceTokens map[string]string
 }
 
 var (
@@ -24,27 +82,82 @@ var (
 	once           sync.Once
 )
 
-// LoadConfig initializes the configuration singleton
+// LoadConfig initializes the configuration singleton from the environment and the
+// optional CONFIG_FILE. Every setting is validated, and the returned envconfig.ValidationError lists
+// all the problems found.
 func LoadConfig() (*Config, error) {
 	var loadErr error
 	once.Do(func() {
-		dbPort, err := strconv.Atoi(getEnv("DB_PORT"))
-		if err != nil {
-			loadErr = err
-			return
+		l := envconfig.NewLoader()
+		cfg := &Config{
+			DBHost:              l.Required("DB_HOST"),
+			DBPort:              l.RequiredInt("DB_PORT", 1, 65535),
+			DBUser:              l.Required("DB_USER"),
+			DBPassword:          l.Optional("DB_PASSWORD", ""),
+			DBName:              l.Required("DB_NAME"),
+			MsgBrokerType:       l.OneOf("MSG_BROKER_TYPE", "kafka", "kafka", "memory", "postgres"),
+			MsgPurchaseTopic:    l.Required("MSG_PURCHASE"),
+			MsgApplyPointsTopic: l.Required("MSG_APPLY_POINTS"),
+			MsgBrandSettings:    l.Required("MSG_BRAND_SETTINGS"),
+			MsgPurchaseRejected: l.Optional("MSG_PURCHASE_REJECTED", "purchase-rejected-topic"),
+			MsgExchange:         l.Optional("MSG_EXCHANGE", "exchange-topic"),
+			MsgKeyFields:        l.Pairs("MSG_KEY_FIELDS"),
+			HTTPServerPort:      l.Required("HTTP_SERVER_PORT"),
+
+			DBMaxOpenConns:     l.Int("DB_MAX_OPEN_CONNS", 25, 0),
+			DBMaxIdleConns:     l.Int("DB_MAX_IDLE_CONNS", 5, 0),
+			DBConnMaxLifetime:  time.Duration(l.Int("DB_CONN_MAX_LIFETIME_SECONDS", 300, 0)) * time.Second,
+			DBConnectTimeout:   time.Duration(l.Int("DB_CONNECT_TIMEOUT_SECONDS", 5, 0)) * time.Second,
+			DBStatementTimeout: time.Duration(l.Int("DB_STATEMENT_TIMEOUT_MS", 30000, 0)) * time.Millisecond,
+
+			MsgQueuePollInterval: l.Duration("MSG_QUEUE_POLL_MS", 500, time.Millisecond),
+			OutboxPollInterval:   l.Duration("OUTBOX_POLL_MS", 500, time.Millisecond),
+
+			ReferralRewardType:  l.OneOf("REFERRAL_REWARD_TYPE", "coins", "coins", "points"),
+			ReferralBrandID:     l.Int("REFERRAL_REWARD_BRAND_ID", 0, 0),
+			ReferrerReward:      l.Int("REFERRAL_REFERRER_REWARD", 100, 0),
+			RefereeReward:       l.Int("REFERRAL_REFEREE_REWARD", 50, 0),
+			ReferralMinPurchase: l.Float("REFERRAL_MIN_PURCHASE", 0, 0),
+
+			TransferDailyPointsLimit: l.Int("TRANSFER_DAILY_POINTS_LIMIT", 1000, 0),
+			TransferDailyCoinsLimit:  l.Int("TRANSFER_DAILY_COINS_LIMIT", 500, 0),
+
+			IdempotencyKeyTTL: l.Duration("IDEMPOTENCY_KEY_TTL_HOURS", 24, time.Hour),
+
+			ShutdownTimeout:    l.Duration("SHUTDOWN_TIMEOUT_SECONDS", 15, time.Second),
+			HealthCheckTimeout: l.Duration("HEALTH_CHECK_TIMEOUT_MS", 2000, time.Millisecond),
+
+			TracingExporter:     l.OneOf("TRACING_EXPORTER", "none", "none", "stdout", "otlp"),
+			TracingOTLPEndpoint: l.Optional("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+
+			LogLevel: l.OneOf("LOG_LEVEL", "info", "debug", "info", "warn", "error"),
+
+			MigrateOnStart: l.Bool("MIGRATE_ON_START", true),
+
+			ServiceTokens: l.Pairs("SERVICE_TOKENS"),
+		}
+
+		// The Kafka brokers and consumer group are only needed by the kafka broker.
+		kafka := cfg.MsgBrokerType == "kafka"
+		cfg.KafkaBrokers = l.List("MSG_BROKER_ADDRESS", kafka)
+		if kafka {
+			cfg.CustomerGroup = l.Required("CUSTOMER_GROUP_NAME")
+		} else {
+			cfg.CustomerGroup = l.Optional("CUSTOMER_GROUP_NAME", "")
+		}
+		// The queue database is only needed by the postgres broker. It is not defaulted to
+		// the service database, where the other service would never see the events.
+		if cfg.MsgBrokerType == "postgres" {
+			cfg.MsgQueueDSN = l.Required("MSG_QUEUE_DSN")
+		} else {
+			cfg.MsgQueueDSN = l.Optional("MSG_QUEUE_DSN", "")
+		}
+		if cfg.DBMaxOpenConns > 0 && cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+			l.Problem("DB_MAX_IDLE_CONNS (%d) cannot be more than DB_MAX_OPEN_CONNS (%d)", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns)
 		}
 
-		configInstance = &Config{
-			DBHost:              getEnv("DB_HOST"),
-			DBPort:              dbPort,
-			DBUser:              getEnv("DB_USER"),
-			DBPassword:          getEnv("DB_PASSWORD"),
-			DBName:              getEnv("DB_NAME"),
-			KafkaBrokers:        []string{getEnv("MSG_BROKER_ADDRESS")},
-			MsgPurchaseTopic:    getEnv("MSG_PURCHASE"),
-			MsgApplyPointsTopic: getEnv("MSG_APPLY_POINTS"),
-			CustomerGroup:       getEnv("CUSTOMER_GROUP_NAME"),
-			HTTPServerPort:      getEnv("HTTP_SERVER_PORT"),
+		if loadErr = l.Err(); loadErr == nil {
+			configInstance = cfg
 		}
 	})
 
@@ -56,9 +169,9 @@ func GetConfig() *Config {
 	return configInstance
 }
 
-func getEnv(key string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return ""
+// DBDSN returns the connection string of the service database, with the connect and
+// statement timeouts.
+func (c *Config) DBDSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable connect_timeout=%d statement_timeout=%d",
+		c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName, int(c.DBConnectTimeout.Seconds()), c.DBStatementTimeout.Milliseconds())
 }
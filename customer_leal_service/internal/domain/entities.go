@@ -11,17 +11,54 @@ type Customer struct {
 	PassHash         string
 	Token            string
 	LealCoins        int
+	ReferralCode     string
 	RegistrationDate time.Time
 }
 
+// Purchase is a purchase of a customer at a branch of a brand. It is pending until the
+// brand service rewards it, credited, with the points and coins it earned, once the brand
+// service applies them, and rejected, with its RejectionReason, if the brand service finds
+// its branch invalid.
 type Purchase struct {
-	ID           int
-	CustomerID   int
-	Amount       float64
-	PurchaseDate time.Time
-	BrandID      int
-	BranchID     int
-	CoinsUsed    int
+	ID              int
+	CustomerID      int
+	Amount          float64
+	PurchaseDate    time.Time
+	BrandID         int
+	BranchID        int
+	CoinsUsed       int
+	Status          string
+	RejectionReason string
+	PointsEarned    int
+	CoinsEarned     int
+	Breakdown       []RewardBreakdown
+	CreditedDate    *time.Time
+}
+
+// Statuses of a purchase.
+const (
+	PurchasePending  = "pending"
+	PurchaseCredited = "credited"
+	PurchaseRejected = "rejected"
+)
+
+// RewardBreakdown is what a campaign of the brand issued for a purchase.
+type RewardBreakdown struct {
+	CampaignID   int     `json:"campaign_id"`
+	CampaignName string  `json:"campaign_name"`
+	Points       float64 `json:"points"`
+	Coins        float64 `json:"coins"`
+}
+
+// PurchaseRejection is sent by the brand service for a purchase it cannot reward, with
+// the Reason why.
+type PurchaseRejection struct {
+	PurchaseID int
+	CustomerID int
+	BrandID    int
+	BranchID   int
+	CoinsUsed  int
+	Reason     string
 }
 
 type LealPoints struct {
@@ -55,13 +92,152 @@ type Redeemed struct {
 	BrandID     int
 	RewardID    int
 	PointsSpend int
+	HouseholdID int
 	Date        time.Time
 }
 
+// LealPointsApply are the points and coins the brand service gives a customer. For a
+// purchase, PurchaseID is set and Breakdown holds what each campaign issued towards them.
 type LealPointsApply struct {
+	PurchaseID int
 	CustomerID int
 	BrandID    int
 	Points     int
 	Coins      int
 	Reason     string
+	Breakdown  []RewardBreakdown
+}
+
+type Referral struct {
+	ID           int
+	ReferrerID   int
+	RefereeID    int
+	Status       string
+	PurchaseID   int
+	CreatedDate  time.Time
+	RewardedDate time.Time
+}
+
+type LealCoinsTransaction struct {
+	ID         int
+	CustomerID int
+	Change     int
+	Reason     string
+	Date       time.Time
+}
+
+// Transfer moves points of a brand, or global coins, from one customer to another.
+type Transfer struct {
+	ID          int
+	SenderID    int
+	RecipientID int
+	BrandID     int
+	Points      int
+	Coins       int
+	Date        time.Time
+}
+
+// BrandSettings holds the loyalty program options a brand controls,
+// as published by the brand service.
+//
+// CoinsToPointsRate is brand points per Leal coin and PointsToCoinsRate is Leal
+// coins per brand point; a zero rate disables that direction. ExchangeDailyLimit
+// caps the coins a customer can exchange with the brand per day, zero meaning no limit.
+type BrandSettings struct {
+	BrandID             int
+	AllowPointsTransfer bool
+	CoinsToPointsRate   float64
+	PointsToCoinsRate   float64
+	ExchangeDailyLimit  int
+}
+
+const (
+	ExchangeCoinsToPoints = "coins_to_points"
+	ExchangePointsToCoins = "points_to_coins"
+)
+
+// Exchange converts Leal coins into points of a brand, or points of a brand into coins.
+type Exchange struct {
+	ID         int
+	CustomerID int
+	BrandID    int
+	Direction  string
+	Coins      int
+	Points     int
+	Rate       float64
+	Date       time.Time
+}
+
+// Household groups several customers that share a pooled points balance per brand.
+// Each member contributes a percentage of the points they earn to the pool.
+type Household struct {
+	ID                  int
+	Name                string
+	OwnerID             int
+	ContributionPercent int
+	CreatedDate         time.Time
+	Members             []HouseholdMember
+	Points              []HouseholdPoints
+}
+
+type HouseholdMember struct {
+	HouseholdID         int
+	CustomerID          int
+	ContributionPercent int
+	JoinedDate          time.Time
+}
+
+type HouseholdInvitation struct {
+	ID          int
+	HouseholdID int
+	CustomerID  int
+	Status      string
+	CreatedDate time.Time
+}
+
+type HouseholdPoints struct {
+	HouseholdID int
+	BrandID     int
+	Points      int
+}
+
+type HouseholdPointsTransaction struct {
+	ID          int
+	HouseholdID int
+	CustomerID  int
+	BrandID     int
+	Change      int
+	Reason      string
+	Date        time.Time
+}
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key header.
+// Scope identifies the endpoint and caller the key belongs to, and RequestHash the request
+// it was first used with. StatusCode is 0 while the original request is still in progress.
+type IdempotencyRecord struct {
+	Scope        string
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedDate  time.Time
+}
+
+// PrincipalKind is the kind of caller of a request.
+type PrincipalKind string
+
+const (
+	PrincipalCustomer PrincipalKind = "customer"
+	PrincipalBrand    PrincipalKind = "brand"
+	PrincipalService  PrincipalKind = "service"
+)
+
+// Principal is the authenticated caller of a request. ID is the customer or brand the
+// request acts for; for another service, Service is its name and ID the customer or brand
+// it acts for.
+type Principal struct {
+	Kind    PrincipalKind
+	ID      int
+	Service string
 }
@@ -0,0 +1,114 @@
+package domain
+
+import "errors"
+
+// Kind classifies the errors of the domain, so that adapters such as the HTTP layer can
+// report them without knowing each one.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindInsufficientBalance
+)
+
+// Error is an error of the domain. Code is stable and meant for clients, such as
+// "customer_not_found"; Message describes the error for people and may change.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is a domain error with the same code, so that errors.Is matches
+// the errors below even when they are created again with another message.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Validation(code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func InsufficientBalance(code, message string) *Error {
+	return &Error{Kind: KindInsufficientBalance, Code: code, Message: message}
+}
+
+// AsError returns the domain error in the chain of err, or nil if there is none, in which
+// case err is an internal error.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+var (
+	ErrCustomerNotFound        = NotFound("customer_not_found", "customer not found")
+	ErrHouseholdNotFound       = NotFound("household_not_found", "household not found")
+	ErrNotInHousehold          = NotFound("not_in_household", "customer does not belong to a household")
+	ErrHouseholdMemberNotFound = NotFound("household_member_not_found", "customer is not a member of the household")
+	ErrInvitationNotFound      = NotFound("invitation_not_found", "invitation not found")
+	ErrPurchaseNotFound        = NotFound("purchase_not_found", "purchase not found")
+
+	ErrEmailOrPhoneTaken     = Conflict("email_or_phone_taken", "email or phone is already registered")
+	ErrAlreadyInHousehold    = Conflict("already_in_household", "customer already belongs to a household")
+	ErrInvitationNotPending  = Conflict("invitation_not_pending", "invitation is no longer pending")
+	ErrHouseholdOwnerRemoval = Conflict("household_owner_removal", "the household owner cannot be removed")
+	ErrTransferLimitPoints   = Conflict("daily_points_transfer_limit_exceeded", "daily points transfer limit exceeded")
+	ErrTransferLimitCoins    = Conflict("daily_coins_transfer_limit_exceeded", "daily coins transfer limit exceeded")
+	ErrExchangeLimit         = Conflict("daily_exchange_limit_exceeded", "daily exchange limit exceeded")
+
+	ErrInvalidRequest              = Validation("invalid_request", "invalid request")
+	ErrMissingCustomerFields       = Validation("missing_customer_fields", "name, email, phone and password are required")
+	ErrInvalidReferralCode         = Validation("invalid_referral_code", "invalid referral code")
+	ErrSelfReferral                = Validation("self_referral", "self-referral is not allowed")
+	ErrMissingContact              = Validation("missing_contact", "email or phone is required")
+	ErrNegativeTransfer            = Validation("negative_transfer", "points and coins cannot be negative")
+	ErrEmptyTransfer               = Validation("empty_transfer", "either points or coins must be transferred")
+	ErrSelfTransfer                = Validation("self_transfer", "cannot transfer to yourself")
+	ErrInvalidPointsSpend          = Validation("invalid_points_spend", "points_spend must be positive")
+	ErrInvalidCoinsUsed            = Validation("invalid_coins_used", "coins_used cannot be negative")
+	ErrBrandRequired               = Validation("brand_required", "brand_id is required")
+	ErrInvalidAmount               = Validation("invalid_amount", "amount must be positive")
+	ErrInvalidDirection            = Validation("invalid_direction", "direction must be coins_to_points or points_to_coins")
+	ErrAmountTooSmall              = Validation("amount_too_small", "amount is too small for the exchange rate")
+	ErrHouseholdNameRequired       = Validation("household_name_required", "household_name is required")
+	ErrInvalidContribution         = Validation("invalid_contribution_percent", "contribution_percent must be between 0 and 100")
+	ErrInvalidCredentials          = Unauthorized("invalid_credentials", "invalid email or password")
+	ErrMissingAuthentication       = Unauthorized("missing_authentication", "customer_id and token headers are required")
+	ErrInvalidToken                = Unauthorized("invalid_token", "invalid customer_id or token")
+	ErrInvalidServiceCredentials   = Unauthorized("invalid_service_credentials", "invalid service name or token")
+	ErrPointsTransferDisabled      = Forbidden("points_transfer_disabled", "brand does not allow points transfers")
+	ErrExchangeDisabled            = Forbidden("exchange_disabled", "brand does not allow this exchange")
+	ErrNotHouseholdOwner           = Forbidden("not_household_owner", "only the household owner can manage the household")
+	ErrInsufficientCoins           = InsufficientBalance("insufficient_coins", "not enough coins")
+	ErrInsufficientPoints          = InsufficientBalance("insufficient_points", "not enough points")
+	ErrInsufficientHouseholdPoints = InsufficientBalance("insufficient_household_points", "not enough household points")
+)
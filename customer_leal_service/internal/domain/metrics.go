@@ -0,0 +1,10 @@
+package domain
+
+// BusinessMetrics records business events for monitoring.
+type BusinessMetrics interface {
+	// PurchaseRecorded records a purchase and the Leal coins spent on it.
+	PurchaseRecorded(brandID int, coinsUsed int)
+	// RewardRedeemed records a reward redeemed with points of the customer or of
+	// their household pool.
+	RewardRedeemed(brandID int, points int, fromHousehold bool)
+}
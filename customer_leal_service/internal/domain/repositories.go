@@ -1,30 +1,117 @@
 package domain
 
+import (
+	"context"
+	"time"
+)
+
 // Repositorios para acceder a los datos
 type CustomerRepository interface {
-	CreateCustomer(name string, email string, phone string, pass string, token string) (*Customer, error)
-	GetCustomerByID(id int) (*Customer, error)
-	GetCustomerByEmail(email string) (*Customer, error)
-	UpdateCustomerToken(id int, token string) error
+	CreateCustomer(ctx context.Context, name string, email string, phone string, pass string, token string, referralCode string) (*Customer, error)
+	GetCustomerByID(ctx context.Context, id int) (*Customer, error)
+	GetCustomerByEmail(ctx context.Context, email string) (*Customer, error)
+	GetCustomerByReferralCode(ctx context.Context, code string) (*Customer, error)
+	GetCustomerByPhone(ctx context.Context, phone string) (*Customer, error)
+	UpdateCustomerToken(ctx context.Context, id int, token string) error
 }
 
 type PointsRepository interface {
-	GetPointsByCustomerID(id int) ([]LealPoints, error)
-	UpdatePoints(customerID int, brandID int, points int) error
-	RecordPointsTransaction(transaction *LealPointsTransaction) error
-	RecordCoins(customerID int, coins int) error
-	GetPoinysByCustomerIDAndBrandID(customerID int, brandID int) (*LealPoints, error)
+	GetPointsByCustomerID(ctx context.Context, id int) ([]LealPoints, error)
+	UpdatePoints(ctx context.Context, customerID int, brandID int, points int) error
+	RecordPointsTransaction(ctx context.Context, transaction *LealPointsTransaction) error
+	GetPoinysByCustomerIDAndBrandID(ctx context.Context, customerID int, brandID int) (*LealPoints, error)
+	GetPointsTransactionsByCustomerID(ctx context.Context, customerID int) ([]LealPointsTransaction, error)
 }
 
 type CoinsRepository interface {
-	GetCoinsByCustomerID(id int) (int, error)
-	UpdateCustomerCoins(id int, coins int) error
+	GetCoinsByCustomerID(ctx context.Context, id int) (int, error)
+	UpdateCustomerCoins(ctx context.Context, id int, coins int, reason string) error
+	GetCoinsTransactionsByCustomerID(ctx context.Context, customerID int) ([]LealCoinsTransaction, error)
 }
 
 type PurchasesRepository interface {
-	RecordPurchase(purchase *Purchase) (*Purchase, error)
+	RecordPurchase(ctx context.Context, purchase *Purchase) (*Purchase, error)
+	RejectPurchase(ctx context.Context, purchaseID int, reason string) (*Purchase, error)
+	CreditPurchase(ctx context.Context, purchaseID int, points int, coins int, breakdown []RewardBreakdown) (*Purchase, error)
+	GetPurchaseByID(ctx context.Context, purchaseID int) (*Purchase, error)
+	GetPurchasesByCustomerID(ctx context.Context, customerID int) ([]Purchase, error)
 }
 
 type RedeemedRepository interface {
-	RedeemReward(redeemed *Redeemed) (*Redeemed, error)
+	RedeemReward(ctx context.Context, redeemed *Redeemed) (*Redeemed, error)
+}
+
+type ReferralRepository interface {
+	CreateReferral(ctx context.Context, referrerID int, refereeID int) (*Referral, error)
+	GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]Referral, error)
+	MarkReferralRewarded(ctx context.Context, refereeID int, purchaseID int) (*Referral, error)
+}
+
+type TransferRepository interface {
+	TransferBalance(ctx context.Context, transfer *Transfer, since time.Time, pointsLimit int, coinsLimit int) (*Transfer, error)
+	GetTransferredSince(ctx context.Context, senderID int, brandID int, since time.Time) (points int, coins int, err error)
+}
+
+type BrandSettingsRepository interface {
+	GetBrandSettings(ctx context.Context, brandID int) (*BrandSettings, error)
+	SaveBrandSettings(ctx context.Context, settings *BrandSettings) error
+}
+
+type HouseholdRepository interface {
+	CreateHousehold(ctx context.Context, name string, ownerID int, contributionPercent int) (*Household, error)
+	GetHouseholdByID(ctx context.Context, id int) (*Household, error)
+	GetMember(ctx context.Context, customerID int) (*HouseholdMember, error)
+	GetMembers(ctx context.Context, householdID int) ([]HouseholdMember, error)
+	AddMember(ctx context.Context, householdID int, customerID int, contributionPercent int) error
+	RemoveMember(ctx context.Context, householdID int, customerID int) error
+	UpdateMemberContribution(ctx context.Context, householdID int, customerID int, contributionPercent int) error
+	CreateInvitation(ctx context.Context, householdID int, customerID int) (*HouseholdInvitation, error)
+	GetInvitationByID(ctx context.Context, id int) (*HouseholdInvitation, error)
+	GetPendingInvitationsByCustomerID(ctx context.Context, customerID int) ([]HouseholdInvitation, error)
+	UpdateInvitationStatus(ctx context.Context, id int, status string) error
+	GetPoints(ctx context.Context, householdID int) ([]HouseholdPoints, error)
+	UpdatePoints(ctx context.Context, householdID int, brandID int, delta int) error
+	RecordPointsTransaction(ctx context.Context, transaction *HouseholdPointsTransaction) error
+}
+
+type ExchangeRepository interface {
+	Exchange(ctx context.Context, exchange *Exchange, since time.Time, dailyLimit int) (*Exchange, error)
+	GetExchangedCoinsSince(ctx context.Context, customerID int, brandID int, since time.Time) (int, error)
+}
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *IdempotencyRecord, expiredBefore time.Time) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	Release(ctx context.Context, scope string, key string) error
+}
+
+// OutboxRepository stores events in the transaction of the changes that cause them, so
+// that an event is sent if and only if those changes commit.
+type OutboxRepository interface {
+	AddEvent(ctx context.Context, topic string, event Event) error
+	GetPendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	RecordFailure(ctx context.Context, id int64, reason string) error
+	DeleteEvent(ctx context.Context, id int64) error
+}
+
+// Repositories groups the repositories handed to a unit of work. All of them run in the
+// same database transaction.
+type Repositories struct {
+	Customers     CustomerRepository
+	Points        PointsRepository
+	Coins         CoinsRepository
+	Purchases     PurchasesRepository
+	Redeemed      RedeemedRepository
+	Referrals     ReferralRepository
+	Transfers     TransferRepository
+	BrandSettings BrandSettingsRepository
+	Households    HouseholdRepository
+	Exchanges     ExchangeRepository
+	Outbox        OutboxRepository
+}
+
+// UnitOfWork runs a group of repository operations atomically. Do commits the work when
+// fn returns nil and rolls it back when fn returns an error or ctx is cancelled.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(repos Repositories) error) error
 }
@@ -1,25 +1,54 @@
 package domain
 
+import "context"
+
 type CustomerService interface {
-	CreateCustomer(name string, email string, phone string, pass string) (*Customer, error)
-	LoginCustomer(email string, pass string) (*Customer, error)
-	GetCustomerByID(id int) (*Customer, error)
-	ValidateToken(customerID int, token string) error
+	CreateCustomer(ctx context.Context, name string, email string, phone string, pass string, referralCode string) (*Customer, error)
+	LoginCustomer(ctx context.Context, email string, pass string) (*Customer, error)
+	GetCustomerByID(ctx context.Context, id int) (*Customer, error)
+	ValidateToken(ctx context.Context, customerID int, token string) error
 }
 type PointService interface {
-	GetCustomerPoints(customerID int) ([]LealPoints, error)
-	UpdatePoints(customerID int, brandID int, pointsDelta int, reason string) error
+	GetCustomerPoints(ctx context.Context, customerID int) ([]LealPoints, error)
+	UpdatePoints(ctx context.Context, customerID int, brandID int, pointsDelta int, reason string) error
+	GetPointsHistory(ctx context.Context, customerID int) ([]LealPointsTransaction, error)
 }
 
 type CoinService interface {
-	GetCustomerCoins(customerID int) (int, error)
-	UpdateCustomerCoins(id int, coins int) error
+	GetCustomerCoins(ctx context.Context, customerID int) (int, error)
+	UpdateCustomerCoins(ctx context.Context, id int, coins int, reason string) error
+	GetCoinsHistory(ctx context.Context, customerID int) ([]LealCoinsTransaction, error)
 }
 
 type PurchaseService interface {
-	ProcessPurchase(attempPurchase *Purchase) (*Purchase, error)
+	ProcessPurchase(ctx context.Context, attempPurchase *Purchase) (*Purchase, error)
+	GetPurchase(ctx context.Context, customerID int, purchaseID int) (*Purchase, error)
+	GetPurchases(ctx context.Context, customerID int) ([]Purchase, error)
 }
 
 type RedeemService interface {
-	RedeemReward(redeem *Redeemed) (*Redeemed, error)
+	RedeemReward(ctx context.Context, redeem *Redeemed) (*Redeemed, error)
+}
+
+type ReferralService interface {
+	GetReferrals(ctx context.Context, customerID int) ([]Referral, error)
+}
+
+type TransferService interface {
+	TransferBalance(ctx context.Context, transfer *Transfer, recipientEmail string, recipientPhone string) (*Transfer, error)
+}
+
+type HouseholdService interface {
+	CreateHousehold(ctx context.Context, ownerID int, name string, contributionPercent int) (*Household, error)
+	GetHousehold(ctx context.Context, customerID int) (*Household, error)
+	InviteMember(ctx context.Context, ownerID int, email string, phone string) (*HouseholdInvitation, error)
+	GetInvitations(ctx context.Context, customerID int) ([]HouseholdInvitation, error)
+	AcceptInvitation(ctx context.Context, customerID int, invitationID int) (*Household, error)
+	RemoveMember(ctx context.Context, requesterID int, customerID int) error
+	SetContribution(ctx context.Context, ownerID int, customerID int, contributionPercent int) error
+	SelectPool(ctx context.Context, redeem *Redeemed) (bool, error)
+}
+
+type ExchangeService interface {
+	Exchange(ctx context.Context, customerID int, brandID int, direction string, amount int) (*Exchange, error)
 }
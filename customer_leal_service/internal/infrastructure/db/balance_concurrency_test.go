@@ -0,0 +1,264 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/application"
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db/migrations"
+	_ "github.com/lib/pq"
+)
+
+// These tests run against the PostgreSQL database of TEST_DATABASE_URL, which they migrate
+// to the latest version, and are skipped when it is not set. Each test works with its own
+// new customer, so they can run against a database with other data.
+
+type noMetrics struct{}
+
+func (noMetrics) PurchaseRecorded(int, int)     {}
+func (noMetrics) RewardRedeemed(int, int, bool) {}
+
+// testDB opens and migrates the test database, and loads the configuration the services
+// read, with the topics the events are queued to.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	for key, value := range map[string]string{
+		"DB_HOST": "localhost", "DB_PORT": "5432", "DB_USER": "test", "DB_NAME": "test",
+		"MSG_BROKER_TYPE": "memory", "MSG_PURCHASE": "purchase-topic", "MSG_APPLY_POINTS": "apply-points-topic",
+		"MSG_BRAND_SETTINGS": "brand-settings-topic", "HTTP_SERVER_PORT": "0",
+	} {
+		t.Setenv(key, value)
+	}
+	if _, err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	migrator, err := migrations.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// newCustomer creates a customer with the given coins and points of the brand.
+func newCustomer(t *testing.T, conn *sql.DB, brandID int, coins int, points int) int {
+	t.Helper()
+	ctx := context.Background()
+	unique := fmt.Sprintf("%d", time.Now().UnixNano())
+	customer, err := db.NewPostgresCustomerRepo(conn).CreateCustomer(ctx, "Test", unique+"@example.com", unique, "", "", "T"+unique)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.NewPostgresCoinsRepo(conn).UpdateCustomerCoins(ctx, customer.ID, coins, "opening balance"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.NewPostgresPointsRepo(conn).UpdatePoints(ctx, customer.ID, brandID, points); err != nil {
+		t.Fatal(err)
+	}
+	return customer.ID
+}
+
+// checkCoinsLedger fails the test if the coins ledger of the customer does not add up to
+// their balance.
+func checkCoinsLedger(t *testing.T, conn *sql.DB, customerID int) {
+	t.Helper()
+	var balance, sum int
+	query := `SELECT leal_coins, (SELECT COALESCE(SUM(change), 0) FROM leal_coins_transactions WHERE customer_id = $1) FROM customer WHERE id = $1`
+	if err := conn.QueryRow(query, customerID).Scan(&balance, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != balance {
+		t.Errorf("coins ledger of customer %d adds up to %d, want the balance of %d", customerID, sum, balance)
+	}
+}
+
+// TestConcurrentSpending makes parallel purchases paid with coins and parallel redemptions
+// of points of one customer, more than the balances cover. Exactly as many succeed as the
+// balances allow, the others fail with the insufficient balance errors, the balances never
+// go negative and the ledgers record exactly the successful ones.
+func TestConcurrentSpending(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+
+	const (
+		brandID  = 1
+		balance  = 100
+		cost     = 30
+		attempts = 12
+	)
+	customerID := newCustomer(t, conn, brandID, balance, balance)
+
+	uow := db.NewPostgresUnitOfWork(conn)
+	purchases := application.NewPurchaseService(db.NewPostgresPurchasesRepo(conn), uow, noMetrics{})
+	households := application.NewHouseholdService(db.NewPostgresHouseholdRepo(conn), db.NewPostgresCustomerRepo(conn), uow)
+	redeems := application.NewRedeemService(uow, households, noMetrics{})
+
+	var (
+		wg                  sync.WaitGroup
+		mu                  sync.Mutex
+		purchased, redeemed int
+		unexpectedErrs      []error
+	)
+	record := func(err error, expected error, succeeded *int) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err == nil:
+			*succeeded++
+		case !errors.Is(err, expected):
+			unexpectedErrs = append(unexpectedErrs, err)
+		}
+	}
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := purchases.ProcessPurchase(ctx, &domain.Purchase{CustomerID: customerID, BrandID: brandID, BranchID: 1, Amount: 10, CoinsUsed: cost})
+			record(err, domain.ErrInsufficientCoins, &purchased)
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := redeems.RedeemReward(ctx, &domain.Redeemed{CustomerID: customerID, BrandID: brandID, RewardID: 1, PointsSpend: cost})
+			record(err, domain.ErrInsufficientPoints, &redeemed)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	for _, err := range unexpectedErrs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := balance / cost
+	if purchased != want {
+		t.Errorf("%d purchases succeeded, want %d", purchased, want)
+	}
+	if redeemed != want {
+		t.Errorf("%d redemptions succeeded, want %d", redeemed, want)
+	}
+
+	var coins, points int
+	if err := conn.QueryRow(`SELECT leal_coins FROM customer WHERE id = $1`, customerID).Scan(&coins); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRow(`SELECT points FROM leal_points WHERE customer_id = $1 AND brand_id = $2`, customerID, brandID).Scan(&points); err != nil {
+		t.Fatal(err)
+	}
+	if coins != balance-purchased*cost || coins < 0 {
+		t.Errorf("coins balance %d, want %d", coins, balance-purchased*cost)
+	}
+	if points != balance-redeemed*cost || points < 0 {
+		t.Errorf("points balance %d, want %d", points, balance-redeemed*cost)
+	}
+
+	// Every successful purchase is recorded with its coins and its queued event, and every
+	// successful redemption with its ledger debit.
+	ledgers := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"purchases", `SELECT COUNT(*), COALESCE(SUM(coins_used), 0) FROM purchase WHERE customer_id = $1`, purchased},
+		{"redemptions", `SELECT COUNT(*), COALESCE(SUM(points_spend), 0) FROM redeemed WHERE customer_id = $1`, redeemed},
+		{"points transactions", `SELECT COUNT(*), COALESCE(-SUM(change), 0) FROM leal_points_transactions WHERE customer_id = $1 AND change < 0`, redeemed},
+	}
+	for _, l := range ledgers {
+		var rows, total int
+		if err := conn.QueryRow(l.query, customerID).Scan(&rows, &total); err != nil {
+			t.Fatal(err)
+		}
+		if rows != l.want || total != l.want*cost {
+			t.Errorf("%s: %d rows for %d, want %d rows for %d", l.name, rows, total, l.want, l.want*cost)
+		}
+	}
+	checkCoinsLedger(t, conn, customerID)
+	var events int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM event_outbox WHERE keys->>'customer_id' = $1`, fmt.Sprint(customerID)).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != purchased {
+		t.Errorf("%d purchase events queued, want %d", events, purchased)
+	}
+}
+
+// TestReciprocalTransfers makes parallel transfers of points and coins between two
+// customers in both directions. They lock the balances of both customers in the same
+// order, so all of them succeed without deadlocks, and the balances the customers hold
+// together do not change.
+func TestReciprocalTransfers(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+
+	const (
+		brandID  = 1
+		balance  = 100
+		attempts = 20
+	)
+	first := newCustomer(t, conn, brandID, balance, balance)
+	second := newCustomer(t, conn, brandID, balance, balance)
+	transfers := db.NewPostgresTransferRepo(conn)
+	since := time.Now().Add(-time.Hour)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*attempts)
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		for _, transfer := range []domain.Transfer{
+			{SenderID: first, RecipientID: second, BrandID: brandID, Points: 1},
+			{SenderID: second, RecipientID: first, BrandID: brandID, Points: 1},
+			{SenderID: first, RecipientID: second, Coins: 1},
+			{SenderID: second, RecipientID: first, Coins: 1},
+		} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if _, err := transfers.TransferBalance(ctx, &transfer, since, balance, balance); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var coins, points int
+	if err := conn.QueryRow(`SELECT SUM(leal_coins) FROM customer WHERE id IN ($1, $2)`, first, second).Scan(&coins); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRow(`SELECT SUM(points) FROM leal_points WHERE customer_id IN ($1, $2) AND brand_id = $3`, first, second, brandID).Scan(&points); err != nil {
+		t.Fatal(err)
+	}
+	if coins != 2*balance || points != 2*balance {
+		t.Errorf("the customers hold %d coins and %d points, want %d of each", coins, points, 2*balance)
+	}
+	checkCoinsLedger(t, conn, first)
+	checkCoinsLedger(t, conn, second)
+}
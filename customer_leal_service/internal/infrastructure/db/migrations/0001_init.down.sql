@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS redeemed;
+DROP TABLE IF EXISTS leal_points_transactions;
+DROP TABLE IF EXISTS leal_points;
+DROP TABLE IF EXISTS purchase;
+DROP TABLE IF EXISTS customer;
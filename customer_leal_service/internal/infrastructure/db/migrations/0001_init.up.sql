@@ -58,4 +58,4 @@ CREATE INDEX idx_purchase_branch_id ON purchase(branch_id);
 
 CREATE INDEX idx_redeemed_customer_id_brand_id_reward_id ON redeemed(customer_id, brand_id, reward_id);
 
-CREATE INDEX idx_redeemed_date ON redeemed(date);
\ No newline at end of file
+CREATE INDEX idx_redeemed_date ON redeemed(date);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS referral;
+
+ALTER TABLE customer DROP COLUMN IF EXISTS referral_code;
@@ -0,0 +1,15 @@
+-- Every customer gets a referral code, and referrals are rewarded on the first
+-- qualifying purchase of the referee.
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS referral_code VARCHAR(20) UNIQUE;
+
+CREATE TABLE IF NOT EXISTS referral (
+    id SERIAL PRIMARY KEY,
+    referrer_id INT NOT NULL REFERENCES customer(id),
+    referee_id INT NOT NULL UNIQUE REFERENCES customer(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    purchase_id INT REFERENCES purchase(id),
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rewarded_date TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_referral_referrer_id ON referral(referrer_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS brand_settings;
+DROP TABLE IF EXISTS transfer;
+DROP TABLE IF EXISTS leal_coins_transactions;
+
+ALTER TABLE leal_points_transactions DROP COLUMN IF EXISTS date;
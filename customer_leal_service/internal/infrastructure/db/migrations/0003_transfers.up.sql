@@ -0,0 +1,31 @@
+-- Customers transfer points of a brand, or coins, to each other, recorded in dated
+-- points and coins ledgers. Brands opt out of points transfers in their settings.
+ALTER TABLE leal_points_transactions ADD COLUMN IF NOT EXISTS date TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS leal_coins_transactions (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customer(id),
+    change INT NOT NULL,
+    reason VARCHAR(100) NOT NULL,
+    date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transfer (
+    id SERIAL PRIMARY KEY,
+    sender_id INT NOT NULL REFERENCES customer(id),
+    recipient_id INT NOT NULL REFERENCES customer(id),
+    brand_id INT,
+    points INT NOT NULL DEFAULT 0,
+    coins INT NOT NULL DEFAULT 0,
+    date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS brand_settings (
+    brand_id INT PRIMARY KEY,
+    allow_points_transfer BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_leal_coins_transactions_customer_id ON leal_coins_transactions(customer_id);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_sender_id_date ON transfer(sender_id, date);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS household_points_transactions;
+DROP TABLE IF EXISTS household_points;
+DROP TABLE IF EXISTS household_invitation;
+DROP TABLE IF EXISTS household_member;
+DROP TABLE IF EXISTS household;
+
+ALTER TABLE redeemed DROP COLUMN IF EXISTS household_id;
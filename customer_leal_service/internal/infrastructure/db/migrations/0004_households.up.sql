@@ -0,0 +1,48 @@
+-- Households pool a share of the points their members earn per brand, and redemptions
+-- can spend the pool.
+ALTER TABLE redeemed ADD COLUMN IF NOT EXISTS household_id INT;
+
+CREATE TABLE IF NOT EXISTS household (
+    id SERIAL PRIMARY KEY,
+    household_name VARCHAR(100) NOT NULL,
+    owner_id INT NOT NULL REFERENCES customer(id),
+    contribution_percent INT NOT NULL DEFAULT 100 CHECK (contribution_percent BETWEEN 0 AND 100),
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS household_member (
+    household_id INT NOT NULL REFERENCES household(id),
+    customer_id INT NOT NULL UNIQUE REFERENCES customer(id),
+    contribution_percent INT NOT NULL DEFAULT 100 CHECK (contribution_percent BETWEEN 0 AND 100),
+    joined_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (household_id, customer_id)
+);
+
+CREATE TABLE IF NOT EXISTS household_invitation (
+    id SERIAL PRIMARY KEY,
+    household_id INT NOT NULL REFERENCES household(id),
+    customer_id INT NOT NULL REFERENCES customer(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS household_points (
+    household_id INT NOT NULL REFERENCES household(id),
+    brand_id INT NOT NULL,
+    points INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (household_id, brand_id)
+);
+
+CREATE TABLE IF NOT EXISTS household_points_transactions (
+    id SERIAL PRIMARY KEY,
+    household_id INT NOT NULL REFERENCES household(id),
+    customer_id INT NOT NULL REFERENCES customer(id),
+    brand_id INT NOT NULL,
+    change INT NOT NULL,
+    reason VARCHAR(100) NOT NULL,
+    date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_household_invitation_customer_id ON household_invitation(customer_id);
+
+CREATE INDEX IF NOT EXISTS idx_household_points_transactions_household_id ON household_points_transactions(household_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS exchange;
+
+ALTER TABLE brand_settings
+    DROP COLUMN IF EXISTS exchange_daily_limit,
+    DROP COLUMN IF EXISTS points_to_coins_rate,
+    DROP COLUMN IF EXISTS coins_to_points_rate;
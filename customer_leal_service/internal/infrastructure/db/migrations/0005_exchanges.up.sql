@@ -0,0 +1,19 @@
+-- Customers exchange coins for points of a brand, and back, at the rates and within the
+-- daily limit the brand sets.
+ALTER TABLE brand_settings
+    ADD COLUMN IF NOT EXISTS coins_to_points_rate DECIMAL(10, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS points_to_coins_rate DECIMAL(10, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS exchange_daily_limit INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS exchange (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customer(id),
+    brand_id INT NOT NULL,
+    direction VARCHAR(20) NOT NULL,
+    coins INT NOT NULL,
+    points INT NOT NULL,
+    rate DECIMAL(10, 4) NOT NULL,
+    date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_customer_id_date ON exchange(customer_id, date);
@@ -0,0 +1,3 @@
+ALTER TABLE purchase
+    DROP COLUMN IF EXISTS rejection_reason,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,9 @@
+-- Purchases are pending until the brand service rewards them, and rejected, with the
+-- reason, when their branch is unknown, closed or of another brand. The purchases made
+-- before the status existed were already rewarded, so they are marked as credited, and
+-- only new purchases start as pending.
+ALTER TABLE purchase
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'credited',
+    ADD COLUMN IF NOT EXISTS rejection_reason VARCHAR(50);
+
+ALTER TABLE purchase ALTER COLUMN status SET DEFAULT 'pending';
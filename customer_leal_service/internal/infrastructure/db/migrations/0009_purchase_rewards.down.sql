@@ -0,0 +1,5 @@
+ALTER TABLE purchase
+    DROP COLUMN IF EXISTS credited_date,
+    DROP COLUMN IF EXISTS reward_breakdown,
+    DROP COLUMN IF EXISTS coins_earned,
+    DROP COLUMN IF EXISTS points_earned;
@@ -0,0 +1,7 @@
+-- Credited purchases keep the points and coins they earned and what each campaign of the
+-- brand issued towards them.
+ALTER TABLE purchase
+    ADD COLUMN IF NOT EXISTS points_earned INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS coins_earned INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reward_breakdown JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS credited_date TIMESTAMP;
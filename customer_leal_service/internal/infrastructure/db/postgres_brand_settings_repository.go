@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type postgresBrandSettingsRepo struct {
+	db DBTX
+}
+
+func NewPostgresBrandSettingsRepo(db DBTX) domain.BrandSettingsRepository {
+	return &postgresBrandSettingsRepo{db: db}
+}
+
+// GetBrandSettings retrieves the settings published by the brand service for the given brand.
+// Brands that never published settings get the defaults (transfers allowed, exchange
+// disabled), so the method never returns nil without an error.
+func (r *postgresBrandSettingsRepo) GetBrandSettings(ctx context.Context, brandID int) (*domain.BrandSettings, error) {
+	query := `SELECT brand_id, allow_points_transfer, coins_to_points_rate, points_to_coins_rate, exchange_daily_limit
+		FROM brand_settings WHERE brand_id = $1`
+	row := r.db.QueryRowContext(ctx, query, brandID)
+	var s domain.BrandSettings
+	if err := row.Scan(&s.BrandID, &s.AllowPointsTransfer, &s.CoinsToPointsRate, &s.PointsToCoinsRate, &s.ExchangeDailyLimit); err != nil {
+		if err == sql.ErrNoRows {
+			return &domain.BrandSettings{BrandID: brandID, AllowPointsTransfer: true}, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveBrandSettings inserts or replaces the settings of a brand.
+// It returns an error if the query fails.
+func (r *postgresBrandSettingsRepo) SaveBrandSettings(ctx context.Context, settings *domain.BrandSettings) error {
+	query := `
+		INSERT INTO brand_settings (brand_id, allow_points_transfer, coins_to_points_rate, points_to_coins_rate, exchange_daily_limit, updated_date)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (brand_id)
+		DO UPDATE SET allow_points_transfer = $2, coins_to_points_rate = $3, points_to_coins_rate = $4,
+			exchange_daily_limit = $5, updated_date = CURRENT_TIMESTAMP`
+	_, err := r.db.ExecContext(ctx, query, settings.BrandID, settings.AllowPointsTransfer, settings.CoinsToPointsRate, settings.PointsToCoinsRate, settings.ExchangeDailyLimit)
+	return err
+}
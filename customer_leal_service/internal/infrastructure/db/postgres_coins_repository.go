@@ -1,16 +1,16 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
 type postgresCoinsRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresCoinsRepo(db *sql.DB) domain.CoinsRepository {
+func NewPostgresCoinsRepo(db DBTX) domain.CoinsRepository {
 	return &postgresCoinsRepo{db: db}
 }
 
@@ -18,9 +18,9 @@ func NewPostgresCoinsRepo(db *sql.DB) domain.CoinsRepository {
 // from the database by customer ID. It returns the number of coins or an error
 // if the retrieval fails.
 
-func (r *postgresCoinsRepo) GetCoinsByCustomerID(customerID int) (int, error) {
+func (r *postgresCoinsRepo) GetCoinsByCustomerID(ctx context.Context, customerID int) (int, error) {
 	query := `SELECT leal_coins FROM customer WHERE id = $1`
-	row := r.db.QueryRow(query, customerID)
+	row := r.db.QueryRowContext(ctx, query, customerID)
 	var coins int
 	if err := row.Scan(&coins); err != nil {
 		return 0, err
@@ -28,12 +28,56 @@ func (r *postgresCoinsRepo) GetCoinsByCustomerID(customerID int) (int, error) {
 	return coins, nil
 }
 
-// UpdateCustomerCoins updates the number of coins a customer has. The number of coins
-// is modified by the given delta. If the resulting number of coins is negative, the
-// number of coins is reset to 0. The function returns an error if the update query
+// UpdateCustomerCoins updates the number of coins a customer has by the given delta and
+// records it, with its reason, in the leal_coins_transactions ledger, in a single
+// statement. Negative deltas only apply when the customer has enough coins; otherwise
+// domain.ErrInsufficientCoins is returned and the balance is left unchanged. It returns
+// domain.ErrCustomerNotFound if there is no such customer, and an error if the update query
 // fails.
-func (r *postgresCoinsRepo) UpdateCustomerCoins(customerID int, coins_delta int) error {
-	query := `UPDATE customer SET leal_coins = GREATEST(leal_coins + $1, 0) WHERE id = $2`
-	_, err := r.db.Exec(query, coins_delta, customerID)
-	return err
+func (r *postgresCoinsRepo) UpdateCustomerCoins(ctx context.Context, customerID int, coins_delta int, reason string) error {
+	query := `
+		WITH updated AS (
+			UPDATE customer SET leal_coins = leal_coins + $1 WHERE id = $2 AND leal_coins + $1 >= 0 RETURNING id
+		)
+		INSERT INTO leal_coins_transactions (customer_id, change, reason)
+		SELECT id, $1, $3 FROM updated`
+	res, err := r.db.ExecContext(ctx, query, coins_delta, customerID, reason)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM customer WHERE id = $1)`, customerID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return domain.ErrCustomerNotFound
+	}
+	return domain.ErrInsufficientCoins
+}
+
+// GetCoinsTransactionsByCustomerID retrieves the coins ledger of a customer, newest first.
+func (r *postgresCoinsRepo) GetCoinsTransactionsByCustomerID(ctx context.Context, customerID int) ([]domain.LealCoinsTransaction, error) {
+	query := `SELECT id, customer_id, change, reason, date FROM leal_coins_transactions WHERE customer_id = $1 ORDER BY date DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []domain.LealCoinsTransaction
+	for rows.Next() {
+		var t domain.LealCoinsTransaction
+		if err := rows.Scan(&t.ID, &t.CustomerID, &t.Change, &t.Reason, &t.Date); err != nil {
+			return nil, err
+		}
+		results = append(results, t)
+	}
+	return results, nil
 }
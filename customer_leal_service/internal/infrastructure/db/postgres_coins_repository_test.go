@@ -0,0 +1,38 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db"
+)
+
+func TestUpdateCustomerCoinsErrors(t *testing.T) {
+	conn := testDB(t)
+	customerID := newCustomer(t, conn, 1, 10, 0)
+	var unknownID int
+	if err := conn.QueryRow(`SELECT COALESCE(MAX(id), 0) + 1000 FROM customer`).Scan(&unknownID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		customerID int
+		delta      int
+		want       error
+	}{
+		"unknown customer credited": {customerID: unknownID, delta: 5, want: domain.ErrCustomerNotFound},
+		"unknown customer debited":  {customerID: unknownID, delta: -5, want: domain.ErrCustomerNotFound},
+		"debit beyond the balance":  {customerID: customerID, delta: -11, want: domain.ErrInsufficientCoins},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := db.NewPostgresCoinsRepo(conn).UpdateCustomerCoins(context.Background(), tt.customerID, tt.delta, "test")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("UpdateCustomerCoins() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	checkCoinsLedger(t, conn, customerID)
+}
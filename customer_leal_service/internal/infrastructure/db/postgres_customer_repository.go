@@ -1,16 +1,19 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/lib/pq"
 )
 
 type postgresCustomerRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresCustomerRepo(db *sql.DB) domain.CustomerRepository {
+func NewPostgresCustomerRepo(db DBTX) domain.CustomerRepository {
 	return &postgresCustomerRepo{db: db}
 }
 
@@ -18,15 +21,19 @@ func NewPostgresCustomerRepo(db *sql.DB) domain.CustomerRepository {
 // The customer name, email, phone, password and token are required.
 // An error is returned if any of the required fields are not provided.
 // The customer's password is hashed before being stored.
-func (r *postgresCustomerRepo) CreateCustomer(name string, email string, phone string, pass string, token string) (*domain.Customer, error) {
-	query := `INSERT INTO customer (customer_name, email, phone, pass_hash, token, leal_coins) VALUES ($1, $2, $3, $4 , $5 , 0) RETURNING id`
-	row := r.db.QueryRow(query, name, email, phone, pass, token)
+func (r *postgresCustomerRepo) CreateCustomer(ctx context.Context, name string, email string, phone string, pass string, token string, referralCode string) (*domain.Customer, error) {
+	query := `INSERT INTO customer (customer_name, email, phone, pass_hash, token, leal_coins, referral_code) VALUES ($1, $2, $3, $4 , $5 , 0, $6) RETURNING id`
+	row := r.db.QueryRowContext(ctx, query, name, email, phone, pass, token, referralCode)
 	var c domain.Customer
 	c.Name = name
 	c.Email = email
 	c.Phone = phone
 	c.Token = token
+	c.ReferralCode = referralCode
 	if err := row.Scan(&c.ID); err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrEmailOrPhoneTaken
+		}
 		return nil, err
 	}
 	return &c, nil
@@ -34,34 +41,76 @@ func (r *postgresCustomerRepo) CreateCustomer(name string, email string, phone s
 }
 
 // GetCustomerByID retrieves a customer by ID.
-// It returns the customer if found, or an error if the customer is not found.
-func (r *postgresCustomerRepo) GetCustomerByID(id int) (*domain.Customer, error) {
-	query := `SELECT id, customer_name, email, phone ,pass_hash, token, leal_coins FROM customer WHERE id = $1`
-	row := r.db.QueryRow(query, id)
+// It returns nil if no customer has that ID, or an error if the query fails.
+func (r *postgresCustomerRepo) GetCustomerByID(ctx context.Context, id int) (*domain.Customer, error) {
+	query := `SELECT id, customer_name, email, phone ,pass_hash, token, leal_coins, COALESCE(referral_code, '') FROM customer WHERE id = $1`
+	row := r.db.QueryRowContext(ctx, query, id)
 	var c domain.Customer
-	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.PassHash, &c.Token, &c.LealCoins); err != nil {
+	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.PassHash, &c.Token, &c.LealCoins, &c.ReferralCode); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &c, nil
 }
 
 // GetCustomerByEmail retrieves a customer by email.
-// It returns the customer if found, or an error if the customer is not found.
-func (r *postgresCustomerRepo) GetCustomerByEmail(email string) (*domain.Customer, error) {
-	query := `SELECT id, customer_name, email, phone ,pass_hash, token, leal_coins FROM customer WHERE email = $1`
-	row := r.db.QueryRow(query, email)
+// It returns nil if no customer has that email, or an error if the query fails.
+func (r *postgresCustomerRepo) GetCustomerByEmail(ctx context.Context, email string) (*domain.Customer, error) {
+	query := `SELECT id, customer_name, email, phone ,pass_hash, token, leal_coins, COALESCE(referral_code, '') FROM customer WHERE email = $1`
+	row := r.db.QueryRowContext(ctx, query, email)
 	var c domain.Customer
-	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.PassHash, &c.Token, &c.LealCoins); err != nil {
+	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.PassHash, &c.Token, &c.LealCoins, &c.ReferralCode); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &c, nil
 
 }
 
+// GetCustomerByReferralCode retrieves the customer owning the given referral code.
+// It returns nil if no customer has that code, or an error if the query fails.
+func (r *postgresCustomerRepo) GetCustomerByReferralCode(ctx context.Context, code string) (*domain.Customer, error) {
+	query := `SELECT id, customer_name, email, phone ,pass_hash, token, leal_coins, COALESCE(referral_code, '') FROM customer WHERE referral_code = $1`
+	row := r.db.QueryRowContext(ctx, query, code)
+	var c domain.Customer
+	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.PassHash, &c.Token, &c.LealCoins, &c.ReferralCode); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCustomerByPhone retrieves a customer by phone.
+// It returns nil if no customer has that phone, or an error if the query fails.
+func (r *postgresCustomerRepo) GetCustomerByPhone(ctx context.Context, phone string) (*domain.Customer, error) {
+	query := `SELECT id, customer_name, email, phone ,pass_hash, token, leal_coins, COALESCE(referral_code, '') FROM customer WHERE phone = $1`
+	row := r.db.QueryRowContext(ctx, query, phone)
+	var c domain.Customer
+	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.PassHash, &c.Token, &c.LealCoins, &c.ReferralCode); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
 // UpdateCustomerToken updates the token for the customer with the given ID.
 // It returns an error if the query fails.
-func (r *postgresCustomerRepo) UpdateCustomerToken(id int, token string) error {
+func (r *postgresCustomerRepo) UpdateCustomerToken(ctx context.Context, id int, token string) error {
 	query := `UPDATE customer SET token = $1 WHERE id = $2`
-	_, err := r.db.Exec(query, token, id)
+	_, err := r.db.ExecContext(ctx, query, token, id)
 	return err
 }
+
+// isUniqueViolation reports whether err is the violation of a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type postgresExchangeRepo struct {
+	db DBTX
+}
+
+func NewPostgresExchangeRepo(db DBTX) domain.ExchangeRepository {
+	return &postgresExchangeRepo{db: db}
+}
+
+// Exchange converts coins into points of a brand, or points of a brand into coins, in a
+// single database transaction.
+//
+// The customer row is locked with SELECT ... FOR UPDATE first, so the exchanges of a
+// customer run one at a time: unless dailyLimit is zero, the coins exchanged with the brand
+// since the given time are summed under the lock and checked against it, so concurrent
+// exchanges cannot exceed it. The balance being spent is locked and checked before the move.
+// Both legs are written as a double entry: a debit in one ledger and a credit in the other
+// (leal_coins_transactions and leal_points_transactions), and the exchange itself is stored
+// in the exchange table. If any step fails, nothing is written. It returns the exchange with
+// its ID and Date populated.
+func (r *postgresExchangeRepo) Exchange(ctx context.Context, exchange *domain.Exchange, since time.Time, dailyLimit int) (*domain.Exchange, error) {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var coinsBalance int
+	if err := tx.QueryRowContext(ctx, `SELECT leal_coins FROM customer WHERE id = $1 FOR UPDATE`, exchange.CustomerID).Scan(&coinsBalance); err != nil {
+		return nil, err
+	}
+	if dailyLimit > 0 {
+		coinsToday, err := (&postgresExchangeRepo{db: tx}).GetExchangedCoinsSince(ctx, exchange.CustomerID, exchange.BrandID, since)
+		if err != nil {
+			return nil, err
+		}
+		if coinsToday+exchange.Coins > dailyLimit {
+			return nil, domain.ErrExchangeLimit
+		}
+	}
+
+	coinsDelta, pointsDelta := -exchange.Coins, exchange.Points
+	if exchange.Direction == domain.ExchangePointsToCoins {
+		coinsDelta, pointsDelta = exchange.Coins, -exchange.Points
+	}
+
+	if coinsDelta < 0 {
+		if coinsBalance < -coinsDelta {
+			return nil, domain.ErrInsufficientCoins
+		}
+	} else {
+		var balance int
+		err := tx.QueryRowContext(ctx, `SELECT points FROM leal_points WHERE customer_id = $1 AND brand_id = $2 FOR UPDATE`,
+			exchange.CustomerID, exchange.BrandID).Scan(&balance)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if balance < -pointsDelta {
+			return nil, domain.ErrInsufficientPoints
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE customer SET leal_coins = leal_coins + $1 WHERE id = $2`, coinsDelta, exchange.CustomerID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO leal_points (customer_id, brand_id, points)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (customer_id, brand_id)
+		DO UPDATE SET points = leal_points.points + $3`,
+		exchange.CustomerID, exchange.BrandID, pointsDelta); err != nil {
+		return nil, err
+	}
+
+	reason := "exchange " + exchange.Direction
+	if _, err := tx.ExecContext(ctx, `INSERT INTO leal_coins_transactions (customer_id, change, reason) VALUES ($1, $2, $3)`,
+		exchange.CustomerID, coinsDelta, reason); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO leal_points_transactions (customer_id, brand_id, change, reason) VALUES ($1, $2, $3, $4)`,
+		exchange.CustomerID, exchange.BrandID, pointsDelta, reason); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO exchange (customer_id, brand_id, direction, coins, points, rate) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, date`
+	row := tx.QueryRowContext(ctx, query, exchange.CustomerID, exchange.BrandID, exchange.Direction, exchange.Coins, exchange.Points, exchange.Rate)
+	if err := row.Scan(&exchange.ID, &exchange.Date); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
+
+// GetExchangedCoinsSince returns the coins the customer has exchanged with the brand, in
+// either direction, since the given time. Exchange uses it to enforce the daily exchange
+// limit.
+func (r *postgresExchangeRepo) GetExchangedCoinsSince(ctx context.Context, customerID int, brandID int, since time.Time) (int, error) {
+	query := `SELECT COALESCE(SUM(coins), 0) FROM exchange WHERE customer_id = $1 AND brand_id = $2 AND date >= $3`
+	var coins int
+	if err := r.db.QueryRowContext(ctx, query, customerID, brandID, since).Scan(&coins); err != nil {
+		return 0, err
+	}
+	return coins, nil
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type postgresHouseholdRepo struct {
+	db DBTX
+}
+
+func NewPostgresHouseholdRepo(db DBTX) domain.HouseholdRepository {
+	return &postgresHouseholdRepo{db: db}
+}
+
+// CreateHousehold creates a household owned by the given customer and adds the owner as its
+// first member, in a single transaction. The contribution percent is the default share of
+// earned points new members put into the pool. It returns the household with its ID and
+// CreatedDate populated.
+func (r *postgresHouseholdRepo) CreateHousehold(ctx context.Context, name string, ownerID int, contributionPercent int) (*domain.Household, error) {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h := domain.Household{Name: name, OwnerID: ownerID, ContributionPercent: contributionPercent}
+	query := `INSERT INTO household (household_name, owner_id, contribution_percent) VALUES ($1, $2, $3) RETURNING id, created_date`
+	if err := tx.QueryRowContext(ctx, query, name, ownerID, contributionPercent).Scan(&h.ID, &h.CreatedDate); err != nil {
+		return nil, err
+	}
+
+	memberQuery := `INSERT INTO household_member (household_id, customer_id, contribution_percent) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, memberQuery, h.ID, ownerID, contributionPercent); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// GetHouseholdByID retrieves a household by ID, without its members or points.
+// It returns nil if the household does not exist.
+func (r *postgresHouseholdRepo) GetHouseholdByID(ctx context.Context, id int) (*domain.Household, error) {
+	query := `SELECT id, household_name, owner_id, contribution_percent, created_date FROM household WHERE id = $1`
+	var h domain.Household
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(&h.ID, &h.Name, &h.OwnerID, &h.ContributionPercent, &h.CreatedDate); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+// GetMember retrieves the household membership of a customer.
+// It returns nil if the customer does not belong to any household.
+func (r *postgresHouseholdRepo) GetMember(ctx context.Context, customerID int) (*domain.HouseholdMember, error) {
+	query := `SELECT household_id, customer_id, contribution_percent, joined_date FROM household_member WHERE customer_id = $1`
+	var m domain.HouseholdMember
+	if err := r.db.QueryRowContext(ctx, query, customerID).Scan(&m.HouseholdID, &m.CustomerID, &m.ContributionPercent, &m.JoinedDate); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetMembers retrieves every member of a household, oldest first.
+func (r *postgresHouseholdRepo) GetMembers(ctx context.Context, householdID int) ([]domain.HouseholdMember, error) {
+	query := `SELECT household_id, customer_id, contribution_percent, joined_date FROM household_member WHERE household_id = $1 ORDER BY joined_date`
+	rows, err := r.db.QueryContext(ctx, query, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []domain.HouseholdMember
+	for rows.Next() {
+		var m domain.HouseholdMember
+		if err := rows.Scan(&m.HouseholdID, &m.CustomerID, &m.ContributionPercent, &m.JoinedDate); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// AddMember adds a customer to a household. A customer can only belong to one household,
+// so adding a customer that is already a member of any household fails.
+func (r *postgresHouseholdRepo) AddMember(ctx context.Context, householdID int, customerID int, contributionPercent int) error {
+	query := `INSERT INTO household_member (household_id, customer_id, contribution_percent) VALUES ($1, $2, $3)`
+	_, err := r.db.ExecContext(ctx, query, householdID, customerID, contributionPercent)
+	return err
+}
+
+// RemoveMember removes a customer from a household. The household pool is kept.
+func (r *postgresHouseholdRepo) RemoveMember(ctx context.Context, householdID int, customerID int) error {
+	query := `DELETE FROM household_member WHERE household_id = $1 AND customer_id = $2`
+	_, err := r.db.ExecContext(ctx, query, householdID, customerID)
+	return err
+}
+
+// UpdateMemberContribution changes the share of earned points a member puts into the pool.
+func (r *postgresHouseholdRepo) UpdateMemberContribution(ctx context.Context, householdID int, customerID int, contributionPercent int) error {
+	query := `UPDATE household_member SET contribution_percent = $1 WHERE household_id = $2 AND customer_id = $3`
+	_, err := r.db.ExecContext(ctx, query, contributionPercent, householdID, customerID)
+	return err
+}
+
+// CreateInvitation records a pending invitation for a customer to join a household.
+func (r *postgresHouseholdRepo) CreateInvitation(ctx context.Context, householdID int, customerID int) (*domain.HouseholdInvitation, error) {
+	query := `INSERT INTO household_invitation (household_id, customer_id, status) VALUES ($1, $2, 'pending') RETURNING id, status, created_date`
+	inv := domain.HouseholdInvitation{HouseholdID: householdID, CustomerID: customerID}
+	if err := r.db.QueryRowContext(ctx, query, householdID, customerID).Scan(&inv.ID, &inv.Status, &inv.CreatedDate); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetInvitationByID retrieves an invitation by ID. It returns nil if it does not exist.
+func (r *postgresHouseholdRepo) GetInvitationByID(ctx context.Context, id int) (*domain.HouseholdInvitation, error) {
+	query := `SELECT id, household_id, customer_id, status, created_date FROM household_invitation WHERE id = $1`
+	var inv domain.HouseholdInvitation
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(&inv.ID, &inv.HouseholdID, &inv.CustomerID, &inv.Status, &inv.CreatedDate); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetPendingInvitationsByCustomerID retrieves the invitations a customer has not answered yet.
+func (r *postgresHouseholdRepo) GetPendingInvitationsByCustomerID(ctx context.Context, customerID int) ([]domain.HouseholdInvitation, error) {
+	query := `SELECT id, household_id, customer_id, status, created_date FROM household_invitation
+		WHERE customer_id = $1 AND status = 'pending' ORDER BY created_date DESC`
+	rows, err := r.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []domain.HouseholdInvitation
+	for rows.Next() {
+		var inv domain.HouseholdInvitation
+		if err := rows.Scan(&inv.ID, &inv.HouseholdID, &inv.CustomerID, &inv.Status, &inv.CreatedDate); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, nil
+}
+
+// UpdateInvitationStatus sets the status of an invitation.
+func (r *postgresHouseholdRepo) UpdateInvitationStatus(ctx context.Context, id int, status string) error {
+	query := `UPDATE household_invitation SET status = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, status, id)
+	return err
+}
+
+// GetPoints retrieves the pooled points balance of a household for every brand.
+func (r *postgresHouseholdRepo) GetPoints(ctx context.Context, householdID int) ([]domain.HouseholdPoints, error) {
+	query := `SELECT household_id, brand_id, points FROM household_points WHERE household_id = $1`
+	rows, err := r.db.QueryContext(ctx, query, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []domain.HouseholdPoints
+	for rows.Next() {
+		var p domain.HouseholdPoints
+		if err := rows.Scan(&p.HouseholdID, &p.BrandID, &p.Points); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// UpdatePoints changes the pooled points balance of a household for a brand by the given delta.
+// Positive deltas create the balance if needed. Negative deltas only apply when the pool has
+// enough points; otherwise an error is returned and the balance is left unchanged.
+func (r *postgresHouseholdRepo) UpdatePoints(ctx context.Context, householdID int, brandID int, delta int) error {
+	if delta >= 0 {
+		query := `
+			INSERT INTO household_points (household_id, brand_id, points)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (household_id, brand_id)
+			DO UPDATE SET points = household_points.points + $3`
+		_, err := r.db.ExecContext(ctx, query, householdID, brandID, delta)
+		return err
+	}
+
+	query := `UPDATE household_points SET points = points + $3 WHERE household_id = $1 AND brand_id = $2 AND points + $3 >= 0`
+	res, err := r.db.ExecContext(ctx, query, householdID, brandID, delta)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrInsufficientHouseholdPoints
+	}
+	return nil
+}
+
+// RecordPointsTransaction records a movement of the household pool in its ledger,
+// along with the member that caused it.
+func (r *postgresHouseholdRepo) RecordPointsTransaction(ctx context.Context, transaction *domain.HouseholdPointsTransaction) error {
+	query := `INSERT INTO household_points_transactions (household_id, customer_id, brand_id, change, reason) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.ExecContext(ctx, query, transaction.HouseholdID, transaction.CustomerID, transaction.BrandID, transaction.Change, transaction.Reason)
+	return err
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/tracing"
+)
+
+type postgresOutboxRepo struct {
+	db DBTX
+}
+
+func NewPostgresOutboxRepo(db DBTX) domain.OutboxRepository {
+	return &postgresOutboxRepo{db: db}
+}
+
+// AddEvent stores an event to be sent to topic, with the trace context of ctx, so the
+// trace continues when the relay sends it.
+func (r *postgresOutboxRepo) AddEvent(ctx context.Context, topic string, event domain.Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	keys, err := json.Marshal(event.Keys)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	tracing.Inject(ctx, headers)
+	traceHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO event_outbox (topic, event_type, correlation_id, keys, payload, trace_headers)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = r.db.ExecContext(ctx, query, topic, event.Type, event.CorrelationID, keys, payload, traceHeaders)
+	return err
+}
+
+// GetPendingEvents returns up to limit events, oldest first, locking them until the end of
+// the transaction. Relays of other instances wait for the lock instead of skipping the
+// events, so the events are sent in the order they were stored.
+//
+// An event that cannot be decoded, such as one of a type this version does not know, is
+// dead-lettered with its error instead of failing the batch: it is no longer returned, and
+// the events after it are.
+func (r *postgresOutboxRepo) GetPendingEvents(ctx context.Context, limit int) ([]domain.OutboxEvent, error) {
+	query := `SELECT id, topic, event_type, correlation_id, keys, payload, trace_headers
+		FROM event_outbox WHERE dead_lettered_date IS NULL ORDER BY id LIMIT $1 FOR UPDATE`
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		pending     []domain.OutboxEvent
+		undecodable []domain.OutboxEvent
+		decodeErrs  []error
+	)
+	for rows.Next() {
+		var (
+			e                           domain.OutboxEvent
+			keys, payload, traceHeaders []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Topic, &e.Event.Type, &e.Event.CorrelationID, &keys, &payload, &traceHeaders); err != nil {
+			return nil, err
+		}
+		if err := decodeOutboxEvent(&e, keys, payload, traceHeaders); err != nil {
+			undecodable = append(undecodable, e)
+			decodeErrs = append(decodeErrs, err)
+			continue
+		}
+		pending = append(pending, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i, e := range undecodable {
+		slog.ErrorContext(ctx, "Dead-lettering outbox event", "id", e.ID, "topic", e.Topic, "event_type", e.Event.Type, "error", decodeErrs[i])
+		query := `UPDATE event_outbox SET attempts = attempts + 1, last_error = $2, dead_lettered_date = CURRENT_TIMESTAMP WHERE id = $1`
+		if _, err := r.db.ExecContext(ctx, query, e.ID, decodeErrs[i].Error()); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// RecordFailure counts a failed attempt to send an event, keeping its error. The event stays
+// pending.
+func (r *postgresOutboxRepo) RecordFailure(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE event_outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`, id, reason)
+	return err
+}
+
+// DeleteEvent removes a sent event from the outbox.
+func (r *postgresOutboxRepo) DeleteEvent(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM event_outbox WHERE id = $1`, id)
+	return err
+}
+
+// decodeOutboxEvent decodes the stored keys, payload and trace headers of an event into e.
+func decodeOutboxEvent(e *domain.OutboxEvent, keys, payload, traceHeaders []byte) error {
+	if err := json.Unmarshal(keys, &e.Event.Keys); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(traceHeaders, &e.TraceHeaders); err != nil {
+		return err
+	}
+	var err error
+	e.Event.Payload, err = outboxPayload(e.Event.Type, payload)
+	return err
+}
+
+// outboxPayload decodes the stored payload of an event into the domain type the producer
+// maps to its contract.
+func outboxPayload(eventType string, data []byte) (any, error) {
+	switch eventType {
+	case domain.EventPurchaseCreated:
+		var purchase domain.Purchase
+		err := json.Unmarshal(data, &purchase)
+		return purchase, err
+	case domain.EventExchangeCompleted:
+		var exchange domain.Exchange
+		err := json.Unmarshal(data, &exchange)
+		return exchange, err
+	}
+	return nil, fmt.Errorf("unknown outbox event type %q", eventType)
+}
@@ -0,0 +1,76 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/db"
+)
+
+// TestOutboxDeadLettersUndecodableEvents stores an event of an unknown type between two
+// purchase events. The outbox dead-letters it with its error and keeps returning the events
+// around it, and a failed attempt to send an event is counted without dead-lettering it.
+func TestOutboxDeadLettersUndecodableEvents(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+
+	insert := func(eventType, payload string) int64 {
+		t.Helper()
+		var id int64
+		query := `INSERT INTO event_outbox (topic, event_type, payload) VALUES ('purchase-topic', $1, $2) RETURNING id`
+		if err := conn.QueryRow(query, eventType, payload).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	before := insert(domain.EventPurchaseCreated, `{"ID": 1}`)
+	unknown := insert("unknown_event", `{}`)
+	after := insert(domain.EventPurchaseCreated, `{"ID": 2}`)
+
+	err := db.NewPostgresUnitOfWork(conn).Do(ctx, func(repos domain.Repositories) error {
+		pending, err := repos.Outbox.GetPendingEvents(ctx, 10000)
+		if err != nil {
+			return err
+		}
+		found := map[int64]bool{}
+		for _, e := range pending {
+			found[e.ID] = true
+		}
+		if !found[before] || !found[after] || found[unknown] {
+			t.Errorf("pending events %v, want %d and %d without %d", found, before, after, unknown)
+		}
+		return repos.Outbox.RecordFailure(ctx, before, "broker unavailable")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[int64]struct {
+		attempts int
+		dead     bool
+	}{
+		before:  {attempts: 1},
+		unknown: {attempts: 1, dead: true},
+		after:   {attempts: 0},
+	}
+	for id, want := range tests {
+		var (
+			attempts  int
+			lastError sql.NullString
+			dead      bool
+		)
+		query := `SELECT attempts, last_error, dead_lettered_date IS NOT NULL FROM event_outbox WHERE id = $1`
+		if err := conn.QueryRow(query, id).Scan(&attempts, &lastError, &dead); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != want.attempts || dead != want.dead || lastError.Valid != (want.attempts > 0) {
+			t.Errorf("event %d: %d attempts, last error %q, dead lettered %t, want %d attempts, dead lettered %t",
+				id, attempts, lastError.String, dead, want.attempts, want.dead)
+		}
+	}
+	if _, err := conn.Exec(`DELETE FROM event_outbox WHERE id IN ($1, $2, $3)`, before, unknown, after); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,17 +1,17 @@
 package db
 
 import (
-	"database/sql"
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
 type postgresPointsRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresPointsRepo(db *sql.DB) domain.PointsRepository {
+func NewPostgresPointsRepo(db DBTX) domain.PointsRepository {
 	return &postgresPointsRepo{db: db}
 }
 
@@ -19,9 +19,9 @@ func NewPostgresPointsRepo(db *sql.DB) domain.PointsRepository {
 // It returns a slice of LealPoints entities, each containing the customer ID, brand ID, and points.
 // If the query encounters an error, it returns the error. If no points are found, it returns an empty slice.
 
-func (r *postgresPointsRepo) GetPointsByCustomerID(customer_id int) ([]domain.LealPoints, error) {
+func (r *postgresPointsRepo) GetPointsByCustomerID(ctx context.Context, customer_id int) ([]domain.LealPoints, error) {
 	query := `SELECT  customer_id, brand_id, points FROM leal_points WHERE customer_id = $1`
-	rows, err := r.db.Query(query, customer_id)
+	rows, err := r.db.QueryContext(ctx, query, customer_id)
 	if err != nil {
 		return nil, err
 	}
@@ -40,53 +40,73 @@ func (r *postgresPointsRepo) GetPointsByCustomerID(customer_id int) ([]domain.Le
 }
 
 // UpdatePoints updates the points balance for a given customer ID and brand ID by the given delta.
-// The delta can be positive or negative. If the resulting points balance would be negative, it is
-// set to 0. If there is no current points balance for the customer ID and brand ID, it creates
-// one. The update is done in a single atomic operation. If the operation encounters an error,
-// it returns the error.
-func (r *postgresPointsRepo) UpdatePoints(customerID int, brandID int, delta int) error {
-	query := `
-		INSERT INTO leal_points (customer_id, brand_id, points)
-		VALUES ($1, $2, GREATEST($3, 0))
-		ON CONFLICT (customer_id, brand_id)
-		DO UPDATE
-		SET points = GREATEST(leal_points.points + $3, 0)
-	`
-	_, err := r.db.Exec(query, customerID, brandID, delta)
-	return err
+// Positive deltas create the balance if there is none yet. Negative deltas are applied with a
+// conditional update that only matches when the balance covers them; the update locks the row,
+// so concurrent debits are serialized and cannot overdraw it. When the balance is not enough,
+// an error is returned and the balance is left unchanged.
+func (r *postgresPointsRepo) UpdatePoints(ctx context.Context, customerID int, brandID int, delta int) error {
+	if delta >= 0 {
+		query := `
+			INSERT INTO leal_points (customer_id, brand_id, points)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (customer_id, brand_id)
+			DO UPDATE SET points = leal_points.points + $3`
+		_, err := r.db.ExecContext(ctx, query, customerID, brandID, delta)
+		return err
+	}
+
+	query := `UPDATE leal_points SET points = points + $3 WHERE customer_id = $1 AND brand_id = $2 AND points + $3 >= 0`
+	res, err := r.db.ExecContext(ctx, query, customerID, brandID, delta)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrInsufficientPoints
+	}
+	return nil
 }
 
 // RecordPointsTransaction records a points transaction in the leal_points_transactions table.
 // It logs the transaction for debugging purposes and returns an error if the operation fails.
-func (r *postgresPointsRepo) RecordPointsTransaction(transaction *domain.LealPointsTransaction) error {
-	log.Println("Db received transaction: ", transaction)
+func (r *postgresPointsRepo) RecordPointsTransaction(ctx context.Context, transaction *domain.LealPointsTransaction) error {
+	slog.DebugContext(ctx, "Recording points transaction", "customer_id", transaction.CustomerID, "brand_id", transaction.BrandID, "change", transaction.Change, "reason", transaction.Reason)
 	query := `INSERT INTO leal_points_transactions (customer_id, brand_id, change, reason) VALUES ($1, $2, $3, $4)`
-	_, err := r.db.Query(query, transaction.CustomerID, transaction.BrandID, transaction.Change, transaction.Reason)
+	_, err := r.db.ExecContext(ctx, query, transaction.CustomerID, transaction.BrandID, transaction.Change, transaction.Reason)
 	return err
 }
 
-// RecordCoins updates the coin balance for a given customer by adding the specified number of coins.
-// It logs the transaction details for debugging purposes. The function returns an error if the update
-// operation fails.
-
-func (r *postgresPointsRepo) RecordCoins(customerID int, coins int) error {
-	log.Println("Db received coins: ", coins, " for customer: ", customerID)
-	query := `UPDATE customer SET coins = coins + $1 WHERE id = $2`
-	_, err := r.db.Query(query, coins, customerID)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 // GetPoinysByCustomerIDAndBrandID retrieves the points balance for a given customer ID and brand ID.
 // If the query encounters an error, it returns the error. If no points are found, it returns nil.
-func (r *postgresPointsRepo) GetPoinysByCustomerIDAndBrandID(customerID int, brandID int) (*domain.LealPoints, error) {
+func (r *postgresPointsRepo) GetPoinysByCustomerIDAndBrandID(ctx context.Context, customerID int, brandID int) (*domain.LealPoints, error) {
 	query := `SELECT brand_id, points FROM leal_points WHERE customer_id = $1 AND brand_id = $2`
-	row := r.db.QueryRow(query, customerID, brandID)
+	row := r.db.QueryRowContext(ctx, query, customerID, brandID)
 	var points domain.LealPoints
 	if err := row.Scan(&points.BrandID, &points.Points); err != nil {
 		return nil, err
 	}
 	return &points, nil
 }
+
+// GetPointsTransactionsByCustomerID retrieves the points ledger of a customer, newest first.
+func (r *postgresPointsRepo) GetPointsTransactionsByCustomerID(ctx context.Context, customerID int) ([]domain.LealPointsTransaction, error) {
+	query := `SELECT id, customer_id, brand_id, change, reason, date FROM leal_points_transactions WHERE customer_id = $1 ORDER BY date DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []domain.LealPointsTransaction
+	for rows.Next() {
+		var t domain.LealPointsTransaction
+		if err := rows.Scan(&t.ID, &t.CustomerID, &t.BrandID, &t.Change, &t.Reason, &t.Date); err != nil {
+			return nil, err
+		}
+		results = append(results, t)
+	}
+	return results, nil
+}
@@ -1,29 +1,103 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
+const purchaseColumns = `id, customer_id, amount, purchase_date, brand_id, branch_id, coins_used, status,
+	COALESCE(rejection_reason, ''), points_earned, coins_earned, reward_breakdown, credited_date`
+
 type postgresPurchasesRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresPurchasesRepo(db *sql.DB) domain.PurchasesRepository {
+func NewPostgresPurchasesRepo(db DBTX) domain.PurchasesRepository {
 	return &postgresPurchasesRepo{db: db}
 }
 
 // RecordPurchase records a purchase in the database, returning the purchase with the ID and PurchaseDate populated
 // or an error if something went wrong
-func (r *postgresPurchasesRepo) RecordPurchase(purchase *domain.Purchase) (*domain.Purchase, error) {
-	query := `INSERT INTO purchase (customer_id, amount, brand_id, branch_id, coins_used) VALUES ($1, $2, $3 , $4, $5) RETURNING id, purchase_date`
+func (r *postgresPurchasesRepo) RecordPurchase(ctx context.Context, purchase *domain.Purchase) (*domain.Purchase, error) {
+	query := `INSERT INTO purchase (customer_id, amount, brand_id, branch_id, coins_used) VALUES ($1, $2, $3 , $4, $5) RETURNING id, purchase_date, status`
 
-	row := r.db.QueryRow(query, purchase.CustomerID, purchase.Amount, purchase.BrandID, purchase.BranchID, purchase.CoinsUsed)
+	row := r.db.QueryRowContext(ctx, query, purchase.CustomerID, purchase.Amount, purchase.BrandID, purchase.BranchID, purchase.CoinsUsed)
 
-	if err := row.Scan(&purchase.ID, &purchase.PurchaseDate); err != nil {
+	if err := row.Scan(&purchase.ID, &purchase.PurchaseDate, &purchase.Status); err != nil {
 		return nil, err
 	}
 	return purchase, nil
 
 }
+
+// RejectPurchase marks a pending purchase as rejected for the given reason and returns it,
+// or nil if there is no pending purchase with that ID, so a purchase is only rejected once.
+func (r *postgresPurchasesRepo) RejectPurchase(ctx context.Context, purchaseID int, reason string) (*domain.Purchase, error) {
+	query := `UPDATE purchase SET status = $1, rejection_reason = $2 WHERE id = $3 AND status = $4
+		RETURNING ` + purchaseColumns
+	return scanPurchase(r.db.QueryRowContext(ctx, query, domain.PurchaseRejected, reason, purchaseID, domain.PurchasePending))
+}
+
+// CreditPurchase marks a pending purchase as credited with the points and coins it earned
+// and what each campaign issued towards them, and returns it, or nil if there is no
+// pending purchase with that ID, so a purchase is only credited once.
+func (r *postgresPurchasesRepo) CreditPurchase(ctx context.Context, purchaseID int, points int, coins int, breakdown []domain.RewardBreakdown) (*domain.Purchase, error) {
+	if breakdown == nil {
+		breakdown = []domain.RewardBreakdown{}
+	}
+	data, err := json.Marshal(breakdown)
+	if err != nil {
+		return nil, err
+	}
+	query := `UPDATE purchase SET status = $1, points_earned = $2, coins_earned = $3, reward_breakdown = $4,
+		credited_date = CURRENT_TIMESTAMP WHERE id = $5 AND status = $6
+		RETURNING ` + purchaseColumns
+	return scanPurchase(r.db.QueryRowContext(ctx, query, domain.PurchaseCredited, points, coins, data, purchaseID, domain.PurchasePending))
+}
+
+// GetPurchaseByID returns a purchase by its ID, or nil if there is none.
+func (r *postgresPurchasesRepo) GetPurchaseByID(ctx context.Context, purchaseID int) (*domain.Purchase, error) {
+	query := `SELECT ` + purchaseColumns + ` FROM purchase WHERE id = $1`
+	return scanPurchase(r.db.QueryRowContext(ctx, query, purchaseID))
+}
+
+// GetPurchasesByCustomerID returns the purchases of a customer, newest first.
+func (r *postgresPurchasesRepo) GetPurchasesByCustomerID(ctx context.Context, customerID int) ([]domain.Purchase, error) {
+	query := `SELECT ` + purchaseColumns + ` FROM purchase WHERE customer_id = $1 ORDER BY purchase_date DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var purchases []domain.Purchase
+	for rows.Next() {
+		p, err := scanPurchase(rows)
+		if err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, *p)
+	}
+	return purchases, rows.Err()
+}
+
+// scanPurchase reads a purchase selected with purchaseColumns, returning nil if there is
+// no row.
+func scanPurchase(row interface{ Scan(dest ...any) error }) (*domain.Purchase, error) {
+	var p domain.Purchase
+	var breakdown []byte
+	err := row.Scan(&p.ID, &p.CustomerID, &p.Amount, &p.PurchaseDate, &p.BrandID, &p.BranchID, &p.CoinsUsed, &p.Status,
+		&p.RejectionReason, &p.PointsEarned, &p.CoinsEarned, &breakdown, &p.CreditedDate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(breakdown, &p.Breakdown); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
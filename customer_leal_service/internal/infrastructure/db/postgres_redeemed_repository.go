@@ -1,16 +1,15 @@
 package db
 
 import (
-	"database/sql"
-
+	"context"
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 )
 
 type postgresRedeemedRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresRedeemedRepo(db *sql.DB) domain.RedeemedRepository {
+func NewPostgresRedeemedRepo(db DBTX) domain.RedeemedRepository {
 	return &postgresRedeemedRepo{db: db}
 }
 
@@ -19,10 +18,10 @@ func NewPostgresRedeemedRepo(db *sql.DB) domain.RedeemedRepository {
 // It will record the operation in the database and return the
 // Redeemed struct with the ID and Date fields populated. If any error
 // occurs, it will return that error.
-func (r *postgresRedeemedRepo) RedeemReward(redeemed *domain.Redeemed) (*domain.Redeemed, error) {
-	query := `INSERT INTO redeemed (customer_id, brand_id, reward_id, points_spend) VALUES ($1, $2 , $3, $4) RETURNING id , date`
+func (r *postgresRedeemedRepo) RedeemReward(ctx context.Context, redeemed *domain.Redeemed) (*domain.Redeemed, error) {
+	query := `INSERT INTO redeemed (customer_id, brand_id, reward_id, points_spend, household_id) VALUES ($1, $2 , $3, $4, NULLIF($5, 0)) RETURNING id , date`
 
-	row := r.db.QueryRow(query, redeemed.CustomerID, redeemed.BrandID, redeemed.RewardID, redeemed.PointsSpend)
+	row := r.db.QueryRowContext(ctx, query, redeemed.CustomerID, redeemed.BrandID, redeemed.RewardID, redeemed.PointsSpend, redeemed.HouseholdID)
 
 	if err := row.Scan(&redeemed.ID, &redeemed.Date); err != nil {
 		return nil, err
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type postgresReferralRepo struct {
+	db DBTX
+}
+
+func NewPostgresReferralRepo(db DBTX) domain.ReferralRepository {
+	return &postgresReferralRepo{db: db}
+}
+
+// CreateReferral records that the referee signed up using the referrer's code.
+// The referral starts in "pending" status until the referee makes a qualifying purchase.
+// A customer can only be referred once, so a second referral for the same referee fails.
+func (r *postgresReferralRepo) CreateReferral(ctx context.Context, referrerID int, refereeID int) (*domain.Referral, error) {
+	query := `INSERT INTO referral (referrer_id, referee_id, status) VALUES ($1, $2, 'pending') RETURNING id, status, created_date`
+	row := r.db.QueryRowContext(ctx, query, referrerID, refereeID)
+	ref := domain.Referral{ReferrerID: referrerID, RefereeID: refereeID}
+	if err := row.Scan(&ref.ID, &ref.Status, &ref.CreatedDate); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// GetReferralsByReferrerID retrieves every referral made with the given customer's code,
+// newest first. If the customer has not referred anyone, it returns an empty slice.
+func (r *postgresReferralRepo) GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]domain.Referral, error) {
+	query := `SELECT id, referrer_id, referee_id, status, COALESCE(purchase_id, 0), created_date, COALESCE(rewarded_date, created_date)
+		FROM referral WHERE referrer_id = $1 ORDER BY created_date DESC`
+	rows, err := r.db.QueryContext(ctx, query, referrerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var referrals []domain.Referral
+	for rows.Next() {
+		var ref domain.Referral
+		if err := rows.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.Status, &ref.PurchaseID, &ref.CreatedDate, &ref.RewardedDate); err != nil {
+			return nil, err
+		}
+		referrals = append(referrals, ref)
+	}
+	return referrals, nil
+}
+
+// MarkReferralRewarded moves the pending referral of the given referee to "rewarded",
+// linking it to the qualifying purchase. The status check is part of the update, so
+// only one caller can win the transition. It returns nil if there is no pending referral.
+func (r *postgresReferralRepo) MarkReferralRewarded(ctx context.Context, refereeID int, purchaseID int) (*domain.Referral, error) {
+	query := `UPDATE referral SET status = 'rewarded', purchase_id = $2, rewarded_date = CURRENT_TIMESTAMP
+		WHERE referee_id = $1 AND status = 'pending'
+		RETURNING id, referrer_id, referee_id, status, purchase_id, created_date, rewarded_date`
+	row := r.db.QueryRowContext(ctx, query, refereeID, purchaseID)
+	var ref domain.Referral
+	if err := row.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.Status, &ref.PurchaseID, &ref.CreatedDate, &ref.RewardedDate); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ref, nil
+}
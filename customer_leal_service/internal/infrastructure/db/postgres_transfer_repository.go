@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+type postgresTransferRepo struct {
+	db DBTX
+}
+
+func NewPostgresTransferRepo(db DBTX) domain.TransferRepository {
+	return &postgresTransferRepo{db: db}
+}
+
+// TransferBalance moves points of a brand, or coins, from the sender to the recipient
+// in a single database transaction.
+//
+// The customer rows of the sender and the recipient are locked with SELECT ... FOR UPDATE
+// first, so the transfers of a sender run one at a time: the points of the brand and the
+// coins transferred since the given time are summed under the lock and checked against
+// pointsLimit and coinsLimit, and the balance is checked before the move, so concurrent
+// transfers can neither exceed the daily limits nor overdraw the balance. The rows are
+// locked in the order of their IDs, and so are the leal_points rows of both customers, so
+// transfers in opposite directions between the same customers wait for each other instead
+// of deadlocking. The debit and credit are recorded as a pair of
+// ledger entries (leal_points_transactions for points, leal_coins_transactions for coins)
+// and the transfer itself is stored in the transfer table. If any step fails, nothing is
+// written. It returns the transfer with its ID and Date populated.
+func (r *postgresTransferRepo) TransferBalance(ctx context.Context, transfer *domain.Transfer, since time.Time, pointsLimit int, coinsLimit int) (*domain.Transfer, error) {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	coins, err := lockBalances(ctx, tx, `SELECT id, leal_coins FROM customer WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`,
+		transfer.SenderID, transfer.RecipientID)
+	if err != nil {
+		return nil, err
+	}
+	coinsBalance, senderFound := coins[transfer.SenderID]
+	if _, recipientFound := coins[transfer.RecipientID]; !senderFound || !recipientFound {
+		return nil, domain.ErrCustomerNotFound
+	}
+	pointsToday, coinsToday, err := (&postgresTransferRepo{db: tx}).GetTransferredSince(ctx, transfer.SenderID, transfer.BrandID, since)
+	if err != nil {
+		return nil, err
+	}
+	if pointsToday+transfer.Points > pointsLimit {
+		return nil, domain.ErrTransferLimitPoints
+	}
+	if coinsToday+transfer.Coins > coinsLimit {
+		return nil, domain.ErrTransferLimitCoins
+	}
+
+	if transfer.Points > 0 {
+		points, err := lockBalances(ctx, tx, `
+			SELECT customer_id, points FROM leal_points
+			WHERE customer_id IN ($1, $2) AND brand_id = $3
+			ORDER BY customer_id FOR UPDATE`,
+			transfer.SenderID, transfer.RecipientID, transfer.BrandID)
+		if err != nil {
+			return nil, err
+		}
+		if points[transfer.SenderID] < transfer.Points {
+			return nil, domain.ErrInsufficientPoints
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE leal_points SET points = points - $1 WHERE customer_id = $2 AND brand_id = $3`,
+			transfer.Points, transfer.SenderID, transfer.BrandID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO leal_points (customer_id, brand_id, points)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (customer_id, brand_id)
+			DO UPDATE SET points = leal_points.points + $3`,
+			transfer.RecipientID, transfer.BrandID, transfer.Points); err != nil {
+			return nil, err
+		}
+
+		ledger := `INSERT INTO leal_points_transactions (customer_id, brand_id, change, reason) VALUES ($1, $2, $3, $4)`
+		if _, err := tx.ExecContext(ctx, ledger, transfer.SenderID, transfer.BrandID, -transfer.Points, "transfer sent"); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, ledger, transfer.RecipientID, transfer.BrandID, transfer.Points, "transfer received"); err != nil {
+			return nil, err
+		}
+	}
+
+	if transfer.Coins > 0 {
+		if coinsBalance < transfer.Coins {
+			return nil, domain.ErrInsufficientCoins
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE customer SET leal_coins = leal_coins - $1 WHERE id = $2`, transfer.Coins, transfer.SenderID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE customer SET leal_coins = leal_coins + $1 WHERE id = $2`, transfer.Coins, transfer.RecipientID); err != nil {
+			return nil, err
+		}
+
+		ledger := `INSERT INTO leal_coins_transactions (customer_id, change, reason) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(ctx, ledger, transfer.SenderID, -transfer.Coins, "transfer sent"); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, ledger, transfer.RecipientID, transfer.Coins, "transfer received"); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `INSERT INTO transfer (sender_id, recipient_id, brand_id, points, coins) VALUES ($1, $2, $3, $4, $5) RETURNING id, date`
+	row := tx.QueryRowContext(ctx, query, transfer.SenderID, transfer.RecipientID, transfer.BrandID, transfer.Points, transfer.Coins)
+	if err := row.Scan(&transfer.ID, &transfer.Date); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// lockBalances runs a query that locks the balance rows of customers and returns each
+// balance by the ID of its customer. A customer without a row has no entry.
+func lockBalances(ctx context.Context, tx DBTX, query string, args ...any) (map[int]int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[int]int)
+	for rows.Next() {
+		var customerID, balance int
+		if err := rows.Scan(&customerID, &balance); err != nil {
+			return nil, err
+		}
+		balances[customerID] = balance
+	}
+	return balances, rows.Err()
+}
+
+// GetTransferredSince returns the points of the given brand and the coins the sender has
+// transferred since the given time. TransferBalance uses it to enforce the daily transfer
+// limits.
+func (r *postgresTransferRepo) GetTransferredSince(ctx context.Context, senderID int, brandID int, since time.Time) (int, int, error) {
+	query := `SELECT
+			COALESCE(SUM(points) FILTER (WHERE brand_id = $2), 0),
+			COALESCE(SUM(coins), 0)
+		FROM transfer WHERE sender_id = $1 AND date >= $3`
+	var points, coins int
+	if err := r.db.QueryRowContext(ctx, query, senderID, brandID, since).Scan(&points, &coins); err != nil {
+		return 0, 0, err
+	}
+	return points, coins, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+)
+
+// DBTX is the part of *sql.DB and *sql.Tx used by the repositories, so the same
+// repository can run on the connection pool or inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type postgresUnitOfWork struct {
+	db *sql.DB
+}
+
+func NewPostgresUnitOfWork(db *sql.DB) domain.UnitOfWork {
+	return &postgresUnitOfWork{db: db}
+}
+
+// Do begins a transaction, hands fn the repositories bound to it, and commits when fn
+// returns nil. If fn returns an error or panics, the transaction is rolled back and
+// nothing fn wrote is kept.
+func (u *postgresUnitOfWork) Do(ctx context.Context, fn func(repos domain.Repositories) error) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	repos := domain.Repositories{
+		Customers:     NewPostgresCustomerRepo(tx),
+		Points:        NewPostgresPointsRepo(tx),
+		Coins:         NewPostgresCoinsRepo(tx),
+		Purchases:     NewPostgresPurchasesRepo(tx),
+		Redeemed:      NewPostgresRedeemedRepo(tx),
+		Referrals:     NewPostgresReferralRepo(tx),
+		Transfers:     NewPostgresTransferRepo(tx),
+		BrandSettings: NewPostgresBrandSettingsRepo(tx),
+		Households:    NewPostgresHouseholdRepo(tx),
+		Exchanges:     NewPostgresExchangeRepo(tx),
+		Outbox:        NewPostgresOutboxRepo(tx),
+	}
+	if err := fn(repos); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// txScope is the transaction used by a repository method that writes several rows.
+// When the repository already runs inside a unit of work, the method joins that
+// transaction and leaves commit and rollback to the unit of work.
+type txScope struct {
+	DBTX
+	tx *sql.Tx
+}
+
+// begin starts a transaction on db, or joins it when db already is a transaction.
+func begin(ctx context.Context, db DBTX) (*txScope, error) {
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return &txScope{DBTX: db}, nil
+	}
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txScope{DBTX: tx, tx: tx}, nil
+}
+
+func (t *txScope) Commit() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Commit()
+}
+
+func (t *txScope) Rollback() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Rollback()
+}
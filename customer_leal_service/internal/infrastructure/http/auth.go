@@ -0,0 +1,77 @@
+package http
+
+import (
+	"crypto/subtle"
+	"strconv"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	customerIDHeader    = "Leal-Customer-Id"
+	customerTokenHeader = "Leal-Customer-Token"
+	serviceNameHeader   = "Leal-Service-Name"
+	serviceTokenHeader  = "Leal-Service-Token"
+
+	// principalKey is the key of the authenticated caller in the context of a request.
+	principalKey = "principal"
+)
+
+// AuthMiddleware authenticates the caller of the routes it guards and stores it in the
+// context as the principal of the request, so that handlers read it with principal.
+//
+// Customers send their ID and token in the Leal-Customer-Id and Leal-Customer-Token headers.
+// Other services send their name and token in Leal-Service-Name and Leal-Service-Token,
+// checked against serviceTokens, and the customer they act for in Leal-Customer-Id.
+// Requests without valid credentials are answered with a 401 Unauthorized problem.
+func AuthMiddleware(customers domain.CustomerService, serviceTokens map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := authenticate(c, customers, serviceTokens)
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// authenticate returns the principal of the credentials of the request.
+func authenticate(c *gin.Context, customers domain.CustomerService, serviceTokens map[string]string) (*domain.Principal, error) {
+	customerIDStr := c.GetHeader(customerIDHeader)
+	service := c.GetHeader(serviceNameHeader)
+	if service != "" {
+		token, ok := serviceTokens[service]
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.GetHeader(serviceTokenHeader))) != 1 {
+			return nil, domain.ErrInvalidServiceCredentials
+		}
+		customerID, err := strconv.Atoi(customerIDStr)
+		if err != nil {
+			return nil, domain.ErrMissingAuthentication
+		}
+		if _, err := customers.GetCustomerByID(c.Request.Context(), customerID); err != nil {
+			return nil, err
+		}
+		return &domain.Principal{Kind: domain.PrincipalService, ID: customerID, Service: service}, nil
+	}
+
+	tokenReq := c.GetHeader(customerTokenHeader)
+	if customerIDStr == "" || tokenReq == "" {
+		return nil, domain.ErrMissingAuthentication
+	}
+	customerID, err := strconv.Atoi(customerIDStr)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+	if err := customers.ValidateToken(c.Request.Context(), customerID, tokenReq); err != nil {
+		return nil, err
+	}
+	return &domain.Principal{Kind: domain.PrincipalCustomer, ID: customerID}, nil
+}
+
+// principal returns the caller authenticated by AuthMiddleware.
+func principal(c *gin.Context) *domain.Principal {
+	return c.MustGet(principalKey).(*domain.Principal)
+}
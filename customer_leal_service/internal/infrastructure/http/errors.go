@@ -0,0 +1,86 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the code of an error to build the type of its problem.
+const problemTypePrefix = "urn:leal:problem:"
+
+// statusByKind is the HTTP status of each kind of domain error.
+var statusByKind = map[domain.Kind]int{
+	domain.KindNotFound:            http.StatusNotFound,
+	domain.KindConflict:            http.StatusConflict,
+	domain.KindValidation:          http.StatusBadRequest,
+	domain.KindUnauthorized:        http.StatusUnauthorized,
+	domain.KindForbidden:           http.StatusForbidden,
+	domain.KindInsufficientBalance: http.StatusUnprocessableEntity,
+}
+
+// Problem is the body of every error response, a problem details object (RFC 7807). Code
+// is stable and is the last part of Type; Detail describes the error for people. Errors
+// lists the invalid fields of an invalid request.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// ErrorMiddleware writes the error that a handler added to the context with c.Error, if the
+// handler did not write a response, as a problem. Domain errors get the status of their kind
+// and their code; any other error is logged and answered with 500 Internal Server Error
+// without its message. It runs right before the handlers, so that the middlewares around it
+// see the status of the response, and again after the middlewares of a group of routes.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		abortWithProblem(c, newProblem(c, c.Errors.Last().Err))
+	}
+}
+
+// newProblem builds the problem of err for the request being served.
+func newProblem(c *gin.Context, err error) Problem {
+	status, code, detail := http.StatusInternalServerError, "internal_error", "internal server error"
+	if e := domain.AsError(err); e != nil && statusByKind[e.Kind] != 0 {
+		status, code, detail = statusByKind[e.Kind], e.Code, e.Message
+	} else {
+		slog.ErrorContext(c.Request.Context(), "Error serving request", "path", c.Request.URL.Path, "error", err)
+	}
+	return Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+		Code:     code,
+	}
+}
+
+// abortWithProblem writes p as the response and stops the chain.
+func abortWithProblem(c *gin.Context, p Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// invalidRequest wraps an error binding the request as a validation error.
+func invalidRequest(err error) error {
+	return domain.Validation(domain.ErrInvalidRequest.Code, err.Error())
+}
+
+// invalidField is the validation error of a field of the request that cannot be parsed.
+func invalidField(field string) error {
+	return domain.Validation(domain.ErrInvalidRequest.Code, "invalid "+field)
+}
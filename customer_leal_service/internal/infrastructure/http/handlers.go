@@ -1,25 +1,31 @@
 package http
 
 import (
-	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/degarzonm/customer_leal_service/internal/domain"
 	"github.com/degarzonm/customer_leal_service/internal/infrastructure/util"
 	"github.com/gin-gonic/gin"
 )
 
+// Handler serves the routes of the customer service. Errors are added to the context with
+// c.Error and written as problems by ErrorMiddleware.
 type Handler struct {
-	customerService domain.CustomerService
-	pointsService   domain.PointService
-	coinService     domain.CoinService
-	purchaseService domain.PurchaseService
-	redeemService   domain.RedeemService
+	customerService  domain.CustomerService
+	pointsService    domain.PointService
+	coinService      domain.CoinService
+	purchaseService  domain.PurchaseService
+	redeemService    domain.RedeemService
+	referralService  domain.ReferralService
+	transferService  domain.TransferService
+	householdService domain.HouseholdService
+	exchangeService  domain.ExchangeService
 }
 
-func NewHandler(cs domain.CustomerService, ps domain.PointService, ccs domain.CoinService, pcs domain.PurchaseService, rs domain.RedeemService) *Handler {
-	return &Handler{customerService: cs, pointsService: ps, coinService: ccs, purchaseService: pcs, redeemService: rs}
+func NewHandler(cs domain.CustomerService, ps domain.PointService, ccs domain.CoinService, pcs domain.PurchaseService, rs domain.RedeemService, rfs domain.ReferralService, ts domain.TransferService, hs domain.HouseholdService, es domain.ExchangeService) *Handler {
+	return &Handler{customerService: cs, pointsService: ps, coinService: ccs, purchaseService: pcs, redeemService: rs, referralService: rfs, transferService: ts, householdService: hs, exchangeService: es}
 }
 
 func (h *Handler) Ping(c *gin.Context) {
@@ -28,42 +34,44 @@ func (h *Handler) Ping(c *gin.Context) {
 
 // NewCustomer handles the request to register a new customer. The customer's
 // name, email, phone and password should be sent in the request body in JSON
-// format. The response will contain the customer's ID and a token which can be
-// used to authenticate the customer in future requests. If the request is
-// invalid, the response will contain an error message. If the customer service
-// fails to create the customer, the response will contain an error message with
-// status code 500.
+// format, along with an optional referral_code of the customer who invited them.
+// The response will contain the customer's ID, a token which can be used to
+// authenticate the customer in future requests and the customer's own referral code. If the request is
+// invalid, the response will contain an error with status code 400. If the email or phone
+// is already registered, the status code is 409.
 func (h *Handler) NewCustomer(c *gin.Context) {
 	var req NewCustomerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
-	customer, err := h.customerService.CreateCustomer(req.CustomerName, req.Email, req.Phone, req.Pass)
+	req.ReferralCode = strings.ToUpper(util.Sanitize(req.ReferralCode))
+	customer, err := h.customerService.CreateCustomer(c.Request.Context(), req.CustomerName, req.Email, req.Phone, req.Pass, req.ReferralCode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"customer_id": customer.ID, "token": customer.Token})
+	c.JSON(http.StatusOK, gin.H{"customer_id": customer.ID, "token": customer.Token, "referral_code": customer.ReferralCode})
 }
 
 // LoginCustomer authenticates a customer using their email and password.
 // The request should contain a JSON object with customer_email and pass fields.
 // If authentication is successful, it responds with the customer's ID and token.
 // If the request is malformed, it responds with a 400 status code and an error message.
-// If authentication fails, it responds with a 403 status code and an error message.
+// If authentication fails, it responds with a 401 status code and an error message.
 
 func (h *Handler) LoginCustomer(c *gin.Context) {
 	var req LoginCustomerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 	req.CustomerEmail = util.Sanitize(req.CustomerEmail)
-	b, err := h.customerService.LoginCustomer(req.CustomerEmail, req.Pass)
+	b, err := h.customerService.LoginCustomer(c.Request.Context(), req.CustomerEmail, req.Pass)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"customer_id": b.ID, "token": b.Token})
@@ -71,20 +79,16 @@ func (h *Handler) LoginCustomer(c *gin.Context) {
 
 // GetCustomerPoints retrieves the loyalty points for an authorized customer.
 // The customer ID is extracted from the request headers after authorization.
-// If the authorization fails, a 500 status code and an error message are returned.
+// If the authorization fails, a 401 status code and an error message are returned.
 // On success, it returns the points in a JSON response with a 200 status code.
 // If any error occurs while fetching the points, a 500 status code and an error message are returned.
 
 func (h *Handler) GetCustomerPoints(c *gin.Context) {
-	customerID, err := h.authorizeCustomer(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	customerID := principal(c).ID
 
-	points, err := h.pointsService.GetCustomerPoints(customerID)
+	points, err := h.pointsService.GetCustomerPoints(c.Request.Context(), customerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"points": points})
@@ -92,19 +96,15 @@ func (h *Handler) GetCustomerPoints(c *gin.Context) {
 
 // GetCustomerCoins retrieves the coins for an authorized customer.
 // The customer ID is extracted from the request headers after authorization.
-// If the authorization fails, a 500 status code and an error message are returned.
+// If the authorization fails, a 401 status code and an error message are returned.
 // On success, it returns the coins in a JSON response with a 200 status code.
 // If any error occurs while fetching the coins, a 500 status code and an error message are returned.
 func (h *Handler) GetCustomerCoins(c *gin.Context) {
-	customerID, err := h.authorizeCustomer(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	customerID := principal(c).ID
 
-	coins, err := h.coinService.GetCustomerCoins(customerID)
+	coins, err := h.coinService.GetCustomerCoins(c.Request.Context(), customerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"coins": coins})
@@ -114,23 +114,19 @@ func (h *Handler) GetCustomerCoins(c *gin.Context) {
 // Redeem exchanges points for a reward.
 // The request should contain a JSON object with brand_id, reward_id and points_spend fields.
 // If the request is malformed, it responds with a 400 status code and an error message.
-// If the authorization fails, a 500 status code and an error message are returned.
+// If the authorization fails, a 401 status code and an error message are returned.
 // On success, it returns the redeem ID in a JSON response with a 200 status code.
 // If any error occurs while redeeming the points, a 500 status code and an error message are returned.
 func (h *Handler) Redeem(c *gin.Context) {
-	customerID, err := h.authorizeCustomer(c)
-	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-		return
-	}
+	customerID := principal(c).ID
 
 	var req RedeemRewardRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
-	redeem, err := h.redeemService.RedeemReward(
+	redeem, err := h.redeemService.RedeemReward(c.Request.Context(),
 		&domain.Redeemed{
 			CustomerID:  customerID,
 			BrandID:     req.BrandID,
@@ -139,70 +135,341 @@ func (h *Handler) Redeem(c *gin.Context) {
 		})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"redeem_id": redeem.ID})
+	c.JSON(http.StatusOK, gin.H{"redeem_id": redeem.ID, "household_id": redeem.HouseholdID})
 
 }
 
 // Purchase processes a purchase of a customer.
 // The request should contain a JSON object with amount, brand_id, branch_id and coins_used fields.
 // If the request is malformed, it responds with a 400 status code and an error message.
-// If the authorization fails, a 500 status code and an error message are returned.
+// If the authorization fails, a 401 status code and an error message are returned.
 // On success, it returns the purchase ID in a JSON response with a 200 status code.
 // If any error occurs while processing the purchase, a 500 status code and an error message are returned.
 func (h *Handler) Purchase(c *gin.Context) {
-	customerID, err := h.authorizeCustomer(c)
-	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-		return
-	}
+	customerID := principal(c).ID
 
 	var req PurchaseRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
 
-	purchase, err := h.purchaseService.ProcessPurchase(&domain.Purchase{CustomerID: customerID,
+	purchase, err := h.purchaseService.ProcessPurchase(c.Request.Context(), &domain.Purchase{CustomerID: customerID,
 		Amount:    req.Amount,
 		BrandID:   req.BrandID,
 		BranchID:  req.BranchID,
 		CoinsUsed: req.CoinsUsed})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"purchase_id": purchase.ID})
 }
 
-// authorizeCustomer validates the customer based on headers in the gin.Context.
-// It requires "Leal-Customer-Id" and "Leal-Customer-Token" headers to be present.
-// Returns the customer ID if successful, otherwise returns an error if headers are missing,
-// if the customer ID is invalid, or if token validation fails.
+// GetPurchase returns a purchase of the authorized customer by the ID in the path, with its
+// status and, once credited, the points and coins it earned and what each campaign issued.
+// If the ID is not a number, it responds with a 400 status code and an error message.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the customer has no purchase with that ID, a 404 status code and an error message are returned.
+func (h *Handler) GetPurchase(c *gin.Context) {
+	customerID := principal(c).ID
+
+	purchaseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidField("id"))
+		return
+	}
+	purchase, err := h.purchaseService.GetPurchase(c.Request.Context(), customerID, purchaseID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, purchaseResponse(purchase))
+}
+
+// MyPurchases returns the purchases of the authorized customer, newest first, with the
+// points and coins each of them earned.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If any error occurs while fetching the purchases, a 500 status code and an error message are returned.
+func (h *Handler) MyPurchases(c *gin.Context) {
+	customerID := principal(c).ID
+
+	purchases, err := h.purchaseService.GetPurchases(c.Request.Context(), customerID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	resp := make([]gin.H, len(purchases))
+	for i := range purchases {
+		resp[i] = purchaseResponse(&purchases[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"purchases": resp})
+}
+
+// TransferPoints gives points of a brand, or coins, to another customer.
+// The request should contain a JSON object with recipient_email or recipient_phone, and either
+// brand_id and points, or coins.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// On success, it returns the transfer ID in a JSON response with a 200 status code.
+// If the transfer is rejected, a 4xx status code for the reason is returned, such as 422 when
+// the balance is not enough; if it fails, a 500 status code and an error message are returned.
+func (h *Handler) TransferPoints(c *gin.Context) {
+	customerID := principal(c).ID
+
+	var req TransferPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	req.RecipientEmail = util.Sanitize(req.RecipientEmail)
+	req.RecipientPhone = util.Sanitize(req.RecipientPhone)
+
+	transfer, err := h.transferService.TransferBalance(c.Request.Context(),
+		&domain.Transfer{
+			SenderID: customerID,
+			BrandID:  req.BrandID,
+			Points:   req.Points,
+			Coins:    req.Coins,
+		}, req.RecipientEmail, req.RecipientPhone)
+
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transfer_id": transfer.ID})
+}
+
+// Exchange converts coins into points of a brand, or points of a brand into coins,
+// at the rate set by the brand.
+// The request should contain a JSON object with brand_id, direction (coins_to_points or
+// points_to_coins) and amount, the quantity of coins or points given.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// On success, it returns the exchange ID with the coins and points moved in a JSON response.
+// If the exchange is rejected, a 4xx status code for the reason is returned, such as 422 when
+// the balance is not enough; if it fails, a 500 status code and an error message are returned.
+func (h *Handler) Exchange(c *gin.Context) {
+	customerID := principal(c).ID
+
+	var req ExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	exchange, err := h.exchangeService.Exchange(c.Request.Context(), customerID, req.BrandID, req.Direction, req.Amount)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exchange_id": exchange.ID, "coins": exchange.Coins, "points": exchange.Points, "rate": exchange.Rate})
+}
+
+// MyLedger returns the points and coins ledgers of the authorized customer, newest first.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If any error occurs while fetching the ledgers, a 500 status code and an error message are returned.
+func (h *Handler) MyLedger(c *gin.Context) {
+	customerID := principal(c).ID
+
+	points, err := h.pointsService.GetPointsHistory(c.Request.Context(), customerID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	coins, err := h.coinService.GetCoinsHistory(c.Request.Context(), customerID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"points": points, "coins": coins})
+}
+
+// NewHousehold creates a household owned by the authorized customer.
+// The request should contain a JSON object with household_name and an optional
+// contribution_percent (default 100), the share of earned points members put into the pool.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// On success, it returns the household ID in a JSON response with a 200 status code.
+// If the household cannot be created, a 500 status code and an error message are returned.
+func (h *Handler) NewHousehold(c *gin.Context) {
+	customerID := principal(c).ID
+
+	var req NewHouseholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	contribution := 100
+	if req.ContributionPercent != nil {
+		contribution = *req.ContributionPercent
+	}
+
+	household, err := h.householdService.CreateHousehold(c.Request.Context(), customerID, util.Sanitize(req.HouseholdName), contribution)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"household_id": household.ID})
+}
+
+// MyHousehold returns the household of the authorized customer, with its members and pooled points.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the household cannot be retrieved, a 500 status code and an error message are returned.
+func (h *Handler) MyHousehold(c *gin.Context) {
+	customerID := principal(c).ID
+
+	household, err := h.householdService.GetHousehold(c.Request.Context(), customerID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"household": household})
+}
+
+// InviteHouseholdMember invites another customer, identified by email or phone, to the
+// household owned by the authorized customer.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// On success, it returns the invitation ID in a JSON response with a 200 status code.
+// If the invitation cannot be created, a 500 status code and an error message are returned.
+func (h *Handler) InviteHouseholdMember(c *gin.Context) {
+	customerID := principal(c).ID
+
+	var req HouseholdInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	invitation, err := h.householdService.InviteMember(c.Request.Context(), customerID, util.Sanitize(req.Email), util.Sanitize(req.Phone))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitation_id": invitation.ID})
+}
+
+// MyHouseholdInvitations returns the pending household invitations of the authorized customer.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the invitations cannot be retrieved, a 500 status code and an error message are returned.
+func (h *Handler) MyHouseholdInvitations(c *gin.Context) {
+	customerID := principal(c).ID
+
+	invitations, err := h.householdService.GetInvitations(c.Request.Context(), customerID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// AcceptHouseholdInvitation makes the authorized customer join the household of an invitation.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// On success, it returns the household ID in a JSON response with a 200 status code.
+// If the invitation cannot be accepted, a 500 status code and an error message are returned.
+func (h *Handler) AcceptHouseholdInvitation(c *gin.Context) {
+	customerID := principal(c).ID
 
-func (h *Handler) authorizeCustomer(c *gin.Context) (int, error) {
-	customerIDStr := c.GetHeader("Leal-Customer-Id")
-	if customerIDStr == "" {
-		return 0, errors.New("customer_id header required")
+	var req AcceptHouseholdInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
 	}
 
-	customerID, err := strconv.Atoi(customerIDStr)
+	household, err := h.householdService.AcceptInvitation(c.Request.Context(), customerID, req.InvitationID)
 	if err != nil {
-		return 0, errors.New("invalid customer_id")
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"household_id": household.ID})
+}
+
+// RemoveHouseholdMember removes a member from the authorized customer's household.
+// The owner can remove other members, and members can remove themselves.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// If the member cannot be removed, a 500 status code and an error message are returned.
+func (h *Handler) RemoveHouseholdMember(c *gin.Context) {
+	customerID := principal(c).ID
+
+	var req RemoveHouseholdMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	if err := h.householdService.RemoveMember(c.Request.Context(), customerID, req.CustomerID); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"customer_id": req.CustomerID})
+}
+
+// HouseholdContribution changes the share of earned points a member of the authorized
+// owner's household puts into the pool.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If the request is malformed, it responds with a 400 status code and an error message.
+// If the contribution cannot be changed, a 500 status code and an error message are returned.
+func (h *Handler) HouseholdContribution(c *gin.Context) {
+	customerID := principal(c).ID
+
+	var req HouseholdContributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+
+	if err := h.householdService.SetContribution(c.Request.Context(), customerID, req.CustomerID, req.ContributionPercent); err != nil {
+		c.Error(err)
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"customer_id": req.CustomerID, "contribution_percent": req.ContributionPercent})
+}
+
+// MyReferrals returns the authorized customer's referral code and the referrals made with it.
+// If the authorization fails, a 401 status code and an error message are returned.
+// If any error occurs while fetching the referrals, a 500 status code and an error message are returned.
+func (h *Handler) MyReferrals(c *gin.Context) {
+	customerID := principal(c).ID
 
-	tokenReq := c.GetHeader("Leal-Customer-Token")
-	if tokenReq == "" {
-		return 0, errors.New("token header required")
+	customer, err := h.customerService.GetCustomerByID(c.Request.Context(), customerID)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	err = h.customerService.ValidateToken(customerID, tokenReq)
+	referrals, err := h.referralService.GetReferrals(c.Request.Context(), customerID)
 	if err != nil {
-		return 0, err
+		c.Error(err)
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"referral_code": customer.ReferralCode, "referrals": referrals})
+}
 
-	return customerID, nil
+// purchaseResponse builds the JSON body of a purchase returned by the purchase endpoints.
+func purchaseResponse(p *domain.Purchase) gin.H {
+	breakdown := make([]gin.H, len(p.Breakdown))
+	for i, b := range p.Breakdown {
+		breakdown[i] = gin.H{"campaign_id": b.CampaignID, "campaign_name": b.CampaignName, "points": b.Points, "coins": b.Coins}
+	}
+	return gin.H{
+		"purchase_id":      p.ID,
+		"brand_id":         p.BrandID,
+		"branch_id":        p.BranchID,
+		"amount":           p.Amount,
+		"coins_used":       p.CoinsUsed,
+		"purchase_date":    p.PurchaseDate,
+		"status":           p.Status,
+		"rejection_reason": p.RejectionReason,
+		"points_earned":    p.PointsEarned,
+		"coins_earned":     p.CoinsEarned,
+		"breakdown":        breakdown,
+		"credited_date":    p.CreditedDate,
+	}
 }
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthCheck checks a dependency of the service. Check returns details about the
+// dependency to include in the readiness response, or an error when it is not usable.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) (map[string]any, error)
+}
+
+// HealthHandler serves the liveness and readiness endpoints.
+type HealthHandler struct {
+	checks  []HealthCheck
+	timeout time.Duration
+}
+
+// NewHealthHandler creates a handler that runs the given checks for readiness, giving
+// each of them at most timeout to answer.
+func NewHealthHandler(timeout time.Duration, checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: timeout}
+}
+
+type checkResult struct {
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	DurationMs int64          `json:"duration_ms"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+// Liveness reports that the process is running and serving requests. It does not check
+// any dependency, so a dependency outage does not get the service restarted.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness runs every check concurrently and reports the status of each dependency.
+// It returns 200 when all of them are ok, and 503 when any fails or times out.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	results := make(map[string]checkResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := h.run(c.Request.Context(), check)
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// run runs a check with the handler timeout. Checks that do not honor the context are
+// reported as timed out once it expires.
+func (h *HealthHandler) run(ctx context.Context, check HealthCheck) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]any
+		err     error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		details, err := check.Check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var result checkResult
+	select {
+	case o := <-done:
+		result.Details = o.details
+		if o.err != nil {
+			result.Status, result.Error = "error", o.err.Error()
+		} else {
+			result.Status = "ok"
+		}
+	case <-ctx.Done():
+		result.Status, result.Error = "error", "timed out after "+h.timeout.String()
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result
+}
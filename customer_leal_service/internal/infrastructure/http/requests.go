@@ -5,6 +5,7 @@ type NewCustomerRequest struct {
 	Email        string `json:"email"`
 	Phone        string `json:"phone"`
 	Pass         string `json:"pass"`
+	ReferralCode string `json:"referral_code"`
 }
 
 type LoginCustomerRequest struct {
@@ -26,3 +27,40 @@ type RedeemRewardRequest struct {
 	RewardID    int `json:"reward_id"`
 	PointsSpend int `json:"points_spend"`
 }
+
+type TransferPointsRequest struct {
+	RecipientEmail string `json:"recipient_email"`
+	RecipientPhone string `json:"recipient_phone"`
+	BrandID        int    `json:"brand_id"`
+	Points         int    `json:"points"`
+	Coins          int    `json:"coins"`
+}
+
+type NewHouseholdRequest struct {
+	HouseholdName       string `json:"household_name"`
+	ContributionPercent *int   `json:"contribution_percent"`
+}
+
+type HouseholdInviteRequest struct {
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+type AcceptHouseholdInvitationRequest struct {
+	InvitationID int `json:"invitation_id"`
+}
+
+type RemoveHouseholdMemberRequest struct {
+	CustomerID int `json:"customer_id"`
+}
+
+type HouseholdContributionRequest struct {
+	CustomerID          int `json:"customer_id"`
+	ContributionPercent int `json:"contribution_percent"`
+}
+
+type ExchangeRequest struct {
+	BrandID   int    `json:"brand_id"`
+	Direction string `json:"direction"`
+	Amount    int    `json:"amount"`
+}
@@ -1,24 +1,57 @@
 package http
 
 import (
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/metrics"
 	"github.com/gin-gonic/gin"
 )
 
 // NewRouter returns a new gin Engine with all the routes needed for the
-// customer service.
-func NewRouter(h *Handler) *gin.Engine {
-	r := gin.Default()
+// customer service, plus the liveness, readiness, metrics and OpenAPI document
+// routes. The given middlewares run before every route, followed by the
+// error middleware. The routes of a customer are grouped behind auth, which
+// authenticates the caller, and idempotency, which replays retried requests
+// of that caller; registration, login and the operational routes are public.
+// Panics are recovered, but requests are not logged by gin, so that the
+// logging middleware writes them as structured records.
+func NewRouter(h *Handler, health *HealthHandler, auth gin.HandlerFunc, idempotency gin.HandlerFunc, middlewares ...gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(middlewares...)
+	r.Use(ErrorMiddleware())
 
-	// Health check endpoint
+	// Health check endpoints
 	r.GET("/ping", h.Ping)
+	r.GET("/healthz", health.Liveness)
+	r.GET("/readyz", health.Readiness)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.GET("/openapi.json", OpenAPI)
+
+	// Public customer endpoints
+	public := r.Group("/")
+	public.POST("/new-customer", h.NewCustomer)
+	public.POST("/login-customer", h.LoginCustomer)
 
 	// Customer endpoints
-	r.POST("/new-customer", h.NewCustomer)
-	r.POST("/login-customer", h.LoginCustomer)
-	r.GET("/my-points/", h.GetCustomerPoints)
-	r.GET("/my-coins/", h.GetCustomerCoins)
-	r.POST("/redeem", h.Redeem)
-	r.POST("/purchase", h.Purchase)
+	customer := r.Group("/", auth, idempotency, ErrorMiddleware())
+	customer.GET("/my-points/", h.GetCustomerPoints)
+	customer.GET("/my-coins/", h.GetCustomerCoins)
+	customer.POST("/redeem", h.Redeem)
+	customer.POST("/purchase", h.Purchase)
+	customer.GET("/purchases/:id", h.GetPurchase)
+	customer.GET("/my-purchases", h.MyPurchases)
+	customer.GET("/my-referrals", h.MyReferrals)
+	customer.POST("/transfer-points", h.TransferPoints)
+	customer.POST("/exchange", h.Exchange)
+	customer.GET("/my-ledger", h.MyLedger)
+
+	// Household endpoints
+	customer.POST("/new-household", h.NewHousehold)
+	customer.GET("/my-household", h.MyHousehold)
+	customer.POST("/household-invite", h.InviteHouseholdMember)
+	customer.GET("/my-household-invitations", h.MyHouseholdInvitations)
+	customer.POST("/accept-household-invitation", h.AcceptHouseholdInvitation)
+	customer.POST("/remove-household-member", h.RemoveHouseholdMember)
+	customer.POST("/household-contribution", h.HouseholdContribution)
 
 	return r
 }
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	purchasesRecorded = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purchases_recorded_total",
+		Help:      "Purchases recorded by customers, by brand.",
+	}, []string{"brand_id"})
+
+	coinsSpent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coins_spent_total",
+		Help:      "Leal coins spent on purchases, by brand.",
+	}, []string{"brand_id"})
+
+	redemptions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redemptions_total",
+		Help:      "Rewards redeemed, by brand and source of the points (customer or household).",
+	}, []string{"brand_id", "source"})
+
+	pointsRedeemed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_redeemed_total",
+		Help:      "Points spent on rewards, by brand and source of the points (customer or household).",
+	}, []string{"brand_id", "source"})
+)
+
+type prometheusBusinessMetrics struct{}
+
+func NewPrometheusBusinessMetrics() domain.BusinessMetrics {
+	return &prometheusBusinessMetrics{}
+}
+
+func (m *prometheusBusinessMetrics) PurchaseRecorded(brandID int, coinsUsed int) {
+	brand := strconv.Itoa(brandID)
+	purchasesRecorded.WithLabelValues(brand).Inc()
+	if coinsUsed > 0 {
+		coinsSpent.WithLabelValues(brand).Add(float64(coinsUsed))
+	}
+}
+
+func (m *prometheusBusinessMetrics) RewardRedeemed(brandID int, points int, fromHousehold bool) {
+	brand, source := strconv.Itoa(brandID), "customer"
+	if fromHousehold {
+		source = "household"
+	}
+	redemptions.WithLabelValues(brand, source).Inc()
+	pointsRedeemed.WithLabelValues(brand, source).Add(float64(points))
+}
@@ -0,0 +1,91 @@
+package msgBroker
+
+import (
+	"fmt"
+
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/leal_contracts/events"
+)
+
+// toContract maps the domain payload of an event to its contract in the shared
+// contracts module, which defines how it is serialized.
+func toContract(event domain.Event) (any, error) {
+	switch payload := event.Payload.(type) {
+	case domain.Purchase:
+		return events.PurchaseCreated{
+			PurchaseID:   payload.ID,
+			CustomerID:   payload.CustomerID,
+			BrandID:      payload.BrandID,
+			BranchID:     payload.BranchID,
+			Amount:       payload.Amount,
+			CoinsUsed:    payload.CoinsUsed,
+			PurchaseDate: payload.PurchaseDate,
+		}, nil
+	case domain.Exchange:
+		return events.ExchangeCompleted{
+			ExchangeID:  payload.ID,
+			CustomerID:  payload.CustomerID,
+			BrandID:     payload.BrandID,
+			Direction:   payload.Direction,
+			Coins:       payload.Coins,
+			Points:      payload.Points,
+			ExchangedAt: payload.Date,
+		}, nil
+	}
+	return nil, fmt.Errorf("no contract for %s payload %T", event.Type, event.Payload)
+}
+
+// decodePointsApply reads an apply points event of any supported version.
+func decodePointsApply(body []byte) (domain.LealPointsApply, *events.Envelope, error) {
+	var data events.PointsApply
+	env, err := events.Decode(events.TypePointsApply, body, &data)
+	if err != nil {
+		return domain.LealPointsApply{}, nil, err
+	}
+	breakdown := make([]domain.RewardBreakdown, len(data.Breakdown))
+	for i, b := range data.Breakdown {
+		breakdown[i] = domain.RewardBreakdown{CampaignID: b.CampaignID, CampaignName: b.CampaignName, Points: b.Points, Coins: b.Coins}
+	}
+	return domain.LealPointsApply{
+		PurchaseID: data.PurchaseID,
+		CustomerID: data.CustomerID,
+		BrandID:    data.BrandID,
+		Points:     data.Points,
+		Coins:      data.Coins,
+		Reason:     data.Reason,
+		Breakdown:  breakdown,
+	}, env, nil
+}
+
+// decodePurchaseRejected reads a purchase rejected event of any supported version.
+func decodePurchaseRejected(body []byte) (domain.PurchaseRejection, *events.Envelope, error) {
+	var data events.PurchaseRejected
+	env, err := events.Decode(events.TypePurchaseRejected, body, &data)
+	if err != nil {
+		return domain.PurchaseRejection{}, nil, err
+	}
+	return domain.PurchaseRejection{
+		PurchaseID: data.PurchaseID,
+		CustomerID: data.CustomerID,
+		BrandID:    data.BrandID,
+		BranchID:   data.BranchID,
+		CoinsUsed:  data.CoinsUsed,
+		Reason:     data.Reason,
+	}, env, nil
+}
+
+// decodeBrandSettings reads a brand settings updated event of any supported version.
+func decodeBrandSettings(body []byte) (domain.BrandSettings, *events.Envelope, error) {
+	var data events.BrandSettingsUpdated
+	env, err := events.Decode(events.TypeBrandSettingsUpdated, body, &data)
+	if err != nil {
+		return domain.BrandSettings{}, nil, err
+	}
+	return domain.BrandSettings{
+		BrandID:             data.BrandID,
+		AllowPointsTransfer: data.AllowPointsTransfer,
+		CoinsToPointsRate:   data.CoinsToPointsRate,
+		PointsToCoinsRate:   data.PointsToCoinsRate,
+		ExchangeDailyLimit:  data.ExchangeDailyLimit,
+	}, env, nil
+}
@@ -0,0 +1,64 @@
+package msgBroker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/degarzonm/customer_leal_service/internal/application"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/logging"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/metrics"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/tracing"
+)
+
+// eventHandler passes the consumed messages to the application layer, whatever broker
+// they come from.
+type eventHandler struct {
+	appService *application.AppService
+}
+
+// handle routes a message by its event type and processes it with the given context, in a
+// span that continues the trace of the producer. Errors are logged and counted in the
+// consumed events metric, and the message is dropped.
+func (h *eventHandler) handle(ctx context.Context, msg *message) {
+	meta := msg.metadata()
+	ctx = logging.WithCorrelationID(ctx, meta.CorrelationID)
+	slog.InfoContext(ctx, "Processing event", "event_type", meta.Type, "topic", msg.Topic)
+
+	ctx, span := tracing.StartConsumer(ctx, msg.Topic, meta.Type, msg.Headers)
+	err := h.process(ctx, meta, msg)
+	tracing.End(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error processing event", "event_type", meta.Type, "topic", msg.Topic, "error", err)
+	}
+	metrics.EventConsumed(msg.Topic, meta.Type, err)
+}
+
+// process handles a message of a known event type. Apply points, purchase rejected and
+// brand settings events are decoded with the shared contracts, which upcasts older
+// versions to the current one, and passed to the application layer. Events of a version
+// newer than the contracts know fail to decode.
+func (h *eventHandler) process(ctx context.Context, meta domain.EventMetadata, msg *message) error {
+	switch meta.Type {
+	case domain.EventPointsApply:
+		points, _, err := decodePointsApply(msg.Value)
+		if err != nil {
+			return fmt.Errorf("decoding apply points: %w", err)
+		}
+		return h.appService.ProcessApplyPointsEvent(ctx, points)
+	case domain.EventPurchaseRejected:
+		rejection, _, err := decodePurchaseRejected(msg.Value)
+		if err != nil {
+			return fmt.Errorf("decoding purchase rejected: %w", err)
+		}
+		return h.appService.ProcessPurchaseRejectedEvent(ctx, rejection)
+	case domain.EventBrandSettingsUpdated:
+		settings, _, err := decodeBrandSettings(msg.Value)
+		if err != nil {
+			return fmt.Errorf("decoding brand settings: %w", err)
+		}
+		return h.appService.ProcessBrandSettingsEvent(ctx, settings)
+	}
+	return fmt.Errorf("unhandled event type %q", meta.Type)
+}
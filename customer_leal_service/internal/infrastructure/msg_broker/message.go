@@ -0,0 +1,100 @@
+package msgBroker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/tracing"
+	"github.com/degarzonm/leal_contracts/events"
+)
+
+// Headers set on every message.
+const (
+	headerEventType     = "event-type"
+	headerSchemaVersion = "schema-version"
+	headerCorrelationID = "correlation-id"
+	headerProducedAt    = "produced-at"
+)
+
+// message is an event as carried by any of the brokers: the encoded envelope, its
+// partition key and its headers.
+type message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// newMessage maps the payload of the event to its contract and wraps it in a versioned
+// envelope of the shared contracts module. The message is keyed by the partition key of
+// the topic (see partitionKey) and carries the event type, schema version, correlation ID
+// and production time as headers, along with the trace context of ctx.
+func newMessage(ctx context.Context, topic string, event domain.Event) (*message, error) {
+	payload, err := toContract(event)
+	if err != nil {
+		return nil, err
+	}
+	value, err := events.Encode(event.Type, event.CorrelationID, payload)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{
+		Topic: topic,
+		Key:   partitionKey(topic, event),
+		Value: value,
+		Headers: map[string]string{
+			headerEventType:     event.Type,
+			headerSchemaVersion: strconv.Itoa(events.CurrentVersion(event.Type)),
+			headerCorrelationID: event.CorrelationID,
+			headerProducedAt:    time.Now().UTC().Format(time.RFC3339Nano),
+		},
+	}
+	tracing.Inject(ctx, m.Headers)
+	return m, nil
+}
+
+// partitionKey returns the value of the key field configured for the topic, customer_id by
+// default. Events without that field are keyed by their brand ID, and events with neither
+// are sent without a key.
+func partitionKey(topic string, event domain.Event) string {
+	cfg := config.GetConfig()
+	field := cfg.MsgKeyFields[topic]
+	if field == "" {
+		field = domain.KeyCustomerID
+	}
+	if key := event.Keys[field]; key != "" {
+		return key
+	}
+	return event.Keys[domain.KeyBrandID]
+}
+
+// metadata reads the event headers of the message. Messages produced before the headers
+// existed have no type, so they are identified by their topic.
+func (m *message) metadata() domain.EventMetadata {
+	meta := domain.EventMetadata{
+		Type:          m.Headers[headerEventType],
+		SchemaVersion: m.Headers[headerSchemaVersion],
+		CorrelationID: m.Headers[headerCorrelationID],
+	}
+	meta.ProducedAt, _ = time.Parse(time.RFC3339Nano, m.Headers[headerProducedAt])
+	if meta.Type == "" {
+		meta.Type = eventTypeForTopic(m.Topic)
+	}
+	return meta
+}
+
+// eventTypeForTopic returns the event type of messages without an event-type header,
+// which were produced before the headers existed and are identified by their topic.
+func eventTypeForTopic(topic string) string {
+	cfg := config.GetConfig()
+	switch topic {
+	case cfg.MsgApplyPointsTopic:
+		return domain.EventPointsApply
+	case cfg.MsgBrandSettings:
+		return domain.EventBrandSettingsUpdated
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package msgBroker
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/degarzonm/customer_leal_service/internal/application"
+	"github.com/degarzonm/customer_leal_service/internal/domain"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/metrics"
+	"github.com/degarzonm/customer_leal_service/internal/infrastructure/tracing"
+	"github.com/degarzonm/leal_contracts/bus"
+	"github.com/degarzonm/leal_contracts/pgqueue"
+)
+
+// PostgresQueue is a broker backed by the event_queue table of the shared contracts
+// module, for deployments without Kafka. Services that exchange events must use the same
+// database for the queue.
+type PostgresQueue struct {
+	queue *pgqueue.Queue
+}
+
+func NewPostgresQueue(db *sql.DB, pollInterval time.Duration) *PostgresQueue {
+	return &PostgresQueue{queue: pgqueue.New(db, pollInterval)}
+}
+
+// SendEvent inserts the event in the queue.
+func (q *PostgresQueue) SendEvent(ctx context.Context, topic string, event domain.Event) (err error) {
+	defer func() { metrics.EventProduced(topic, event.Type, err) }()
+	ctx, span := tracing.StartProducer(ctx, topic, event.Type)
+	defer func() { tracing.End(span, err) }()
+
+	m, err := newMessage(ctx, topic, event)
+	if err != nil {
+		return err
+	}
+	id, err := q.queue.Publish(ctx, bus.Message(*m))
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Event queued", "event_type", event.Type, "topic", topic, "id", id, "correlation_id", event.CorrelationID)
+	return nil
+}
+
+type postgresListener struct {
+	queue   *PostgresQueue
+	topics  []string
+	handler *eventHandler
+}
+
+// NewPostgresListener creates a listener that consumes the given topics of the queue and
+// passes their messages to the application service.
+func NewPostgresListener(queue *PostgresQueue, appService *application.AppService, topics []string) Listener {
+	return &postgresListener{queue: queue, topics: topics, handler: &eventHandler{appService: appService}}
+}
+
+// Listen handles the messages of the listener topics until ctx is cancelled.
+func (l *postgresListener) Listen(ctx context.Context) error {
+	return l.queue.queue.Listen(ctx, l.topics, func(ctx context.Context, m bus.Message) {
+		msg := message(m)
+		l.handler.handle(ctx, &msg)
+	})
+}
+
+// Health reports the messages queued on the listener topics.
+func (l *postgresListener) Health(ctx context.Context) (map[string]any, error) {
+	lag, err := l.queue.queue.Lag(ctx, l.topics)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"lag": lag}, nil
+}
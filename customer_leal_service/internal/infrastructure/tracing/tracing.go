@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+
+	"github.com/XSAM/otelsql"
+	"github.com/degarzonm/customer_leal_service/internal/config"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const (
+	instrumentationName = "github.com/degarzonm/customer_leal_service"
+	eventTypeKey        = attribute.Key("leal.event_type")
+)
+
+// untracedRoutes are the probe and scrape routes, left out of the traces.
+var untracedRoutes = map[string]bool{"/ping": true, "/healthz": true, "/readyz": true, "/metrics": true}
+
+// Init sets the W3C trace context propagator and a tracer provider exporting the spans of
+// serviceName with the configured exporter. It returns a function that flushes the pending
+// spans, to be called on shutdown. With no exporter spans are not recorded, but the trace
+// context of incoming requests and events is still passed along.
+func Init(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	cfg := config.GetConfig()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.TracingExporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(cfg.TracingOTLPEndpoint), otlptracehttp.WithInsecure())
+	default:
+		return nil, fmt.Errorf("unknown span exporter %q", cfg.TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// HTTPMiddleware starts a server span for every request, continuing the trace of the
+// caller when the request carries a traceparent header.
+func HTTPMiddleware(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !untracedRoutes[r.URL.Path]
+	}))
+}
+
+// OpenDB opens a postgres database whose queries are recorded as spans. Only queries made
+// within a trace are recorded, so background polling does not start traces of its own.
+func OpenDB(dsn string) (*sql.DB, error) {
+	return otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
+}
+
+// StartProducer starts a span for sending an event of eventType to topic. Its trace
+// context is then written to the message headers with Inject.
+func StartProducer(ctx context.Context, topic string, eventType string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(topic, eventType)...),
+		trace.WithAttributes(semconv.MessagingOperationTypePublish),
+	)
+}
+
+// StartConsumer starts a span for processing an event of eventType consumed from topic,
+// continuing the trace whose context the producer wrote to the message headers.
+func StartConsumer(ctx context.Context, topic string, eventType string, headers map[string]string) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+	return tracer().Start(ctx, topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(topic, eventType)...),
+		trace.WithAttributes(semconv.MessagingOperationTypeDeliver),
+	)
+}
+
+// Inject writes the trace context of ctx to the headers of a message.
+func Inject(ctx context.Context, headers map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+}
+
+// Extract returns ctx with the trace context written to headers by Inject.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+func messagingAttributes(topic string, eventType string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String(config.GetConfig().MsgBrokerType),
+		semconv.MessagingDestinationName(topic),
+		eventTypeKey.String(eventType),
+	}
+}
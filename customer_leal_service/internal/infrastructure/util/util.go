@@ -62,6 +62,56 @@ func GenerateToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// GenerateReferralCode returns a random 8 character code made of uppercase
+// letters and digits, skipping characters that are easy to confuse (0/O, 1/I).
+func GenerateReferralCode() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 8)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b), nil
+}
+
+// NormalizeEmail lowercases an email and removes the "+tag" suffix of the
+// local part, so aliases such as "Juan+1@leal.com" and "juan@leal.com" compare
+// as the same mailbox.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, found := strings.Cut(email, "@")
+	if !found {
+		return email
+	}
+	if i := strings.Index(local, "+"); i >= 0 {
+		local = local[:i]
+	}
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// NormalizePhone keeps only the digits of a phone number and drops any
+// country prefix beyond the last 10 digits.
+func NormalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	d := digits.String()
+	if len(d) > 10 {
+		d = d[len(d)-10:]
+	}
+	return d
+}
+
 // ParseDate takes a string in the format "yyyy-mm-dd" and parses it into a time.Time object.
 // If the string is not in the correct format, an error is returned.
 func ParseDate(dateStr string) (time.Time, error) {
@@ -0,0 +1,5 @@
+// Package e2e tests the brand and customer services together, each running in process on
+// its PostgreSQL repositories, exchanging their events over one shared memory bus. Every
+// test creates the databases of both services on the server of TEST_DATABASE_URL and drops
+// them when it ends; the tests are skipped when it is not set.
+package e2e
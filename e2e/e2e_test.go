@@ -0,0 +1,259 @@
+package e2e
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	brand "github.com/degarzonm/brand_leal_service/harness"
+	customer "github.com/degarzonm/customer_leal_service/harness"
+	"github.com/degarzonm/leal_contracts/bus"
+	_ "github.com/lib/pq"
+)
+
+// TestMain sets the configuration both services read, once per process, with the topics
+// they exchange events on.
+func TestMain(m *testing.M) {
+	for key, value := range map[string]string{
+		"DB_HOST": "localhost", "DB_PORT": "5432", "DB_USER": "test", "DB_NAME": "test",
+		"HTTP_SERVER_PORT": "0", "MSG_BROKER_TYPE": "memory", "OUTBOX_POLL_MS": "10",
+		"MSG_PURCHASE": "purchase-topic", "MSG_APPLY_POINTS": "apply-points-topic",
+		"MSG_BRAND_SETTINGS": "brand-settings-topic", "MSG_PURCHASE_REJECTED": "purchase-rejected-topic",
+		"MSG_EXCHANGE": "exchange-topic",
+	} {
+		os.Setenv(key, value)
+	}
+	os.Exit(m.Run())
+}
+
+// database creates a new database on the PostgreSQL server of TEST_DATABASE_URL, and
+// drops it when the test ends. The test is skipped when TEST_DATABASE_URL is not set.
+func database(t *testing.T, name string) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	server, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	name = fmt.Sprintf("leal_e2e_%s_%d", name, time.Now().UnixNano())
+	if _, err := server.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec("DROP DATABASE " + name + " WITH (FORCE)"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	conn, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// services starts both services on one bus, each on a database of its own, and stops them
+// when the test ends.
+func services(t *testing.T) (*customer.Customer, *brand.Brand) {
+	t.Helper()
+	b := bus.New()
+	customers, err := customer.NewCustomer(database(t, "customer"), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brands, err := brand.NewBrand(database(t, "brand"), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context) error{customers.Run, brands.Run} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := run(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	return customers, brands
+}
+
+// eventually waits for cond to hold, and fails the test if it does not within a few
+// seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// purchaseDone waits for the brand service to reward or reject the purchase, and returns it.
+func purchaseDone(t *testing.T, customers *customer.Customer, customerID, purchaseID int) customer.Purchase {
+	t.Helper()
+	ctx := context.Background()
+	var purchase customer.Purchase
+	eventually(t, "the purchase to be processed", func() bool {
+		var err error
+		if purchase, err = customers.GetPurchase(ctx, customerID, purchaseID); err != nil {
+			t.Fatal(err)
+		}
+		return purchase.Status != customer.PurchasePending
+	})
+	return purchase
+}
+
+// newPurchaser creates a brand whose base campaign rewards every unit of a purchase with
+// 1 point and 0.1 coins, an open or closed branch of it, and a customer with 50 coins, and
+// returns their IDs.
+func newPurchaser(t *testing.T, customers *customer.Customer, brands *brand.Brand, open bool) (brandID, branchID, customerID int) {
+	t.Helper()
+	ctx := context.Background()
+	brandID, err := brands.AddBrand(ctx, 1, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branchID, err = brands.AddBranch(ctx, brandID, open); err != nil {
+		t.Fatal(err)
+	}
+	if customerID, err = customers.AddCustomer(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	return brandID, branchID, customerID
+}
+
+// TestPurchaseIsRewarded checks that a purchase at an open branch is sent through the
+// outbox to the brand service, which settles it and rewards it with the points and coins
+// of the base campaign, and that the customer is credited with them.
+func TestPurchaseIsRewarded(t *testing.T) {
+	customers, brands := services(t)
+	ctx := context.Background()
+	brandID, branchID, customerID := newPurchaser(t, customers, brands, true)
+
+	purchaseID, err := customers.Purchase(ctx, customerID, brandID, branchID, 200, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	purchase := purchaseDone(t, customers, customerID, purchaseID)
+	if purchase.Status != customer.PurchaseCredited || purchase.PointsEarned != 200 || purchase.CoinsEarned != 20 {
+		t.Errorf("purchase %+v, want credited with 200 points and 20 coins", purchase)
+	}
+	coins, points, err := customers.Balance(ctx, customerID, brandID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coins != 50 || points != 200 {
+		t.Errorf("balance of %d coins and %d points, want 50 coins and 200 points", coins, points)
+	}
+	issued, consumed, err := brands.Settlement(ctx, brandID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued != 20 || consumed != 20 {
+		t.Errorf("settlement of %d coins issued and %d consumed, want 20 and 20", issued, consumed)
+	}
+}
+
+// TestPurchaseAtClosedBranchIsRefunded checks that the brand service rejects a purchase at
+// a closed branch without settling it, and that the customer service refunds its coins.
+func TestPurchaseAtClosedBranchIsRefunded(t *testing.T) {
+	customers, brands := services(t)
+	ctx := context.Background()
+	brandID, branchID, customerID := newPurchaser(t, customers, brands, false)
+
+	purchaseID, err := customers.Purchase(ctx, customerID, brandID, branchID, 200, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	purchase := purchaseDone(t, customers, customerID, purchaseID)
+	if purchase.Status != customer.PurchaseRejected || purchase.RejectionReason != "branch_closed" {
+		t.Errorf("purchase %+v, want rejected because the branch is closed", purchase)
+	}
+	coins, points, err := customers.Balance(ctx, customerID, brandID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coins != 50 || points != 0 {
+		t.Errorf("balance of %d coins and %d points, want the 50 coins back and no points", coins, points)
+	}
+	issued, consumed, err := brands.Settlement(ctx, brandID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued != 0 || consumed != 0 {
+		t.Errorf("settlement of %d coins issued and %d consumed, want none", issued, consumed)
+	}
+}
+
+// TestExchangeIsSettled checks that the exchange rates a brand sets reach the customer
+// service, and that the coins a customer exchanges for points of the brand are settled as
+// consumed at it.
+func TestExchangeIsSettled(t *testing.T) {
+	customers, brands := services(t)
+	ctx := context.Background()
+
+	brandID, err := brands.AddBrand(ctx, 1, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customerID, err := customers.AddCustomer(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := brands.UpdateSettings(ctx, brandID, 10, 0.1, 0); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the brand settings", func() bool {
+		coinsToPoints, _, err := customers.ExchangeRates(ctx, brandID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return coinsToPoints == 10
+	})
+
+	if _, err := customers.Exchange(ctx, customerID, brandID, customer.ExchangeCoinsToPoints, 30); err != nil {
+		t.Fatal(err)
+	}
+	coins, points, err := customers.Balance(ctx, customerID, brandID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coins != 70 || points != 300 {
+		t.Errorf("balance of %d coins and %d points, want 70 coins and 300 points", coins, points)
+	}
+	var issued, consumed int
+	eventually(t, "the exchange to be settled", func() bool {
+		if issued, consumed, err = brands.Settlement(ctx, brandID); err != nil {
+			t.Fatal(err)
+		}
+		return consumed == 30
+	})
+	if issued != 0 {
+		t.Errorf("%d coins issued, want none", issued)
+	}
+}